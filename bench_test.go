@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func benchValue(b *testing.B) interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		b.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	return v
+}
+
+func BenchmarkMapIndex(b *testing.B) {
+	v := benchValue(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		issue, ok := v.(map[string]interface{})["issue"].(map[string]interface{})
+		if !ok {
+			b.Fatal("issue not found")
+		}
+		fields, ok := issue["fields"].(map[string]interface{})
+		if !ok {
+			b.Fatal("fields not found")
+		}
+		project, ok := fields["project"].(map[string]interface{})
+		if !ok {
+			b.Fatal("project not found")
+		}
+		if _, ok := project["name"].(string); !ok {
+			b.Fatal("name not found")
+		}
+	}
+}
+
+func BenchmarkEvalPath(b *testing.B) {
+	v := benchValue(b)
+	q, err := Compile(`issue.fields.project.name`)
+	if err != nil {
+		b.Fatalf("Compile failed: %s", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := q.GetString(v); err != nil {
+			b.Fatalf("GetString failed: %s", err)
+		}
+	}
+}
+
+func BenchmarkEvalPathInterpreted(b *testing.B) {
+	v := benchValue(b)
+	q, err := Compile(`issue.fields.project.name`)
+	if err != nil {
+		b.Fatalf("Compile failed: %s", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := q.q.Eval(v); err != nil {
+			b.Fatalf("Eval failed: %s", err)
+		}
+	}
+}
+
+func BenchmarkGetString(b *testing.B) {
+	v := benchValue(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetString(v, `issue.fields.project.name`); err != nil {
+			b.Fatalf("GetString failed: %s", err)
+		}
+	}
+}
+
+func BenchmarkEvalFilter(b *testing.B) {
+	v := benchValue(b)
+	q, err := Compile(`issue.changelog.items[fieldId=="status"].toString`)
+	if err != nil {
+		b.Fatalf("Compile failed: %s", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := q.Eval(v); err != nil {
+			b.Fatalf("Eval failed: %s", err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+)
+
+// Builder constructs queries programmatically without formatting and
+// escaping query strings. Builders are immutable: the methods return
+// a new builder and leave the receiver unmodified, for example:
+//
+//	q, err := Path("issue", "changelog", "items").
+//		Where(Eq("fieldId", "assignee")).
+//		Index(0).
+//		Key("toString").
+//		Query()
+type Builder struct {
+	q   *query
+	err error
+}
+
+// Cond is a filter condition for Builder.Where.
+type Cond struct {
+	f   filter
+	err error
+}
+
+// Path creates a query builder selecting the path of object keys.
+func Path(keys ...string) *Builder {
+	b := &Builder{}
+	if len(keys) == 0 {
+		b.err = fmt.Errorf("jsonq: empty path")
+		return b
+	}
+	for _, key := range keys {
+		b = b.Key(key)
+	}
+	return b
+}
+
+// Key selects the object key.
+func (b *Builder) Key(key string) *Builder {
+	return b.key(key, false)
+}
+
+// OptionalKey selects the object key. If the key is missing from an
+// element of a selection, the element is skipped.
+func (b *Builder) OptionalKey(key string) *Builder {
+	return b.key(key, true)
+}
+
+func (b *Builder) key(key string, optional bool) *Builder {
+	if b.err != nil {
+		return b
+	}
+	return &Builder{
+		q: &query{
+			left:     b.q,
+			optional: optional,
+			key:      key,
+		},
+	}
+}
+
+// Where filters the selected elements with the condition.
+func (b *Builder) Where(c Cond) *Builder {
+	if c.err != nil {
+		return &Builder{
+			err: c.err,
+		}
+	}
+	return b.filter(c.f)
+}
+
+// Index selects the element at the index n.
+func (b *Builder) Index(n int) *Builder {
+	if n < 0 {
+		return &Builder{
+			err: fmt.Errorf("jsonq: negative index %d", n),
+		}
+	}
+	return b.filter(&comparative{
+		Left: &atom{
+			Type:   tInt,
+			IntVal: n,
+		},
+		Op: tInt,
+	})
+}
+
+// All selects all elements of the array.
+func (b *Builder) All() *Builder {
+	return b.filter(&all{})
+}
+
+// filter returns a new builder with the filter f added to the last
+// segment. The last segment is copied so that the receiver's query is
+// left unmodified.
+func (b *Builder) filter(f filter) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if b.q == nil {
+		return &Builder{
+			err: fmt.Errorf("jsonq: filter without path"),
+		}
+	}
+	segment := *b.q
+	segment.filters = make([]filter, len(b.q.filters), len(b.q.filters)+1)
+	copy(segment.filters, b.q.filters)
+	segment.filters = append(segment.filters, f)
+
+	return &Builder{
+		q: &segment,
+	}
+}
+
+// Query returns the constructed query.
+func (b *Builder) Query() (*Query, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.q == nil {
+		return nil, fmt.Errorf("jsonq: empty path")
+	}
+	err := b.q.checkDepth()
+	if err != nil {
+		return nil, err
+	}
+	return newQuery(b.q.String(), b.q), nil
+}
+
+// Eq creates a condition matching elements whose field equals the
+// value. The value must be a string or an integer.
+func Eq(field string, value interface{}) Cond {
+	return compare(field, tEq, value)
+}
+
+// Ne creates a condition matching elements whose field does not
+// equal the value.
+func Ne(field string, value interface{}) Cond {
+	return compare(field, tNeq, value)
+}
+
+// Lt creates a condition matching elements whose field is less than
+// the value.
+func Lt(field string, value interface{}) Cond {
+	return compare(field, tLt, value)
+}
+
+// Le creates a condition matching elements whose field is less than
+// or equal to the value.
+func Le(field string, value interface{}) Cond {
+	return compare(field, tLe, value)
+}
+
+// Gt creates a condition matching elements whose field is greater
+// than the value.
+func Gt(field string, value interface{}) Cond {
+	return compare(field, tGt, value)
+}
+
+// Ge creates a condition matching elements whose field is greater
+// than or equal to the value.
+func Ge(field string, value interface{}) Cond {
+	return compare(field, tGe, value)
+}
+
+func compare(field string, op tokenType, value interface{}) Cond {
+	right := &atom{}
+	switch v := value.(type) {
+	case string:
+		right.Type = tString
+		right.StrVal = v
+	case int:
+		right.Type = tInt
+		right.IntVal = v
+	case nil:
+		right.Type = tNull
+	default:
+		return Cond{
+			err: fmt.Errorf("jsonq: value type %T not supported", value),
+		}
+	}
+	return Cond{
+		f: &comparative{
+			Left: &atom{
+				Type:   tString,
+				StrVal: field,
+			},
+			Op:    op,
+			Right: right,
+		},
+	}
+}
+
+// And creates a condition matching elements that match both
+// conditions.
+func And(a, b Cond) Cond {
+	return combine(a, tAnd, b)
+}
+
+// Or creates a condition matching elements that match either
+// condition.
+func Or(a, b Cond) Cond {
+	return combine(a, tOr, b)
+}
+
+func combine(a Cond, op tokenType, b Cond) Cond {
+	if a.err != nil {
+		return a
+	}
+	if b.err != nil {
+		return b
+	}
+	return Cond{
+		f: &logical{
+			Left:  a.f,
+			Op:    op,
+			Right: b.f,
+		},
+	}
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	v := parseAssign(t)
+
+	items := Path("issue", "changelog", "items")
+	tests := []struct {
+		b        *Builder
+		expected string
+	}{
+		{
+			b: items.Where(Eq("fieldId", "assignee")).Index(1).
+				Key("toString"),
+			expected: `["Milton Waddams"]`,
+		},
+		{
+			b: items.Where(Or(Eq("priority", 100),
+				And(Eq("fieldId", "assignee"), Ne("toString", "Veijo Linux")))).
+				Key("toString"),
+			expected: `["development","Milton Waddams"]`,
+		},
+		{
+			b:        items.Where(Ge("priority", 100)).Key("fieldId"),
+			expected: `["status"]`,
+		},
+		{
+			b:        items.All().OptionalKey("missing"),
+			expected: `[]`,
+		},
+		{
+			b:        Path("issue", "key"),
+			expected: `"OP-1"`,
+		},
+	}
+	for _, test := range tests {
+		q, err := test.b.Query()
+		if err != nil {
+			t.Fatalf("Query failed: %s", err)
+		}
+		result, err := q.Eval(v)
+		if err != nil {
+			t.Fatalf("Eval %s failed: %s", q, err)
+		}
+		if marshal(t, result) != test.expected {
+			t.Errorf("Eval %s: got %s, expected %s", q, marshal(t, result),
+				test.expected)
+		}
+		// The query source must compile to an equivalent query.
+		compiled, err := Compile(q.String())
+		if err != nil {
+			t.Fatalf("Compile %s failed: %s", q, err)
+		}
+		result, err = compiled.Eval(v)
+		if err != nil {
+			t.Fatalf("Eval %s failed: %s", q, err)
+		}
+		if marshal(t, result) != test.expected {
+			t.Errorf("Eval %s: got %s, expected %s", compiled,
+				marshal(t, result), test.expected)
+		}
+	}
+
+	for _, b := range []*Builder{
+		Path(),
+		items.Where(Eq("fieldId", 1.5)),
+		items.Index(-1),
+	} {
+		_, err := b.Query()
+		if err == nil {
+			t.Errorf("Query succeeded for invalid builder")
+		}
+	}
+}
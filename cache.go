@@ -0,0 +1,127 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultQueryCacheSize specifies the default number of parsed
+// queries kept in the query cache.
+const DefaultQueryCacheSize = 128
+
+var queryCache = newLRU(DefaultQueryCacheSize)
+
+// SetQueryCacheSize sets the maximum number of parsed queries that
+// Get, the typed getters, and Context.Select keep in their query
+// cache. The size 0 disables the cache.
+func SetQueryCacheSize(size int) {
+	queryCache.Resize(size)
+}
+
+// cachedCompile compiles the query q, using the query cache to skip
+// parsing for recently used queries.
+func cachedCompile(q string) (*Query, error) {
+	return queryCache.compile(q)
+}
+
+// compile compiles the query q, using the cache to skip parsing for
+// recently used queries.
+func (c *lru) compile(q string) (*Query, error) {
+	query := c.Get(q)
+	if query != nil {
+		if m := currentMetrics(); m != nil {
+			m.CacheHit()
+		}
+		return query, nil
+	}
+	if m := currentMetrics(); m != nil {
+		m.CacheMiss()
+	}
+	query, err := Compile(q)
+	if err != nil {
+		return nil, err
+	}
+	c.Add(q, query)
+	return query, nil
+}
+
+type lruEntry struct {
+	key   string
+	value *Query
+}
+
+type lru struct {
+	m       sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lru) Get(key string) *Query {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value
+}
+
+func (c *lru) Add(key string, value *Query) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+	e, ok := c.entries[key]
+	if ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{
+		key:   key,
+		value: value,
+	})
+	c.evict()
+}
+
+func (c *lru) Resize(size int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.size = size
+	c.evict()
+}
+
+func (c *lru) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *lru) evict() {
+	for c.order.Len() > 0 && c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*lruEntry).key)
+	}
+}
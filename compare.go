@@ -0,0 +1,93 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Comparator compares the value of a filter field to the literal
+// value of the filter comparison. The values are JSON values: the
+// integer literals are passed as float64 numbers. The comparator
+// returns -1, 0, or 1 if the field value is less than, equal to, or
+// greater than the literal value. If the comparator does not handle
+// the values, it returns false and the values are compared with the
+// default comparison semantics.
+type Comparator func(field, literal interface{}) (int, bool)
+
+type comparatorHolder struct {
+	c Comparator
+}
+
+var comparator atomic.Value
+
+// SetComparator sets the comparator that the filter comparisons use
+// unless a comparator is set with the WithComparator option. The nil
+// comparator restores the default comparison semantics.
+func SetComparator(c Comparator) {
+	comparator.Store(comparatorHolder{c})
+}
+
+// WithComparator sets the comparator for the filter comparisons.
+func WithComparator(c Comparator) Option {
+	return func(o *options) {
+		o.comparator = c
+	}
+}
+
+// comparator returns the comparator of the evaluation or nil if the
+// default comparison semantics apply.
+func (e *env) comparator() Comparator {
+	o := e.options()
+	if o != nil && o.comparator != nil {
+		return o.comparator
+	}
+	h, ok := comparator.Load().(comparatorHolder)
+	if !ok {
+		return nil
+	}
+	return h.c
+}
+
+// defaultCompare tests if the filter comparisons use the default
+// comparison semantics.
+func (e *env) defaultCompare() bool {
+	if e.comparator() != nil {
+		return false
+	}
+	o := e.options()
+	return o == nil ||
+		!(o.foldKeys || o.strictness != Default || o.null != NullDefault)
+}
+
+// compareResult converts the comparator result cmp to the result of
+// the comparison operator op.
+func compareResult(op tokenType, cmp int) (bool, error) {
+	switch op {
+	case tEq:
+		return cmp == 0, nil
+
+	case tNeq:
+		return cmp != 0, nil
+
+	case tLt:
+		return cmp < 0, nil
+
+	case tLe:
+		return cmp <= 0, nil
+
+	case tGt:
+		return cmp > 0, nil
+
+	case tGe:
+		return cmp >= 0, nil
+
+	default:
+		return false, fmt.Errorf("invalid comparison operator %s", op)
+	}
+}
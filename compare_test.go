@@ -0,0 +1,91 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var releases = `[
+  {"version": "1.9.0", "downloads": null},
+  {"version": "1.10.2", "downloads": 50},
+  {"version": "2.0", "downloads": 500}
+]`
+
+// compareVersions compares dotted version strings numerically.
+func compareVersions(field, literal interface{}) (int, bool) {
+	a, ok := field.(string)
+	if !ok {
+		return 0, false
+	}
+	b, ok := literal.(string)
+	if !ok {
+		return 0, false
+	}
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+		if an < bn {
+			return -1, true
+		} else if an > bn {
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// nullFirst orders null values before all other values.
+func nullFirst(field, literal interface{}) (int, bool) {
+	if field == nil {
+		return -1, true
+	}
+	return 0, false
+}
+
+func TestComparator(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(releases), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := map[string]interface{}{
+		"releases": v,
+	}
+
+	q := `releases[version>="1.10"].version`
+	versions, err := Ctx(root).Select(q).Strings()
+	if err != nil || len(versions) != 3 {
+		t.Errorf("default comparison: got %v %v", versions, err)
+	}
+	versions, err = Ctx(root, WithComparator(compareVersions)).
+		Select(q).Strings()
+	if err != nil || len(versions) != 2 || versions[0] != "1.10.2" {
+		t.Errorf("WithComparator: got %v %v", versions, err)
+	}
+
+	q = `releases[downloads<100].version`
+	_, err = Ctx(root).Select(q).Strings()
+	if err == nil {
+		t.Errorf("default comparison accepted null")
+	}
+	SetComparator(nullFirst)
+	versions, err = Ctx(root).Select(q).Strings()
+	SetComparator(nil)
+	if err != nil || len(versions) != 2 || versions[0] != "1.9.0" {
+		t.Errorf("SetComparator: got %v %v", versions, err)
+	}
+}
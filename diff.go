@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operation describes a JSON Patch operation as specified in RFC
+// 6902. The Path is a JSON Pointer (RFC 6901) to the target value.
+type Operation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+func (op Operation) String() string {
+	switch op.Op {
+	case "remove":
+		return fmt.Sprintf("%s %s", op.Op, op.Path)
+	default:
+		return fmt.Sprintf("%s %s %v", op.Op, op.Path, op.Value)
+	}
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (op Operation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{
+			Op:   op.Op,
+			Path: op.Path,
+		})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{
+		Op:    op.Op,
+		Path:  op.Path,
+		Value: op.Value,
+	})
+}
+
+// Diff computes the RFC 6902 JSON Patch operations that transform the
+// value a into the value b. The object members are compared in the
+// sorted key order and the arrays element by element, so the result
+// is deterministic.
+func Diff(a, b interface{}) ([]Operation, error) {
+	return diff(nil, "", a, b)
+}
+
+func diff(ops []Operation, path string, a, b interface{}) (
+	[]Operation, error) {
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(av) {
+			_, ok := bv[key]
+			if !ok {
+				ops = append(ops, Operation{
+					Op:   "remove",
+					Path: path + "/" + escapePointer(key),
+				})
+			}
+		}
+		var err error
+		for _, key := range sortedKeys(bv) {
+			p := path + "/" + escapePointer(key)
+			old, ok := av[key]
+			if !ok {
+				ops = append(ops, Operation{
+					Op:    "add",
+					Path:  p,
+					Value: bv[key],
+				})
+				continue
+			}
+			ops, err = diff(ops, p, old, bv[key])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ops, nil
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		var err error
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			ops, err = diff(ops, path+"/"+strconv.Itoa(i), av[i], bv[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := len(av); i < len(bv); i++ {
+			ops = append(ops, Operation{
+				Op:    "add",
+				Path:  path + "/" + strconv.Itoa(i),
+				Value: bv[i],
+			})
+		}
+		// Remove extra elements from the end so that the indices of
+		// the preceding elements remain valid.
+		for i := len(av) - 1; i >= len(bv); i-- {
+			ops = append(ops, Operation{
+				Op:   "remove",
+				Path: path + "/" + strconv.Itoa(i),
+			})
+		}
+		return ops, nil
+
+	case nil, bool, float64, string, json.Number:
+		if equalScalars(a, b) {
+			return ops, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("jsonq: diff: unsupported value %T", a)
+	}
+
+	switch b.(type) {
+	case map[string]interface{}, []interface{}, nil, bool, float64, string,
+		json.Number:
+	default:
+		return nil, fmt.Errorf("jsonq: diff: unsupported value %T", b)
+	}
+	return append(ops, Operation{
+		Op:    "replace",
+		Path:  path,
+		Value: b,
+	}), nil
+}
+
+func equalScalars(a, b interface{}) bool {
+	if typeRank(a) != typeRank(b) {
+		return false
+	}
+	return compareValues(a, b) == 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(key string) string {
+	return pointerEscaper.Replace(key)
+}
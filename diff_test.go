@@ -0,0 +1,63 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+var diffTests = []struct {
+	a     string
+	b     string
+	patch string
+}{
+	{`{"a":1}`, `{"a":1}`, `null`},
+	{`{"a":1}`, `{"a":2}`, `[{"op":"replace","path":"/a","value":2}]`},
+	{`{"a":1,"b":2}`, `{"b":2,"c":null}`,
+		`[{"op":"remove","path":"/a"},{"op":"add","path":"/c","value":null}]`},
+	{`{"a/b":{"c~d":true}}`, `{"a/b":{"c~d":false}}`,
+		`[{"op":"replace","path":"/a~1b/c~0d","value":false}]`},
+	{`[1,2,3]`, `[1,4]`,
+		`[{"op":"replace","path":"/1","value":4},{"op":"remove","path":"/2"}]`},
+	{`[1]`, `[1,[2]]`, `[{"op":"add","path":"/1","value":[2]}]`},
+	{`{"a":[1]}`, `{"a":{"0":1}}`,
+		`[{"op":"replace","path":"/a","value":{"0":1}}]`},
+	{`"1"`, `1`, `[{"op":"replace","path":"","value":1}]`},
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range diffTests {
+		ops, err := Diff(unmarshal(t, test.a), unmarshal(t, test.b))
+		if err != nil {
+			t.Fatalf("Diff failed: %s", err)
+		}
+		patch := marshal(t, ops)
+		if patch != test.patch {
+			t.Errorf("Diff(%s, %s): got %s, expected %s",
+				test.a, test.b, patch, test.patch)
+		}
+	}
+
+	v := parseAssign(t)
+	w := parseAssign(t)
+	err := Set(w, `issue.changelog.items[fieldId=="assignee"][1]`, "none")
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	ops, err := Diff(v, w)
+	if err != nil {
+		t.Fatalf("Diff failed: %s", err)
+	}
+	if len(ops) != 1 || ops[0].Path != "/issue/changelog/items/2" {
+		t.Errorf("Diff: got %v", ops)
+	}
+
+	_, err = Diff(map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2})
+	if err == nil {
+		t.Errorf("Diff accepted non-JSON values")
+	}
+}
@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// checkInterval specifies how many evaluation steps are taken between
+// the cancellation checks.
+const checkInterval = 64
+
+// env holds the state of one query evaluation. The nil env evaluates
+// without cancellation and with the default options.
+type env struct {
+	ctx       context.Context
+	deadline  time.Time
+	steps     int
+	opts      *options
+	filtering int
+	metrics   bool
+	filtered  int
+	vars      *scope
+}
+
+func newEnv(ctx context.Context) *env {
+	return &env{
+		ctx: ctx,
+	}
+}
+
+// check checks if the evaluation context is done or the evaluation
+// timeout has expired. The context and the deadline are consulted on
+// every checkInterval call to keep the checks cheap.
+func (e *env) check() error {
+	if e == nil || (e.ctx == nil && e.deadline.IsZero()) {
+		return nil
+	}
+	e.steps++
+	if e.steps%checkInterval != 1 {
+		return nil
+	}
+	if !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		return ErrEvalTimeout
+	}
+	if e.ctx == nil {
+		return nil
+	}
+	return e.ctx.Err()
+}
+
+// withOptions returns an environment evaluating with the options o.
+// The receiver is left unmodified.
+func (e *env) withOptions(o *options) *env {
+	if o == nil || e.options() == o {
+		return e
+	}
+	result := new(env)
+	if e != nil {
+		*result = *e
+	}
+	result.opts = o
+	if result.deadline.IsZero() && o.timeout > 0 {
+		result.deadline = time.Now().Add(o.timeout)
+	}
+	return result
+}
+
+// options returns the evaluation options. It returns nil for the
+// default options.
+func (e *env) options() *options {
+	if e == nil {
+		return nil
+	}
+	return e.opts
+}
+
+// compile compiles the query q with the evaluation options.
+func (e *env) compile(q string) (*Query, error) {
+	return e.options().compile(q)
+}
+
+// lookup gets the value of the key from the object value v like the
+// lookup function. If the keys are matched case-insensitively, the
+// function falls back to a case-insensitive match when the object
+// does not have the key.
+func (e *env) lookup(v interface{}, key string) (
+	child interface{}, found, ok bool) {
+
+	child, found, ok = lookup(v, key)
+	if found || !ok {
+		return
+	}
+	o := e.options()
+	if o == nil || !o.foldKeys {
+		return
+	}
+	for _, k := range objectKeys(v) {
+		if strings.EqualFold(k, key) {
+			return lookup(v, k)
+		}
+	}
+	return
+}
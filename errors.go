@@ -0,0 +1,211 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound reports that a query element was not found. The errors
+// for missing elements match ErrNotFound with errors.Is.
+var ErrNotFound = errors.New("jsonq: element not found")
+
+// ErrQueryTooComplex reports that a query exceeds the maximum query
+// complexity. The complexity errors match ErrQueryTooComplex with
+// errors.Is.
+var ErrQueryTooComplex = errors.New("jsonq: query too complex")
+
+// ErrEvalTimeout reports that an evaluation exceeded the timeout set
+// with WithTimeout.
+var ErrEvalTimeout = errors.New("jsonq: evaluation timeout")
+
+// maxErrorKeys is the maximum number of available keys listed in
+// not-found errors.
+const maxErrorKeys = 10
+
+// notFound reports that the query element was not found. The error
+// lists the keys of the object where the lookup failed. The keys are
+// resolved when the error message is formatted so that the callers
+// that only test for missing elements don't pay for them.
+type notFound struct {
+	query  string
+	key    string
+	parent string
+	object interface{}
+}
+
+func (e *notFound) Error() string {
+	msg := fmt.Sprintf("jsonq: element '%s' not found", e.query)
+	if len(e.parent) > 0 {
+		msg += fmt.Sprintf(": no key '%s' in '%s'", e.key, e.parent)
+	} else {
+		msg += fmt.Sprintf(": no key '%s'", e.key)
+	}
+	keys := objectKeys(e.object)
+	if len(keys) == 0 {
+		return msg + ", object is empty"
+	}
+	var more int
+	if len(keys) > maxErrorKeys {
+		more = len(keys) - maxErrorKeys
+		keys = keys[:maxErrorKeys]
+	}
+	msg += ", available keys: " + strings.Join(keys, ", ")
+	if more > 0 {
+		msg += fmt.Sprintf(" (and %d more)", more)
+	}
+	return msg
+}
+
+// Is tests if the target is ErrNotFound.
+func (e *notFound) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// noMatch reports that a modification query did not match any
+// elements.
+type noMatch struct {
+	query string
+}
+
+func (e *noMatch) Error() string {
+	return fmt.Sprintf("jsonq: query '%s' does not match any elements",
+		e.query)
+}
+
+// Is tests if the target is ErrNotFound.
+func (e *noMatch) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// complexityError reports that the query complexity exceeds the
+// maximum complexity.
+type complexityError struct {
+	complexity int
+	max        int
+}
+
+func (e *complexityError) Error() string {
+	return fmt.Sprintf("jsonq: query too complex: complexity %d, maximum is %d",
+		e.complexity, e.max)
+}
+
+// Is tests if the target is ErrQueryTooComplex.
+func (e *complexityError) Is(target error) bool {
+	return target == ErrQueryTooComplex
+}
+
+// TypeError reports that a value has an unexpected JSON type.
+type TypeError struct {
+	// Query is the query that selected the value. For the elements
+	// of a Context selection, the query is the element index in the
+	// form [n].
+	Query string
+	// Want is the expected JSON type.
+	Want string
+	// Got is the actual JSON type of the value.
+	Got string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("jsonq: value of '%s' is %s, expected %s",
+		e.Query, e.Got, e.Want)
+}
+
+// elementTypeError creates a type error for the element idx of a
+// selection.
+func elementTypeError(idx int, want string, v interface{}) error {
+	return &TypeError{
+		Query: fmt.Sprintf("[%d]", idx),
+		Want:  want,
+		Got:   typeName(v),
+	}
+}
+
+// FilterError reports that a filter failed for an array element.
+type FilterError struct {
+	// Query is the query segment whose filter failed.
+	Query string
+	// Index is the index of the array element.
+	Index int
+	// Err is the filter's error.
+	Err error
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("jsonq: filter of '%s' failed for element %d: %s",
+		e.Query, e.Index, e.Err)
+}
+
+// Unwrap returns the filter's error.
+func (e *FilterError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError reports that Extract failed to set a struct field.
+type FieldError struct {
+	// Struct is the name of the struct type.
+	Struct string
+	// Field is the name of the struct field.
+	Field string
+	// Query is the query of the field's tag.
+	Query string
+	// Index is the index of the selection element when extracting
+	// into a slice, or -1 otherwise.
+	Index int
+	// Err is the extraction error.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	msg := fmt.Sprintf("jsonq: %s.%s (query %q)", e.Struct, e.Field, e.Query)
+	if e.Index >= 0 {
+		msg += fmt.Sprintf(" at element %d", e.Index)
+	}
+	return msg + ": " + strings.TrimPrefix(e.Err.Error(), "jsonq: ")
+}
+
+// Unwrap returns the extraction error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// elementFieldError sets the element index idx to the field error
+// err, unless the error already has an index.
+func elementFieldError(idx int, err error) error {
+	fieldErr, ok := err.(*FieldError)
+	if ok && fieldErr.Index < 0 {
+		fieldErr.Index = idx
+	}
+	return err
+}
+
+// LimitError reports that an evaluation exceeded a limit set with
+// the options.
+type LimitError struct {
+	// Limit names the exceeded limit.
+	Limit string
+	// Max is the value of the limit.
+	Max int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("jsonq: %s limit %d exceeded", e.Limit, e.Max)
+}
+
+// mismatch tests if the error reports that a query does not match
+// the structure of a value, that is, an element is missing or a value
+// can't be indexed.
+func mismatch(err error) bool {
+	if errors.Is(err, ErrNotFound) {
+		return true
+	}
+	var typeErr *TypeError
+	return errors.As(err, &typeErr) && typeErr.Want == "object"
+}
@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	v := parseAssign(t)
+
+	_, err := Get(v, "issue.missing.key")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get: expected ErrNotFound, got %v", err)
+	}
+
+	var typeErr *TypeError
+	_, err = GetString(v, "issue.count")
+	if !errors.As(err, &typeErr) || typeErr.Want != "string" ||
+		typeErr.Got != "int" || typeErr.Query != "issue.count" {
+		t.Errorf("GetString: expected TypeError, got %v", err)
+	}
+	_, err = Get(v, "issue.key.x")
+	if !errors.As(err, &typeErr) || typeErr.Want != "object" {
+		t.Errorf("Get: expected TypeError, got %v", err)
+	}
+	_, err = Get(v, "issue.key::int")
+	if !errors.As(err, &typeErr) || typeErr.Want != "int" {
+		t.Errorf("Get: expected TypeError, got %v", err)
+	}
+	_, err = Ctx(v).Select("issue.changelog.items[].priority").Strings()
+	if !errors.As(err, &typeErr) || typeErr.Query != "[0]" {
+		t.Errorf("Strings: expected TypeError, got %v", err)
+	}
+
+	var filterErr *FilterError
+	_, err = Get(v, `issue.changelog.items[missing=="x"]`)
+	if !errors.As(err, &filterErr) || filterErr.Index != 0 {
+		t.Errorf("Get: expected FilterError, got %v", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("FilterError does not wrap ErrNotFound: %v", err)
+	}
+
+	var syntaxErr *SyntaxError
+	_, err = Compile("issue..key")
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 6 {
+		t.Errorf("Compile: expected SyntaxError, got %v", err)
+	}
+
+	n, err := Ctx(v).SelectAny("issue.missing", "issue.key.x", "issue.key").
+		Count()
+	if err != nil || n != 1 {
+		t.Errorf("SelectAny: got %v %v, expected 1", n, err)
+	}
+	_, err = Ctx(v).
+		SelectAny(`issue.changelog.items[fieldId==10]`, "issue.key").
+		Count()
+	if !errors.As(err, &filterErr) {
+		t.Errorf("SelectAny: expected FilterError, got %v", err)
+	}
+}
+
+func TestNotFoundKeys(t *testing.T) {
+	v := map[string]interface{}{
+		"issue": map[string]interface{}{
+			"key":    "OPS-1",
+			"fields": map[string]interface{}{},
+		},
+	}
+	tests := []struct {
+		q   string
+		msg string
+	}{
+		{
+			q:   "isue.key",
+			msg: "jsonq: element 'isue' not found: no key 'isue', available keys: issue",
+		},
+		{
+			q:   "issue.kye",
+			msg: "jsonq: element 'issue.kye' not found: no key 'kye' in 'issue', available keys: fields, key",
+		},
+		{
+			q:   "issue.fields.name",
+			msg: "jsonq: element 'issue.fields.name' not found: no key 'name' in 'issue.fields', object is empty",
+		},
+	}
+	for _, test := range tests {
+		_, err := Get(v, test.q)
+		if err == nil || err.Error() != test.msg {
+			t.Errorf("Get(%s): got %v, expected %s", test.q, err, test.msg)
+		}
+	}
+
+	m := make(map[string]interface{})
+	for i := 0; i < maxErrorKeys+2; i++ {
+		m[fmt.Sprintf("k%02d", i)] = i
+	}
+	_, err := Get(m, "missing")
+	if err == nil || !strings.HasSuffix(err.Error(), "k09 (and 2 more)") {
+		t.Errorf("Get: keys not truncated: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explain describes how the query is evaluated: its path segments,
+// which segments are optional, the filters applied to each segment,
+// and whether the query returns a single value or a list of
+// values. The description helps to debug why a query does not return
+// the expected values.
+func (q *Query) Explain() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "query: %s\n", q.src)
+	if q.x != nil {
+		explainExpr(&sb, q.x)
+	} else {
+		explainPath(&sb, q.q)
+	}
+	return sb.String()
+}
+
+// explainExpr describes the evaluation of the expression x.
+func explainExpr(sb *strings.Builder, x expr) {
+	switch x := x.(type) {
+	case *pathExpr:
+		explainPath(sb, x.q)
+
+	case *letExpr:
+		fmt.Fprintf(sb, "let $%s = %s, evaluated against the root\n",
+			x.name, exprString(x.value))
+		explainExpr(sb, x.body)
+
+	default:
+		fmt.Fprintf(sb, "result: value of %s\n", exprString(x))
+	}
+}
+
+// explainPath describes the evaluation of the path query q.
+func explainPath(sb *strings.Builder, q *query) {
+	var selects bool
+	for idx, s := range q.segments() {
+		fmt.Fprintf(sb, "%d: key %q", idx+1, s.key)
+		if s.optional {
+			sb.WriteString(" (optional: skipped if missing)")
+		} else {
+			sb.WriteString(" (required: error if missing)")
+		}
+		if selects {
+			sb.WriteString(", evaluated for each selected element")
+		}
+		sb.WriteString("\n")
+		for fidx, f := range s.filters {
+			fmt.Fprintf(sb, "   filter %d: %s\n", fidx+1, explainFilter(f))
+		}
+		if len(s.filters) > 0 {
+			selects = true
+		}
+	}
+	if selects {
+		sb.WriteString("result: list of matching elements, possibly empty\n")
+	} else {
+		sb.WriteString("result: single value\n")
+	}
+	if len(q.typ) > 0 {
+		fmt.Fprintf(sb, "type: %s, error if a result has another type\n",
+			q.typ)
+	}
+}
+
+func explainFilter(f filter) string {
+	switch ast := f.(type) {
+	case *all:
+		return "all elements"
+
+	case *comparative:
+		if ast.Op == tInt {
+			return fmt.Sprintf("element at index %d", ast.Left.IntVal)
+		}
+		if ast.Right == nil {
+			return ast.Left.String()
+		}
+		return fmt.Sprintf("elements where %s %s %s", ast.Left, ast.Op,
+			ast.Right)
+
+	case *keyFilter:
+		return fmt.Sprintf("values of the object keys matching %q",
+			ast.pattern)
+
+	case *logical:
+		return fmt.Sprintf("(%s) %s (%s), right operand evaluated only if needed",
+			explainFilter(ast.Left), ast.Op, explainFilter(ast.Right))
+
+	default:
+		return f.String()
+	}
+}
+
+// segments returns the query's path segments from the root to the
+// last segment.
+func (q *query) segments() []*query {
+	return q.appendSegments(nil)
+}
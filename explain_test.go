@@ -0,0 +1,43 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	q, err := Compile(`issue.?changelog.items[fieldId=="assignee" || priority>=10][0].toString`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	expected := `query: issue.?changelog.items[fieldId=="assignee" || priority>=10][0].toString
+1: key "issue" (required: error if missing)
+2: key "changelog" (optional: skipped if missing)
+3: key "items" (required: error if missing)
+   filter 1: (elements where "fieldId" == "assignee") || (elements where "priority" >= 10), right operand evaluated only if needed
+   filter 2: element at index 0
+4: key "toString" (required: error if missing), evaluated for each selected element
+result: list of matching elements, possibly empty
+`
+	if q.Explain() != expected {
+		t.Errorf("Explain: got\n%s\nexpected\n%s", q.Explain(), expected)
+	}
+
+	q, err = Compile(`issue.key`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	expected = `query: issue.key
+1: key "issue" (required: error if missing)
+2: key "key" (required: error if missing)
+result: single value
+`
+	if q.Explain() != expected {
+		t.Errorf("Explain: got\n%s\nexpected\n%s", q.Explain(), expected)
+	}
+}
@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteCSV writes the current selection as CSV data into the
+// writer. The columns are queries that are evaluated against each
+// selected element and the query results are written as one CSV row
+// per element. The first row contains the column queries as
+// headers. Missing optional values and null values are written as
+// empty strings, and objects and arrays as JSON data.
+func (ctx *Context) WriteCSV(w io.Writer, columns ...string) error {
+	if ctx.err != nil {
+		return ctx.err
+	}
+	queries, err := ctx.compileAll(columns)
+	if err != nil {
+		return err
+	}
+	out := csv.NewWriter(w)
+	err = out.Write(columns)
+	if err != nil {
+		return err
+	}
+	e := ctx.opts.env()
+	row := make([]string, len(queries))
+	for _, sel := range ctx.selection {
+		for idx, q := range queries {
+			v, err := q.eval(e, sel)
+			if err != nil && err != ErrorOptionalMissing {
+				return err
+			}
+			row[idx], err = csvValue(v)
+			if err != nil {
+				return err
+			}
+		}
+		err = out.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func csvValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+
+	case string:
+		return val, nil
+
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+
+	case json.Number:
+		return val.String(), nil
+
+	case bool:
+		return strconv.FormatBool(val), nil
+
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("jsonq: can't encode %T: %s", v, err)
+		}
+		return string(data), nil
+	}
+}
+
+// GoLiteral formats the current selection as a Go composite
+// literal. A single-element selection is formatted as the element
+// value and other selections as []interface{} literals. The output is
+// suitable for test fixtures.
+func (ctx *Context) GoLiteral() (string, error) {
+	if ctx.err != nil {
+		return "", ctx.err
+	}
+	if len(ctx.selection) == 1 {
+		return GoLiteral(ctx.selection[0])
+	}
+	return GoLiteral(ctx.selection)
+}
+
+// GoLiteral formats the JSON value v as a Go literal, for example,
+// map[string]interface{}{"key": "OP-1"}. The numbers are formatted as
+// float64 values, matching the values json.Unmarshal produces.
+func GoLiteral(v interface{}) (string, error) {
+	var sb strings.Builder
+	err := goLiteral(&sb, v, 0)
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func goLiteral(sb *strings.Builder, v interface{}, indent int) error {
+	switch val := v.(type) {
+	case nil:
+		sb.WriteString("nil")
+
+	case bool:
+		sb.WriteString(strconv.FormatBool(val))
+
+	case string:
+		sb.WriteString(strconv.Quote(val))
+
+	case json.Number:
+		fmt.Fprintf(sb, "json.Number(%q)", val.String())
+
+	case float64:
+		switch {
+		case math.IsInf(val, 1):
+			sb.WriteString("math.Inf(1)")
+		case math.IsInf(val, -1):
+			sb.WriteString("math.Inf(-1)")
+		case math.IsNaN(val):
+			sb.WriteString("math.NaN()")
+		default:
+			str := strconv.FormatFloat(val, 'g', -1, 64)
+			if !strings.ContainsAny(str, ".e") {
+				str += ".0"
+			}
+			sb.WriteString(str)
+		}
+
+	case []interface{}:
+		sb.WriteString("[]interface{}{")
+		if len(val) > 0 {
+			sb.WriteString("\n")
+			for _, item := range val {
+				sb.WriteString(strings.Repeat("\t", indent+1))
+				err := goLiteral(sb, item, indent+1)
+				if err != nil {
+					return err
+				}
+				sb.WriteString(",\n")
+			}
+			sb.WriteString(strings.Repeat("\t", indent))
+		}
+		sb.WriteString("}")
+
+	case map[string]interface{}:
+		sb.WriteString("map[string]interface{}{")
+		if len(val) > 0 {
+			sb.WriteString("\n")
+			for _, key := range sortedKeys(val) {
+				sb.WriteString(strings.Repeat("\t", indent+1))
+				sb.WriteString(strconv.Quote(key))
+				sb.WriteString(": ")
+				err := goLiteral(sb, val[key], indent+1)
+				if err != nil {
+					return err
+				}
+				sb.WriteString(",\n")
+			}
+			sb.WriteString(strings.Repeat("\t", indent))
+		}
+		sb.WriteString("}")
+
+	default:
+		return fmt.Errorf("jsonq: can't format %T as Go literal", v)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := Ctx(assign).
+		Select("issue.changelog.items").
+		WriteCSV(&buf, "fieldId", "priority", "fromString", "?missing")
+	if err != nil {
+		t.Fatalf("WriteCSV failed: %s", err)
+	}
+	expected := `fieldId,priority,fromString,?missing
+status,100,backlog,
+assignee,10,,
+assignee,10,Veijo Linux,
+`
+	if buf.String() != expected {
+		t.Errorf("WriteCSV: got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	err = Ctx(assign).WriteCSV(&buf, "issue.fields", `issue.key`)
+	if err != nil {
+		t.Fatalf("WriteCSV failed: %s", err)
+	}
+	expected = `issue.fields,issue.key
+"{""project"":{""name"":""Operations""}}",OP-1
+`
+	if buf.String() != expected {
+		t.Errorf("WriteCSV: got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	err = Ctx(assign).WriteCSV(&buf, "missing")
+	if err == nil {
+		t.Errorf("WriteCSV succeeded with missing column")
+	}
+}
+
+func TestGoLiteral(t *testing.T) {
+	lit, err := Ctx(assign).Select(`issue.changelog.items[fieldId=="assignee"][0]`).
+		GoLiteral()
+	if err != nil {
+		t.Fatalf("GoLiteral failed: %s", err)
+	}
+	expected := `map[string]interface{}{
+	"fieldId": "assignee",
+	"fromString": nil,
+	"priority": 10.0,
+	"toString": "Veijo Linux",
+}`
+	if lit != expected {
+		t.Errorf("GoLiteral: got\n%s\nexpected\n%s", lit, expected)
+	}
+
+	lit, err = Ctx(assign).Select(`issue.changelog.items[]`).
+		Select("priority").GoLiteral()
+	if err != nil {
+		t.Fatalf("GoLiteral failed: %s", err)
+	}
+	expected = `[]interface{}{
+	100.0,
+	10.0,
+	10.0,
+}`
+	if lit != expected {
+		t.Errorf("GoLiteral: got\n%s\nexpected\n%s", lit, expected)
+	}
+
+	lit, err = GoLiteral(map[string]interface{}{
+		"a": []interface{}{},
+		"b": 1.5e100,
+		"c": false,
+	})
+	if err != nil {
+		t.Fatalf("GoLiteral failed: %s", err)
+	}
+	expected = `map[string]interface{}{
+	"a": []interface{}{},
+	"b": 1.5e+100,
+	"c": false,
+}`
+	if lit != expected {
+		t.Errorf("GoLiteral: got\n%s\nexpected\n%s", lit, expected)
+	}
+
+	_, err = GoLiteral(struct{}{})
+	if err == nil {
+		t.Errorf("GoLiteral accepted non-JSON value")
+	}
+}
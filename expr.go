@@ -0,0 +1,1815 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// expr is a query expression. The plain path queries are compiled
+// into the Query's path query and the other queries into expressions
+// that combine path queries.
+type expr interface {
+	// eval evaluates the expression against the value v.
+	eval(e *env, v interface{}) (interface{}, error)
+	// format appends the expression in the canonical form to sb.
+	format(sb *strings.Builder)
+	// depth returns the nesting depth of the expression.
+	depth() int
+	// selects tests if the expression selects a list of elements.
+	selects() bool
+}
+
+// exprString returns the expression in the canonical form.
+func exprString(x expr) string {
+	var sb strings.Builder
+	x.format(&sb)
+	return sb.String()
+}
+
+// pathExpr is a path query expression.
+type pathExpr struct {
+	q *query
+}
+
+func (x *pathExpr) eval(e *env, v interface{}) (interface{}, error) {
+	return x.q.eval(e, v)
+}
+
+func (x *pathExpr) format(sb *strings.Builder) {
+	sb.WriteString(x.q.format())
+}
+
+func (x *pathExpr) depth() int {
+	return x.q.depth()
+}
+
+func (x *pathExpr) selects() bool {
+	return x.q.selects()
+}
+
+// letExpr binds the value of an expression to a variable for the
+// evaluation of its body. The value is evaluated against the same
+// value as the body, that is, against the root of the query.
+type letExpr struct {
+	name  string
+	value expr
+	body  expr
+}
+
+func (x *letExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.value.eval(e, v)
+	if err == ErrorOptionalMissing {
+		val = nil
+	} else if err != nil {
+		return nil, err
+	}
+	e = e.bind(x.name, val)
+	defer e.unbind()
+
+	return x.body.eval(e, v)
+}
+
+func (x *letExpr) format(sb *strings.Builder) {
+	fmt.Fprintf(sb, "let $%s = ", x.name)
+	x.value.format(sb)
+	sb.WriteString("; ")
+	x.body.format(sb)
+}
+
+func (x *letExpr) depth() int {
+	depth := x.value.depth()
+	if d := x.body.depth(); d > depth {
+		depth = d
+	}
+	return depth
+}
+
+func (x *letExpr) selects() bool {
+	return x.body.selects()
+}
+
+// literalExpr is a literal JSON value.
+type literalExpr struct {
+	value interface{}
+}
+
+func (x *literalExpr) eval(e *env, v interface{}) (interface{}, error) {
+	return x.value, nil
+}
+
+func (x *literalExpr) format(sb *strings.Builder) {
+	switch val := x.value.(type) {
+	case string:
+		formatString(sb, val)
+
+	case float64:
+		sb.WriteString(strconv.FormatFloat(val, 'f', -1, 64))
+
+	case nil:
+		sb.WriteString("null")
+
+	default:
+		fmt.Fprintf(sb, "%v", val)
+	}
+}
+
+func (x *literalExpr) depth() int {
+	return 1
+}
+
+func (x *literalExpr) selects() bool {
+	return false
+}
+
+// varExpr is a variable reference.
+type varExpr struct {
+	name string
+}
+
+func (x *varExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, ok := e.variable(x.name)
+	if !ok {
+		return nil, fmt.Errorf("jsonq: variable $%s is not bound", x.name)
+	}
+	return val, nil
+}
+
+func (x *varExpr) format(sb *strings.Builder) {
+	sb.WriteByte('$')
+	sb.WriteString(x.name)
+}
+
+func (x *varExpr) depth() int {
+	return 1
+}
+
+func (x *varExpr) selects() bool {
+	return false
+}
+
+// condExpr is a conditional expression. The condition is a filter
+// that is evaluated against the same value as the expression; its
+// missing fields evaluate to false as in logical expressions.
+type condExpr struct {
+	cond filter
+	then expr
+	els  expr
+}
+
+func (x *condExpr) eval(e *env, v interface{}) (interface{}, error) {
+	match, err := evalOperand(e, x.cond, 0, v)
+	if err == errSkipElement {
+		match = false
+	} else if err != nil {
+		return nil, err
+	}
+	if match {
+		return x.then.eval(e, v)
+	}
+	return x.els.eval(e, v)
+}
+
+func (x *condExpr) format(sb *strings.Builder) {
+	sb.WriteString("if ")
+	formatFilter(sb, x.cond)
+	sb.WriteString(" then ")
+	x.then.format(sb)
+	for {
+		els, ok := x.els.(*condExpr)
+		if !ok {
+			break
+		}
+		x = els
+		sb.WriteString(" elif ")
+		formatFilter(sb, x.cond)
+		sb.WriteString(" then ")
+		x.then.format(sb)
+	}
+	sb.WriteString(" else ")
+	x.els.format(sb)
+	sb.WriteString(" end")
+}
+
+func (x *condExpr) depth() int {
+	depth := exprDepth(x.cond)
+	if d := x.then.depth(); d > depth {
+		depth = d
+	}
+	if d := x.els.depth(); d > depth {
+		depth = d
+	}
+	return depth + 1
+}
+
+func (x *condExpr) selects() bool {
+	return x.then.selects() || x.els.selects()
+}
+
+// binaryExpr is a binary operation. The + operator adds numbers,
+// concatenates arrays, and concatenates strings; if one of the
+// operands is a string, the other operand is converted to string.
+type binaryExpr struct {
+	op    tokenType
+	left  expr
+	right expr
+}
+
+func (x *binaryExpr) eval(e *env, v interface{}) (interface{}, error) {
+	l, err := x.left.eval(e, v)
+	if err != nil {
+		return nil, err
+	}
+	r, err := x.right.eval(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if x.op == tStar {
+		return multiply(normalize(l), normalize(r))
+	}
+	return add(normalize(l), normalize(r))
+}
+
+func (x *binaryExpr) format(sb *strings.Builder) {
+	// The operators are left-associative so the right operand needs
+	// parentheses also if it has equal precedence.
+	formatOperand(sb, x.left, precedence(x.left) < precedence(x))
+	fmt.Fprintf(sb, " %s ", x.op)
+	formatOperand(sb, x.right, precedence(x.right) <= precedence(x))
+}
+
+// formatOperand formats the operand x of a binary expression,
+// optionally in parentheses.
+func formatOperand(sb *strings.Builder, x expr, parens bool) {
+	if parens {
+		sb.WriteByte('(')
+		x.format(sb)
+		sb.WriteByte(')')
+	} else {
+		x.format(sb)
+	}
+}
+
+// precedence returns the operator precedence of the expression x. The
+// expressions other than binary expressions have the highest
+// precedence.
+func precedence(x expr) int {
+	b, ok := x.(*binaryExpr)
+	if !ok {
+		return 3
+	}
+	if b.op == tStar {
+		return 2
+	}
+	return 1
+}
+
+func (x *binaryExpr) depth() int {
+	depth := x.left.depth()
+	if d := x.right.depth(); d > depth {
+		depth = d
+	}
+	return depth + 1
+}
+
+func (x *binaryExpr) selects() bool {
+	return false
+}
+
+// add adds the values a and b.
+func add(a, b interface{}) (interface{}, error) {
+	an, aok := toNumber(a)
+	bn, bok := toNumber(b)
+	if aok && bok {
+		af, aFloat := a.(float64)
+		bf, bFloat := b.(float64)
+		if aFloat && bFloat {
+			return af + bf, nil
+		}
+		sum := new(big.Float).SetPrec(bigPrec).Add(an.bigFloat(), bn.bigFloat())
+		return json.Number(sum.Text('f', -1)), nil
+	}
+	aa, aok := a.([]interface{})
+	ba, bok := b.([]interface{})
+	if aok && bok {
+		result := make([]interface{}, 0, len(aa)+len(ba))
+		result = append(result, aa...)
+		return append(result, ba...), nil
+	}
+	_, aok = a.(string)
+	_, bok = b.(string)
+	if aok || bok {
+		as, aok := concatString(a)
+		bs, bok := concatString(b)
+		if aok && bok {
+			return as + bs, nil
+		}
+	}
+	return nil, fmt.Errorf("jsonq: can't add %s and %s", typeName(a),
+		typeName(b))
+}
+
+// multiply multiplies the numbers a and b.
+func multiply(a, b interface{}) (interface{}, error) {
+	an, aok := toNumber(a)
+	bn, bok := toNumber(b)
+	if !aok || !bok {
+		return nil, fmt.Errorf("jsonq: can't multiply %s and %s",
+			typeName(a), typeName(b))
+	}
+	af, aFloat := a.(float64)
+	bf, bFloat := b.(float64)
+	if aFloat && bFloat {
+		return af * bf, nil
+	}
+	product := new(big.Float).SetPrec(bigPrec).Mul(an.bigFloat(), bn.bigFloat())
+	return json.Number(product.Text('f', -1)), nil
+}
+
+// concatString converts the value v to string for string
+// concatenation. The null value is converted to an empty string.
+func concatString(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+
+	case nil:
+		return "", true
+
+	case bool:
+		return strconv.FormatBool(val), true
+
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+
+	case json.Number:
+		return string(val), true
+
+	default:
+		return "", false
+	}
+}
+
+// callExpr is a function call.
+type callExpr struct {
+	name string
+	fn   *function
+	args []expr
+	// pattern is the compiled literal pattern argument of match. It
+	// is passed to the function instead of the pattern string.
+	pattern *regexp.Regexp
+}
+
+func (x *callExpr) eval(e *env, v interface{}) (interface{}, error) {
+	args := make([]interface{}, len(x.args))
+	for idx, arg := range x.args {
+		if idx == 1 && x.pattern != nil {
+			args[idx] = x.pattern
+			continue
+		}
+		val, err := arg.eval(e, v)
+		if err == ErrorOptionalMissing {
+			val = nil
+		} else if err != nil {
+			return nil, err
+		}
+		args[idx] = normalize(val)
+	}
+	return x.fn.fn(args)
+}
+
+func (x *callExpr) format(sb *strings.Builder) {
+	sb.WriteString(x.name)
+	sb.WriteByte('(')
+	for idx, arg := range x.args {
+		if idx > 0 {
+			sb.WriteString(", ")
+		}
+		arg.format(sb)
+	}
+	sb.WriteByte(')')
+}
+
+func (x *callExpr) depth() int {
+	var depth int
+	for _, arg := range x.args {
+		if d := arg.depth(); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+func (x *callExpr) selects() bool {
+	return false
+}
+
+// pathsExpr returns the paths of the values that its query matches.
+type pathsExpr struct {
+	q *query
+}
+
+func (x *pathsExpr) eval(e *env, v interface{}) (interface{}, error) {
+	located, err := x.q.locatePaths(e, v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, len(located))
+	for idx, l := range located {
+		result[idx] = l.path
+	}
+	return result, nil
+}
+
+func (x *pathsExpr) format(sb *strings.Builder) {
+	sb.WriteString("path(")
+	sb.WriteString(x.q.format())
+	sb.WriteByte(')')
+}
+
+func (x *pathsExpr) depth() int {
+	return x.q.depth() + 1
+}
+
+func (x *pathsExpr) selects() bool {
+	return true
+}
+
+// quantExpr tests if the condition matches any or all elements of
+// the array value of the expression x. The condition's missing fields
+// evaluate to false as in logical expressions. The null and missing
+// optional values are empty arrays.
+type quantExpr struct {
+	x    expr
+	cond filter
+	all  bool
+}
+
+func (x *quantExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.x.eval(e, v)
+	if err != nil && err != ErrorOptionalMissing {
+		return nil, err
+	}
+	var items []interface{}
+	if val != nil {
+		var ok bool
+		items, ok = arrayValue(val)
+		if !ok {
+			return nil, fmt.Errorf("jsonq: %s: %s is not an array",
+				exprString(x), typeName(val))
+		}
+	}
+	for idx, item := range items {
+		match, err := evalOperand(e, x.cond, idx, item)
+		if err == errSkipElement {
+			match = false
+		} else if err != nil {
+			return nil, err
+		}
+		if match != x.all {
+			return match, nil
+		}
+	}
+	return x.all, nil
+}
+
+func (x *quantExpr) format(sb *strings.Builder) {
+	if x.all {
+		sb.WriteString("all(")
+	} else {
+		sb.WriteString("any(")
+	}
+	x.x.format(sb)
+	sb.WriteString(", ")
+	formatFilter(sb, x.cond)
+	sb.WriteByte(')')
+}
+
+func (x *quantExpr) depth() int {
+	depth := exprDepth(x.cond)
+	if d := x.x.depth(); d > depth {
+		depth = d
+	}
+	return depth + 1
+}
+
+func (x *quantExpr) selects() bool {
+	return false
+}
+
+// reduceExpr folds the elements of the array value of the expression
+// x into an accumulator value. The seed is evaluated against the
+// current value and the update expression against each element, with
+// the accumulator variable bound to the accumulated value. The null
+// and missing optional values are empty arrays.
+type reduceExpr struct {
+	x      expr
+	name   string
+	seed   expr
+	update expr
+}
+
+func (x *reduceExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.x.eval(e, v)
+	if err != nil && err != ErrorOptionalMissing {
+		return nil, err
+	}
+	var items []interface{}
+	if val != nil {
+		var ok bool
+		items, ok = arrayValue(val)
+		if !ok {
+			return nil, fmt.Errorf("jsonq: %s: %s is not an array",
+				exprString(x), typeName(val))
+		}
+	}
+	acc, err := x.seed.eval(e, v)
+	if err == ErrorOptionalMissing {
+		acc = nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		err = e.check()
+		if err != nil {
+			return nil, err
+		}
+		e = e.bind(x.name, normalize(acc))
+		acc, err = x.update.eval(e, item)
+		e.unbind()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return normalize(acc), nil
+}
+
+func (x *reduceExpr) format(sb *strings.Builder) {
+	sb.WriteString("reduce(")
+	x.x.format(sb)
+	fmt.Fprintf(sb, ", $%s = ", x.name)
+	x.seed.format(sb)
+	sb.WriteString(", ")
+	x.update.format(sb)
+	sb.WriteByte(')')
+}
+
+func (x *reduceExpr) depth() int {
+	depth := x.x.depth()
+	if d := x.seed.depth(); d > depth {
+		depth = d
+	}
+	if d := x.update.depth(); d > depth {
+		depth = d
+	}
+	return depth + 1
+}
+
+func (x *reduceExpr) selects() bool {
+	return false
+}
+
+// zipExpr pairs the elements of its array arguments into objects. The
+// arrays must have equal lengths.
+type zipExpr struct {
+	keys []string
+	args []expr
+}
+
+func (x *zipExpr) eval(e *env, v interface{}) (interface{}, error) {
+	columns := make([][]interface{}, len(x.args))
+	for idx, arg := range x.args {
+		val, err := arg.eval(e, v)
+		if err != nil {
+			return nil, err
+		}
+		column, ok := arrayValue(normalize(val))
+		if !ok {
+			return nil, fmt.Errorf("jsonq: zip: argument %s is %s, expected array",
+				exprString(arg), typeName(val))
+		}
+		if idx > 0 && len(column) != len(columns[0]) {
+			return nil, fmt.Errorf("jsonq: zip: arrays have different lengths %d and %d",
+				len(columns[0]), len(column))
+		}
+		columns[idx] = column
+	}
+	result := make([]interface{}, len(columns[0]))
+	for row := range result {
+		obj := make(map[string]interface{}, len(x.keys))
+		for idx, key := range x.keys {
+			obj[key] = columns[idx][row]
+		}
+		result[row] = obj
+	}
+	return result, nil
+}
+
+func (x *zipExpr) format(sb *strings.Builder) {
+	sb.WriteString("zip(")
+	for idx, arg := range x.args {
+		if idx > 0 {
+			sb.WriteString(", ")
+		}
+		arg.format(sb)
+	}
+	sb.WriteByte(')')
+}
+
+func (x *zipExpr) depth() int {
+	var depth int
+	for _, arg := range x.args {
+		if d := arg.depth(); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+func (x *zipExpr) selects() bool {
+	return true
+}
+
+// filterExpr selects the elements of the array value of the
+// expression x that match the filter. The values that are not arrays
+// are filtered as single elements.
+type filterExpr struct {
+	x expr
+	f filter
+}
+
+func (x *filterExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.x.eval(e, v)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := arrayValue(normalize(val))
+	if !ok {
+		items = []interface{}{val}
+	}
+	result := []interface{}{}
+	for idx, item := range items {
+		match, err := e.evalFilter(x.f, idx, item)
+		if err == errSkipElement {
+			continue
+		}
+		if err != nil {
+			return nil, &FilterError{
+				Query: exprString(x),
+				Index: idx,
+				Err:   err,
+			}
+		}
+		if match {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (x *filterExpr) format(sb *strings.Builder) {
+	x.x.format(sb)
+	sb.WriteByte('[')
+	formatFilter(sb, x.f)
+	sb.WriteByte(']')
+}
+
+func (x *filterExpr) depth() int {
+	depth := x.x.depth()
+	if d := exprDepth(x.f); d > depth {
+		depth = d
+	}
+	return depth + 1
+}
+
+func (x *filterExpr) selects() bool {
+	return true
+}
+
+// subpathExpr evaluates the path query against the value of the
+// expression x. If x selects a list of elements, the query is
+// evaluated for each element and the results are flattened.
+type subpathExpr struct {
+	x expr
+	q *query
+}
+
+func (x *subpathExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.x.eval(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if !x.x.selects() {
+		return x.q.eval(e, val)
+	}
+	var result []interface{}
+	for _, item := range val.([]interface{}) {
+		r, err := x.q.eval(e, item)
+		if err == ErrorOptionalMissing {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if x.q.selects() {
+			result = append(result, r.([]interface{})...)
+		} else {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (x *subpathExpr) format(sb *strings.Builder) {
+	x.x.format(sb)
+	sb.WriteByte('.')
+	sb.WriteString(x.q.format())
+}
+
+func (x *subpathExpr) depth() int {
+	return x.x.depth() + x.q.depth()
+}
+
+func (x *subpathExpr) selects() bool {
+	return x.x.selects() || x.q.selects()
+}
+
+// extremeExpr selects the element of an array with the maximum or the
+// minimum key value. The keys are compared as in Context.Sort and the
+// first of the equal elements is selected. The empty arrays select
+// null.
+type extremeExpr struct {
+	x   expr
+	key expr
+	max bool
+}
+
+func (x *extremeExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.x.eval(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, nil
+	}
+	items, ok := arrayValue(val)
+	if !ok {
+		return nil, fmt.Errorf("jsonq: %s: can't select from %s",
+			exprString(x), typeName(val))
+	}
+	var result, best interface{}
+	for idx, item := range items {
+		key, err := x.key.eval(e, item)
+		if err == ErrorOptionalMissing {
+			key = nil
+		} else if err != nil {
+			return nil, err
+		}
+		key = normalize(key)
+		if idx > 0 {
+			cmp := compareValues(key, best)
+			if x.max && cmp <= 0 || !x.max && cmp >= 0 {
+				continue
+			}
+		}
+		result = item
+		best = key
+	}
+	return result, nil
+}
+
+func (x *extremeExpr) format(sb *strings.Builder) {
+	x.x.format(sb)
+	if x.max {
+		sb.WriteString(".max_by(")
+	} else {
+		sb.WriteString(".min_by(")
+	}
+	x.key.format(sb)
+	sb.WriteByte(')')
+}
+
+func (x *extremeExpr) depth() int {
+	d := x.x.depth()
+	if kd := x.key.depth(); kd > d {
+		d = kd
+	}
+	return d + 1
+}
+
+func (x *extremeExpr) selects() bool {
+	return false
+}
+
+// objectExpr constructs an object from the values of its
+// expressions. The optional values that are missing are null.
+type objectExpr struct {
+	keys   []string
+	values []expr
+}
+
+func (x *objectExpr) eval(e *env, v interface{}) (interface{}, error) {
+	result := make(map[string]interface{}, len(x.keys))
+	for idx, value := range x.values {
+		val, err := value.eval(e, v)
+		if err == ErrorOptionalMissing {
+			val = nil
+		} else if err != nil {
+			return nil, err
+		}
+		result[x.keys[idx]] = normalize(val)
+	}
+	return result, nil
+}
+
+func (x *objectExpr) format(sb *strings.Builder) {
+	sb.WriteByte('{')
+	for idx, key := range x.keys {
+		if idx > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(formatKey(key))
+		sb.WriteString(": ")
+		x.values[idx].format(sb)
+	}
+	sb.WriteByte('}')
+}
+
+func (x *objectExpr) depth() int {
+	var depth int
+	for _, value := range x.values {
+		if d := value.depth(); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+func (x *objectExpr) selects() bool {
+	return false
+}
+
+// arrayExpr constructs an array from the values of its expressions.
+// The optional values that are missing are null.
+type arrayExpr struct {
+	elements []expr
+}
+
+func (x *arrayExpr) eval(e *env, v interface{}) (interface{}, error) {
+	result := make([]interface{}, len(x.elements))
+	for idx, elem := range x.elements {
+		val, err := elem.eval(e, v)
+		if err == ErrorOptionalMissing {
+			val = nil
+		} else if err != nil {
+			return nil, err
+		}
+		result[idx] = normalize(val)
+	}
+	return result, nil
+}
+
+func (x *arrayExpr) format(sb *strings.Builder) {
+	sb.WriteByte('[')
+	for idx, elem := range x.elements {
+		if idx > 0 {
+			sb.WriteString(", ")
+		}
+		elem.format(sb)
+	}
+	sb.WriteByte(']')
+}
+
+func (x *arrayExpr) depth() int {
+	var depth int
+	for _, elem := range x.elements {
+		if d := elem.depth(); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+func (x *arrayExpr) selects() bool {
+	return false
+}
+
+// indexExpr selects an element of an array or a character of a
+// string. The indices out of range select null.
+type indexExpr struct {
+	x     expr
+	index int
+}
+
+func (x *indexExpr) eval(e *env, v interface{}) (interface{}, error) {
+	val, err := x.x.eval(e, v)
+	if err != nil {
+		return nil, err
+	}
+	switch val := normalize(val).(type) {
+	case []interface{}:
+		if x.index >= len(val) {
+			return nil, nil
+		}
+		return val[x.index], nil
+
+	case string:
+		runes := []rune(val)
+		if x.index >= len(runes) {
+			return nil, nil
+		}
+		return string(runes[x.index]), nil
+
+	case nil:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("jsonq: %s: can't index %s", exprString(x),
+			typeName(val))
+	}
+}
+
+func (x *indexExpr) format(sb *strings.Builder) {
+	x.x.format(sb)
+	fmt.Fprintf(sb, "[%d]", x.index)
+}
+
+func (x *indexExpr) depth() int {
+	return x.x.depth() + 1
+}
+
+func (x *indexExpr) selects() bool {
+	return false
+}
+
+// scope is a variable binding of the evaluation environment. The
+// scopes are linked from the innermost binding outwards so that the
+// inner bindings shadow the outer ones.
+type scope struct {
+	name  string
+	value interface{}
+	next  *scope
+}
+
+// bind binds the variable name to the value. It returns the
+// environment holding the binding; the binding is removed with
+// unbind when its expression is evaluated. The nil environment is
+// replaced with a new environment.
+func (e *env) bind(name string, value interface{}) *env {
+	if e == nil {
+		e = new(env)
+	}
+	e.vars = &scope{
+		name:  name,
+		value: value,
+		next:  e.vars,
+	}
+	return e
+}
+
+// unbind removes the innermost variable binding.
+func (e *env) unbind() {
+	e.vars = e.vars.next
+}
+
+// variable returns the value of the variable name.
+func (e *env) variable(name string) (interface{}, bool) {
+	if e == nil {
+		return nil, false
+	}
+	for s := e.vars; s != nil; s = s.next {
+		if s.name == name {
+			return s.value, true
+		}
+	}
+	return nil, false
+}
+
+// parseProgram parses the query string q into an expression.
+func parseProgram(q string) (expr, error) {
+	err := checkLength(q)
+	if err != nil {
+		return nil, err
+	}
+	lexer := newLexer(q)
+	x, err := parseLet(lexer)
+	if err != nil {
+		return nil, err
+	}
+	_, err = lexer.Get()
+	if err == nil {
+		for {
+			l, ok := x.(*letExpr)
+			if !ok {
+				break
+			}
+			x = l.body
+		}
+		return nil, lexer.SyntaxError(expectedAfter(x, "end of query"))
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	err = checkComplexity(lexer.complexity())
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// expectedAfter returns the syntax error hint for the input following
+// the expression x when the expression must be followed by end.
+func expectedAfter(x expr, end string) string {
+	p, ok := x.(*pathExpr)
+	if ok && len(p.q.typ) == 0 {
+		return "'.', '[', '::', or " + end
+	}
+	return end
+}
+
+// parseLet parses an expression with optional let bindings:
+//
+//	let $pid = issue.fields.project.id; items[projectId == $pid]
+//
+// The let keyword is a key if it is not followed by a variable.
+func parseLet(lexer *lexer) (expr, error) {
+	saved := *lexer
+	t, err := lexer.Expect("key")
+	if err != nil {
+		return nil, err
+	}
+	if t.is(keyword("let")) {
+		t, err = lexer.Get()
+		if err == nil && t.Type == tVariable {
+			return parseBinding(lexer, t.StrVal)
+		}
+	}
+	*lexer = saved
+
+	return parseExpression(lexer, true)
+}
+
+// parseBinding parses the value and the body of the let binding of
+// the variable name.
+func parseBinding(lexer *lexer, name string) (expr, error) {
+	t, err := lexer.Expect("'='")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tAssign {
+		return nil, lexer.SyntaxError("'='")
+	}
+	value, err := parseExpression(lexer, true)
+	if err != nil {
+		return nil, err
+	}
+	t, err = lexer.Expect("';'")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tSemicolon {
+		return nil, lexer.SyntaxError(expectedAfter(value, "';'"))
+	}
+	lexer.vars = append(lexer.vars, name)
+	body, err := parseLet(lexer)
+	if err != nil {
+		return nil, err
+	}
+	return &letExpr{
+		name:  name,
+		value: value,
+		body:  body,
+	}, nil
+}
+
+// parseExpression parses an expression. At the top level of the
+// query, a quoted string, an integer, or the null, true, or false
+// keyword alone is a path query so that the single-key queries keep
+// their meaning. Otherwise they are literals unless followed by a path
+// continuation.
+func parseExpression(lexer *lexer, top bool) (expr, error) {
+	return parseBinary(lexer, top, tPlus)
+}
+
+// parseBinary parses the left-associative binary operations of the
+// operator op and of the operators with higher precedence. The '*'
+// operator has higher precedence than '+'.
+func parseBinary(lexer *lexer, top bool, op tokenType) (expr, error) {
+	operand := func(top bool) (expr, error) {
+		if op == tPlus {
+			return parseBinary(lexer, top, tStar)
+		}
+		return parsePrimary(lexer, top)
+	}
+	left, err := operand(top)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := lexer.Get()
+		if err != nil {
+			if err == io.EOF {
+				return left, nil
+			}
+			return nil, err
+		}
+		if t.Type != op {
+			lexer.Unget(t)
+			return left, nil
+		}
+		right, err := operand(false)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{
+			op:    t.Type,
+			left:  left,
+			right: right,
+		}
+	}
+}
+
+// parsePrimary parses a path, a literal, a variable, a conditional,
+// or a parenthesized expression.
+func parsePrimary(lexer *lexer, top bool) (expr, error) {
+	saved := *lexer
+	t, err := lexer.Expect("expression")
+	if err != nil {
+		return nil, err
+	}
+	switch t.Type {
+	case tVariable:
+		if !lexer.Defined(t.StrVal) {
+			return nil, lexer.SyntaxError("defined variable")
+		}
+		return parsePostfix(lexer, &varExpr{
+			name: t.StrVal,
+		})
+
+	case tInt:
+		if continuesPath(lexer, top) {
+			break
+		}
+		lit := &literalExpr{
+			value: float64(t.Int),
+		}
+		if t.Big != nil {
+			lit.value = json.Number(t.Big.String())
+		}
+		return lit, nil
+
+	case tLBrace:
+		return parseObject(lexer)
+
+	case tLBracket:
+		return parseArray(lexer)
+
+	case tLParen:
+		err = lexer.Nest()
+		if err != nil {
+			return nil, err
+		}
+		defer lexer.Unnest()
+		x, err := parseExpression(lexer, false)
+		if err != nil {
+			return nil, err
+		}
+		t, err = lexer.Expect("')'")
+		if err != nil {
+			return nil, err
+		}
+		if t.Type != tRParen {
+			return nil, lexer.SyntaxError(expectedAfter(x, "')'"))
+		}
+		return parsePostfix(lexer, x)
+
+	case tString:
+		if t.Quoted {
+			if continuesPath(lexer, top) {
+				break
+			}
+			return &literalExpr{
+				value: t.StrVal,
+			}, nil
+		}
+		if isCall(lexer) {
+			return parseCall(lexer, t.StrVal)
+		}
+		switch t.StrVal {
+		case "null", "true", "false":
+			if continuesPath(lexer, top) {
+				break
+			}
+			var value interface{}
+			if t.StrVal != "null" {
+				value = t.StrVal == "true"
+			}
+			return &literalExpr{
+				value: value,
+			}, nil
+
+		case "if":
+			if continuesPath(lexer, true) {
+				break
+			}
+			return parseConditional(lexer)
+		}
+	}
+	*lexer = saved
+
+	q, err := parsePath(lexer)
+	if err != nil {
+		return nil, err
+	}
+	x := &pathExpr{
+		q: q,
+	}
+	if len(q.typ) > 0 {
+		return x, nil
+	}
+	return parsePostfix(lexer, x)
+}
+
+// continuesPath tests if the input continues as a path query after
+// the current token, that is, if the next token is '.', '[', or '::'.
+// At the top level, the end of the query also continues the path.
+func continuesPath(lexer *lexer, top bool) bool {
+	t, err := lexer.Get()
+	if err != nil {
+		return top && err == io.EOF
+	}
+	lexer.Unget(t)
+	switch t.Type {
+	case tDot, tLBracket, tColonColon:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// isCall tests if the current identifier token starts a function
+// call, that is, if the next token is '('.
+func isCall(lexer *lexer) bool {
+	t, err := lexer.Get()
+	if err != nil {
+		return false
+	}
+	lexer.Unget(t)
+	return t.Type == tLParen
+}
+
+// parseCall parses the arguments of the call of the function name.
+// The '(' token starts the argument list.
+func parseCall(lexer *lexer, name string) (expr, error) {
+	lexer.calls++
+	switch name {
+	case "path":
+		return parsePathCall(lexer)
+
+	case "any", "all":
+		return parseQuantifier(lexer, name == "all")
+
+	case "reduce":
+		return parseReduce(lexer)
+	}
+	var fn *function
+	if name != "zip" {
+		var ok bool
+		fn, ok = functions[name]
+		if !ok {
+			return nil, fmt.Errorf("jsonq: unknown function %s", name)
+		}
+	}
+	args, err := parseArgs(lexer)
+	if err != nil {
+		return nil, err
+	}
+	if fn == nil {
+		return parseZip(lexer, args)
+	}
+	if len(args) < fn.minArgs || len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("jsonq: %s: invalid number of arguments: %d",
+			name, len(args))
+	}
+	call := &callExpr{
+		name: name,
+		fn:   fn,
+		args: args,
+	}
+	if name == "match" {
+		call.pattern, err = literalPattern(args[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parsePostfix(lexer, call)
+}
+
+// parseArgs parses the arguments of a function call. The '(' token
+// starts the argument list.
+func parseArgs(lexer *lexer) ([]expr, error) {
+	_, err := lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	err = lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	var args []expr
+	t, err := lexer.Expect("argument or ')'")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == tRParen {
+		return args, nil
+	}
+	lexer.Unget(t)
+	for {
+		arg, err := parseExpression(lexer, false)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		expected := expectedAfter(arg, "',' or ')'")
+		t, err = lexer.Expect(expected)
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == tRParen {
+			return args, nil
+		}
+		if t.Type != tComma {
+			return nil, lexer.SyntaxError(expected)
+		}
+	}
+}
+
+// parseZip creates the zip expression for the arguments. The keys of
+// the zipped objects are the last keys of the path arguments and the
+// zero-based positions of the other arguments.
+func parseZip(lexer *lexer, args []expr) (expr, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("jsonq: zip: invalid number of arguments: %d",
+			len(args))
+	}
+	zip := &zipExpr{
+		args: args,
+	}
+	for idx, arg := range args {
+		key := strconv.Itoa(idx)
+		if p, ok := arg.(*pathExpr); ok {
+			key = p.q.key
+		}
+		for _, k := range zip.keys {
+			if k == key {
+				return nil, fmt.Errorf("jsonq: zip: duplicate key %q", key)
+			}
+		}
+		zip.keys = append(zip.keys, key)
+	}
+	return parsePostfix(lexer, zip)
+}
+
+// parseObject parses the object construction following the '{'
+// token:
+//
+//	{key: issue.key, to: items[fieldId == "assignee"].toString}
+func parseObject(lexer *lexer) (expr, error) {
+	err := lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	obj := new(objectExpr)
+	t, err := lexer.Expect("key or '}'")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == tRBrace {
+		return obj, nil
+	}
+	for {
+		if t.Type != tString {
+			return nil, lexer.SyntaxError("key")
+		}
+		for _, key := range obj.keys {
+			if key == t.StrVal {
+				return nil, fmt.Errorf("jsonq: duplicate object key %q", key)
+			}
+		}
+		obj.keys = append(obj.keys, t.StrVal)
+
+		t, err = lexer.Expect("':'")
+		if err != nil {
+			return nil, err
+		}
+		if t.Type != tColon {
+			return nil, lexer.SyntaxError("':'")
+		}
+		value, err := parseExpression(lexer, false)
+		if err != nil {
+			return nil, err
+		}
+		obj.values = append(obj.values, value)
+
+		expected := expectedAfter(value, "',' or '}'")
+		t, err = lexer.Expect(expected)
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == tRBrace {
+			return obj, nil
+		}
+		if t.Type != tComma {
+			return nil, lexer.SyntaxError(expected)
+		}
+		t, err = lexer.Expect("key")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseArray parses the array construction following the '[' token:
+//
+//	[issue.key, issue.fields.summary]
+func parseArray(lexer *lexer) (expr, error) {
+	err := lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	arr := new(arrayExpr)
+	t, err := lexer.Expect("element or ']'")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tRBracket {
+		lexer.Unget(t)
+		for {
+			elem, err := parseExpression(lexer, false)
+			if err != nil {
+				return nil, err
+			}
+			arr.elements = append(arr.elements, elem)
+
+			expected := expectedAfter(elem, "',' or ']'")
+			t, err = lexer.Expect(expected)
+			if err != nil {
+				return nil, err
+			}
+			if t.Type == tRBracket {
+				break
+			}
+			if t.Type != tComma {
+				return nil, lexer.SyntaxError(expected)
+			}
+		}
+	}
+	return parsePostfix(lexer, arr)
+}
+
+// parsePathCall parses the path function call. The argument of the
+// path function is a path query, not an expression.
+func parsePathCall(lexer *lexer) (expr, error) {
+	_, err := lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	err = lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	q, err := parsePath(lexer)
+	if err != nil {
+		return nil, err
+	}
+	x := &pathsExpr{
+		q: q,
+	}
+	expected := expectedAfter(&pathExpr{q: q}, "')'")
+	t, err := lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tRParen {
+		return nil, lexer.SyntaxError(expected)
+	}
+	return parsePostfix(lexer, x)
+}
+
+// parseQuantifier parses the arguments of the any and all
+// quantifiers. The first argument is an expression and the second
+// argument is a filter:
+//
+//	any(changelog.items, fieldId == "assignee")
+func parseQuantifier(lexer *lexer, all bool) (expr, error) {
+	_, err := lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	err = lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	x, err := parseExpression(lexer, false)
+	if err != nil {
+		return nil, err
+	}
+	expected := expectedAfter(x, "','")
+	t, err := lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tComma {
+		return nil, lexer.SyntaxError(expected)
+	}
+	cond, err := parseExpr(lexer, token{Type: tRParen})
+	if err != nil {
+		return nil, err
+	}
+	return parsePostfix(lexer, &quantExpr{
+		x:    x,
+		cond: cond,
+		all:  all,
+	})
+}
+
+// parseReduce parses the arguments of the reduce operator. The
+// arguments are the array expression, the accumulator variable with
+// its seed value, and the update expression:
+//
+//	reduce(items, $sum = 0, $sum + priority * weight)
+//
+// The accumulator variable is defined only in the update expression.
+func parseReduce(lexer *lexer) (expr, error) {
+	_, err := lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	err = lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	x, err := parseExpression(lexer, false)
+	if err != nil {
+		return nil, err
+	}
+	expected := expectedAfter(x, "','")
+	t, err := lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tComma {
+		return nil, lexer.SyntaxError(expected)
+	}
+	t, err = lexer.Expect("variable")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tVariable {
+		return nil, lexer.SyntaxError("variable")
+	}
+	name := t.StrVal
+	t, err = lexer.Expect("'='")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tAssign {
+		return nil, lexer.SyntaxError("'='")
+	}
+	seed, err := parseExpression(lexer, false)
+	if err != nil {
+		return nil, err
+	}
+	expected = expectedAfter(seed, "','")
+	t, err = lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tComma {
+		return nil, lexer.SyntaxError(expected)
+	}
+
+	vars := lexer.vars
+	lexer.vars = append(lexer.vars[:len(vars):len(vars)], name)
+	update, err := parseExpression(lexer, false)
+	lexer.vars = vars
+	if err != nil {
+		return nil, err
+	}
+	expected = expectedAfter(update, "')'")
+	t, err = lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tRParen {
+		return nil, lexer.SyntaxError(expected)
+	}
+	return parsePostfix(lexer, &reduceExpr{
+		x:      x,
+		name:   name,
+		seed:   seed,
+		update: update,
+	})
+}
+
+// parsePostfix parses the index operations, the selector calls, and
+// the paths following the expression x, for example:
+//
+//	split(key, "-")[0]
+//	items.max_by(priority).key
+func parsePostfix(lexer *lexer, x expr) (expr, error) {
+	for {
+		t, err := lexer.Get()
+		if err != nil {
+			if err == io.EOF {
+				return x, nil
+			}
+			return nil, err
+		}
+		switch t.Type {
+		case tLBracket:
+			x, err = parseIndex(lexer, x)
+
+		case tDot:
+			x, err = parseSelector(lexer, x)
+
+		default:
+			lexer.Unget(t)
+			return x, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseIndex parses the index or the filter following the '['
+// token. The index selects an element and the filter selects the
+// list of matching elements.
+func parseIndex(lexer *lexer, x expr) (expr, error) {
+	f, err := parseLogical(lexer)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := f.(*comparative)
+	if ok && c.Op == tInt {
+		return &indexExpr{
+			x:     x,
+			index: c.Left.IntVal,
+		}, nil
+	}
+	lexer.filters++
+	return &filterExpr{
+		x: x,
+		f: f,
+	}, nil
+}
+
+// parseSelector parses the selector call or the path following the
+// '.' token.
+func parseSelector(lexer *lexer, x expr) (expr, error) {
+	t, err := lexer.Expect("key")
+	if err != nil {
+		return nil, err
+	}
+	if !isSelector(lexer, t) {
+		lexer.Unget(t)
+		q, err := parsePath(lexer)
+		if err != nil {
+			return nil, err
+		}
+		return &subpathExpr{
+			x: x,
+			q: q,
+		}, nil
+	}
+	_, err = lexer.Get()
+	if err != nil {
+		return nil, err
+	}
+	lexer.calls++
+	err = lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	key, err := parseExpression(lexer, false)
+	if err != nil {
+		return nil, err
+	}
+	expected := expectedAfter(key, "')'")
+	t2, err := lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	if t2.Type != tRParen {
+		return nil, lexer.SyntaxError(expected)
+	}
+	return &extremeExpr{
+		x:   x,
+		key: key,
+		max: t.StrVal == "max_by",
+	}, nil
+}
+
+// isSelector tests if the token t starts a selector call, that is, if
+// it is an unquoted selector name followed by '('.
+func isSelector(lexer *lexer, t token) bool {
+	if t.Type != tString || t.Quoted {
+		return false
+	}
+	switch t.StrVal {
+	case "max_by", "min_by":
+		return isCall(lexer)
+
+	default:
+		return false
+	}
+}
+
+// parseConditional parses the conditional expression following the
+// if keyword:
+//
+//	if toString == null then "unassigned" else toString end
+//
+// The condition has the filter syntax and it is evaluated against the
+// same value as the conditional expression. The left operands of the
+// comparisons can be paths, for example, fields.count > 10. The elif
+// keyword starts a nested conditional in the else branch.
+func parseConditional(lexer *lexer) (expr, error) {
+	err := lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	cond, err := parseExpr(lexer, keyword("then"))
+	if err != nil {
+		return nil, err
+	}
+	then, err := parseExpression(lexer, false)
+	if err != nil {
+		return nil, err
+	}
+	expected := expectedAfter(then, "'elif' or 'else'")
+	t, err := lexer.Expect(expected)
+	if err != nil {
+		return nil, err
+	}
+	var els expr
+	switch {
+	case t.is(keyword("elif")):
+		els, err = parseConditional(lexer)
+		if err != nil {
+			return nil, err
+		}
+
+	case t.is(keyword("else")):
+		els, err = parseExpression(lexer, false)
+		if err != nil {
+			return nil, err
+		}
+		expected = expectedAfter(els, "'end'")
+		t, err = lexer.Expect(expected)
+		if err != nil {
+			return nil, err
+		}
+		if !t.is(keyword("end")) {
+			return nil, lexer.SyntaxError(expected)
+		}
+
+	default:
+		return nil, lexer.SyntaxError(expected)
+	}
+	return &condExpr{
+		cond: cond,
+		then: then,
+		els:  els,
+	}, nil
+}
@@ -0,0 +1,570 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"strings"
+	"testing"
+)
+
+var projects = `{
+    "issue": {
+        "key": "OP-1",
+        "fields": {
+            "project": {"id": 10, "name": "Operations"}
+        }
+    },
+    "projects": [
+        {"id": 9, "name": "Development"},
+        {"id": 10, "name": "Operations"}
+    ],
+    "items": [
+        {"projectId": 10, "key": "OP-2", "lead": null},
+        {"projectId": 9, "key": "DEV-1", "lead": "Bill Lumbergh"},
+        {"projectId": 10, "key": "OP-3", "lead": "Milton Waddams"}
+    ],
+    "let": {"x": 1}
+}`
+
+func TestLet(t *testing.T) {
+	keys, err := Ctx(projects).
+		Select(`let $pid = issue.fields.project.id; items[projectId==$pid]`).
+		Select("key").
+		Strings()
+	if err != nil {
+		t.Fatalf("let failed: %s", err)
+	}
+	if len(keys) != 2 || keys[0] != "OP-2" || keys[1] != "OP-3" {
+		t.Errorf("unexpected let result: %v", keys)
+	}
+
+	names, err := Ctx(projects).
+		Select(`let $pid = issue.fields.project.id;
+let $name = issue.fields.project.name;
+projects[id!=$pid || name!=$name].name`).
+		Strings()
+	if err != nil {
+		t.Fatalf("multiple lets failed: %s", err)
+	}
+	if len(names) != 1 || names[0] != "Development" {
+		t.Errorf("unexpected multiple let result: %v", names)
+	}
+
+	_, err = Get(unmarshal(t, projects),
+		`let $p = issue.fields.project; items[projectId==$p]`)
+	if err == nil {
+		t.Errorf("object variable compared to number")
+	}
+
+	n, err := Ctx(projects).
+		Select(`let $lead = issue.?lead; items[lead==$lead]`).
+		Count()
+	if err != nil {
+		t.Fatalf("null let failed: %s", err)
+	}
+	if n != 1 {
+		t.Errorf("unexpected null let count: %d", n)
+	}
+
+	x, err := GetInt(unmarshal(t, projects), "let.x")
+	if err != nil {
+		t.Fatalf("let key failed: %s", err)
+	}
+	if x != 1 {
+		t.Errorf("unexpected let key value: %d", x)
+	}
+
+	q, err := Compile(`let $pid = issue.fields.project.id; items[projectId==$pid]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	it := q.Iter(unmarshal(t, projects))
+	var count int
+	for _, ok := it.Next(); ok; _, ok = it.Next() {
+		count++
+	}
+	if it.Err() != nil || count != 2 {
+		t.Errorf("unexpected Iter result: %d, %v", count, it.Err())
+	}
+	err = q.Set(unmarshal(t, projects), 1)
+	if err == nil {
+		t.Errorf("Set accepted let query")
+	}
+}
+
+var letFormatTests = []struct {
+	q   string
+	out string
+}{
+	{
+		q:   `let $a=x;y[z==$a]`,
+		out: `let $a = x; y[z == $a]`,
+	},
+	{
+		q:   `let $a = x::int; let $b = y[n>$a][0].m; z[m!=$b && n==$a]`,
+		out: `let $a = x::int; let $b = y[n > $a][0].m; z[m != $b && n == $a]`,
+	},
+}
+
+func TestLetFormat(t *testing.T) {
+	for _, test := range letFormatTests {
+		out, err := Format(test.q)
+		if err != nil {
+			t.Fatalf("Format(%s) failed: %s", test.q, err)
+		}
+		if out != test.out {
+			t.Errorf("Format(%s): got %s, expected %s", test.q, out, test.out)
+		}
+	}
+	for _, q := range []string{
+		`items[id==$a]`,
+		`let $a = x; items[id==$b]`,
+		`let $a = x y`,
+		`let $a = x`,
+		`items[$a==1]`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	leads, err := Ctx(projects).
+		Select("items").
+		Select(`if lead == null then "unassigned" else lead end`).
+		Strings()
+	if err != nil {
+		t.Fatalf("conditional failed: %s", err)
+	}
+	if len(leads) != 3 || leads[0] != "unassigned" ||
+		leads[1] != "Bill Lumbergh" || leads[2] != "Milton Waddams" {
+		t.Errorf("unexpected conditional result: %v", leads)
+	}
+
+	names, err := Ctx(projects).
+		Select("items").
+		Select(`if projectId == 9 then "dev" elif projectId == 10 then "ops"
+else "other" end`).
+		Strings()
+	if err != nil {
+		t.Fatalf("elif failed: %s", err)
+	}
+	if len(names) != 3 || names[0] != "ops" || names[1] != "dev" {
+		t.Errorf("unexpected elif result: %v", names)
+	}
+
+	v := unmarshal(t, `{"if": {"x": 1}, "a": {"b": true, "n": 12}}`)
+	for q, expected := range map[string]interface{}{
+		`if.x`: 1.0,
+
+		`if a.n > 10 then "big" else "small" end`:     "big",
+		`if a.n > 20 then "big" else "small" end`:     "small",
+		`if a.x > 10 then "big" else "small" end`:     "small",
+		`if a.b && if.x == 1 then 1 else 0 end`:       1.0,
+		`if "a.b" then if.x else 2 end`:               1.0,
+		`if "a.c" then 1 else (false) end`:            false,
+		`if "a.b" && "a.c" == 1 then 1 else null end`: nil,
+		`let $x = if.x; if "a.b" then $x else 0 end`:  1.0,
+	} {
+		val, err := Get(v, q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", q, err)
+			continue
+		}
+		if val != expected {
+			t.Errorf("Get(%s): got %v, expected %v", q, val, expected)
+		}
+	}
+
+	items := unmarshal(t, `{"items": [{"a": {"b": 1}}, {"a": {"b": 2}}]}`)
+	n, err := Ctx(items).Select("items[a.b == 2]").Count()
+	if err != nil || n != 1 {
+		t.Errorf("path filter: got %d, %v", n, err)
+	}
+
+	n, err = Ctx(projects).Select("items[lead]").Count()
+	if err != nil {
+		t.Fatalf("field filter failed: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("unexpected field filter count: %d", n)
+	}
+
+	out, err := Format(`if a==null then "x" else if b then 1 else c.d end end`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	expected := `if a == null then "x" elif b then 1 else c.d end`
+	if out != expected {
+		t.Errorf("Format: got %s, expected %s", out, expected)
+	}
+	for _, q := range []string{
+		`if a then b`,
+		`if a then b else c`,
+		`if a then b else c end d`,
+		`if a b then c else d end`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	titles, err := Ctx(projects).
+		Select("items").
+		Select(`key + " — " + if lead then lead else "nobody" end`).
+		Strings()
+	if err != nil {
+		t.Fatalf("concatenation failed: %s", err)
+	}
+	if len(titles) != 3 || titles[0] != "OP-2 — nobody" ||
+		titles[1] != "DEV-1 — Bill Lumbergh" {
+		t.Errorf("unexpected concatenation result: %v", titles)
+	}
+
+	v := unmarshal(t, projects)
+	for q, expected := range map[string]interface{}{
+		`"Project " + issue.fields.project.name`:    "Project Operations",
+		`issue.key + "/" + issue.fields.project.id`: "OP-1/10",
+		`issue.fields.project.id + 5`:               15.0,
+		`"a" + null + true`:                         "atrue",
+		`"a b"`:                                     nil,
+	} {
+		val, err := Get(v, q)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("Get(%s) did not fail", q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", q, err)
+			continue
+		}
+		if val != expected {
+			t.Errorf("Get(%s): got %v, expected %v", q, val, expected)
+		}
+	}
+
+	arr, err := Get(v, `projects + items`)
+	if err != nil {
+		t.Fatalf("array concatenation failed: %s", err)
+	}
+	if len(arr.([]interface{})) != 5 {
+		t.Errorf("unexpected array concatenation result: %v", arr)
+	}
+	_, err = Get(v, `issue.fields + 1`)
+	if err == nil {
+		t.Errorf("object added to number")
+	}
+
+	out, err := Format(`a+"-"+(b+c)`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if out != `a + "-" + (b + c)` {
+		t.Errorf("Format: got %s", out)
+	}
+}
+
+func TestConstruct(t *testing.T) {
+	v := unmarshal(t, projects)
+	val, err := Get(v, `{key: issue.key, "project name": issue.fields.project.name,
+leads: items[lead != null].lead, missing: issue.?lead}`)
+	if err != nil {
+		t.Fatalf("object construction failed: %s", err)
+	}
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		t.Fatalf("unexpected object construction result: %v", val)
+	}
+	if obj["key"] != "OP-1" || obj["project name"] != "Operations" {
+		t.Errorf("unexpected object: %v", obj)
+	}
+	leads, ok := obj["leads"].([]interface{})
+	if !ok || len(leads) != 2 || leads[1] != "Milton Waddams" {
+		t.Errorf("unexpected object leads: %v", obj["leads"])
+	}
+	if m, ok := obj["missing"]; !ok || m != nil {
+		t.Errorf("unexpected object missing: %v", m)
+	}
+
+	val, err = Get(v, `[issue.key, issue.fields.project.id, {}, []][1]`)
+	if err != nil {
+		t.Fatalf("array construction failed: %s", err)
+	}
+	if val != 10.0 {
+		t.Errorf("unexpected array construction result: %v", val)
+	}
+
+	rows, err := Ctx(projects).
+		Select("items").
+		Select(`{key: key, lead: if lead then lead else "nobody" end}`).
+		Get()
+	if err != nil {
+		t.Fatalf("object projection failed: %s", err)
+	}
+	if len(rows) != 3 ||
+		rows[0].(map[string]interface{})["lead"] != "nobody" {
+		t.Errorf("unexpected object projection result: %v", rows)
+	}
+
+	out, err := Format(`{ a:x.y,"b c":[1,"2",z[n>1]] , "if":{}}`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	expected := `{a: x.y, "b c": [1, "2", z[n > 1]], if: {}}`
+	if out != expected {
+		t.Errorf("Format: got %s, expected %s", out, expected)
+	}
+	for _, q := range []string{
+		`{a: x, a: y}`,
+		`{a x}`,
+		`{a: x`,
+		`{a: x,}`,
+		`[a, b`,
+		`[a b]`,
+		`{1: x}`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+func TestMaxBy(t *testing.T) {
+	v := unmarshal(t, assign)
+	for q, expected := range map[string]interface{}{
+		`issue.changelog.items.max_by(priority).fieldId`:                       "status",
+		`issue.changelog.items.min_by(priority).toString`:                      "Veijo Linux",
+		`issue.changelog.items.max_by(toString).toString`:                      "development",
+		`issue.changelog.items[fieldId=="assignee"].max_by(toString).toString`: "Veijo Linux",
+		`issue.changelog.items.min_by(?fromString).fieldId`:                    "assignee",
+		`issue.changelog.items.max_by(1).priority`:                             100.0,
+		`issue.changelog.items[fieldId=="none"].max_by(priority)`:              nil,
+	} {
+		val, err := Get(v, q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", q, err)
+			continue
+		}
+		if val != expected {
+			t.Errorf("Get(%s): got %v, expected %v", q, val, expected)
+		}
+	}
+
+	to, err := Ctx(projects).
+		Select(`let $items = items; $items.max_by(projectId).key`).
+		Strings()
+	if err != nil {
+		t.Fatalf("variable max_by failed: %s", err)
+	}
+	if len(to) != 1 || to[0] != "OP-2" {
+		t.Errorf("unexpected variable max_by result: %v", to)
+	}
+
+	x, err := GetInt(unmarshal(t, `{"a": {"max_by": 1, "min_by": {"x": 2}}}`),
+		`a.max_by + a."min_by".x`)
+	if err != nil {
+		t.Fatalf("selector key failed: %s", err)
+	}
+	if x != 3 {
+		t.Errorf("unexpected selector key value: %d", x)
+	}
+
+	_, err = Get(v, `issue.key.max_by(priority)`)
+	if err == nil {
+		t.Errorf("max_by accepted string")
+	}
+
+	out, err := Format(`items[a==1].max_by( b+c ).d[0]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if out != `items[a == 1].max_by(b + c).d[0]` {
+		t.Errorf("Format: got %s", out)
+	}
+	for _, q := range []string{
+		`items.max_by(a`,
+		`items.max_by(a b)`,
+		`items.max_by()`,
+		`items.max_by(a).`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+var changelogs = `{
+    "issues": [
+        {
+            "key": "OP-1",
+            "changelog": {
+                "items": [
+                    {"fieldId": "status", "priority": 1},
+                    {"fieldId": "assignee", "priority": 2}
+                ]
+            }
+        },
+        {
+            "key": "OP-2",
+            "changelog": {
+                "items": [
+                    {"fieldId": "status", "priority": 3}
+                ]
+            }
+        },
+        {
+            "key": "OP-3",
+            "changelog": {
+                "items": []
+            }
+        },
+        {
+            "key": "OP-4"
+        }
+    ]
+}`
+
+func TestQuantifiers(t *testing.T) {
+	for q, expected := range map[string]string{
+		`issues[any(?changelog.items, fieldId=="assignee")].key`:        "OP-1",
+		`issues[all(?changelog.items, fieldId=="status")].key`:          "OP-2,OP-3,OP-4",
+		`issues[any(?changelog.items, priority>2 || fieldId=="x")].key`: "OP-2",
+		`issues[all(?changelog.items, priority<3)].key`:                 "OP-1,OP-3,OP-4",
+		`issues[any(?changelog.items, missing==1)].key`:                 "",
+	} {
+		keys, err := Ctx(changelogs).Select(q).Strings()
+		if err != nil {
+			t.Errorf("Select(%s) failed: %s", q, err)
+			continue
+		}
+		if strings.Join(keys, ",") != expected {
+			t.Errorf("Select(%s): got %v, expected %s", q, keys, expected)
+		}
+	}
+	_, err := Ctx(changelogs).
+		Select(`issues[any(changelog.items, fieldId=="assignee")]`).
+		Get()
+	if err == nil {
+		t.Errorf("any accepted missing array")
+	}
+
+	v := unmarshal(t, changelogs)
+	val, err := Get(v, `any(issues, key=="OP-4")`)
+	if err != nil {
+		t.Fatalf("any expression failed: %s", err)
+	}
+	if val != true {
+		t.Errorf("unexpected any expression result: %v", val)
+	}
+	_, err = Get(v, `any(issues[0].key, key=="OP-4")`)
+	if err == nil {
+		t.Errorf("any accepted non-array")
+	}
+
+	out, err := Format(`issues[any(changelog.items,fieldId=="a"||p>1) && all(x, y)]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	expected := `issues[any(changelog.items, fieldId == "a" || p > 1) && all(x, y)]`
+	if out != expected {
+		t.Errorf("Format: got %s, expected %s", out, expected)
+	}
+	for _, q := range []string{
+		`issues[any(items)]`,
+		`issues[any(items, )]`,
+		`issues[any(items, a==1]`,
+		`issues[all(items a==1)]`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+var weights = `{
+    "items": [
+        {"priority": 3, "weight": 0.5, "key": "OP-1"},
+        {"priority": 10, "weight": 2, "key": "OP-2"},
+        {"priority": 1, "weight": 4, "key": "OP-3"}
+    ]
+}`
+
+func TestReduce(t *testing.T) {
+	v := unmarshal(t, weights)
+	for q, expected := range map[string]interface{}{
+		`reduce(items, $sum = 0, $sum + priority * weight)`:                       25.5,
+		`reduce(items, $keys = "", $keys + key + ",")`:                            "OP-1,OP-2,OP-3,",
+		`reduce(items[priority>2], $n = 0, $n + 1)`:                               2.0,
+		`reduce(?missing, $n = 7, $n + 1)`:                                        7.0,
+		`reduce(items, $max = 0, if priority > $max then priority else $max end)`: 10.0,
+		`2 + 3 * 4`:                         14.0,
+		`(2 + 3) * 4`:                       20.0,
+		`2 * 3 + 4 * 5`:                     26.0,
+		`items.max_by(priority).weight * 3`: 6.0,
+	} {
+		val, err := Get(v, q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", q, err)
+			continue
+		}
+		if val != expected {
+			t.Errorf("Get(%s): got %v (%T), expected %v", q, val, val, expected)
+		}
+	}
+
+	val, err := Get(v, `reduce(items, $acc = [], $acc + [key])`)
+	if err != nil {
+		t.Fatalf("array reduce failed: %s", err)
+	}
+	if arr, ok := val.([]interface{}); !ok || len(arr) != 3 || arr[2] != "OP-3" {
+		t.Errorf("unexpected array reduce result: %v", val)
+	}
+
+	for _, q := range []string{
+		`reduce(items, $sum = 0, $sum * key)`,
+		`reduce(items.max_by(priority).key, $sum = 0, $sum + 1)`,
+		`"a" * 2`,
+	} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+
+	for q, expected := range map[string]string{
+		`reduce(items,$s=0,$s+a*b)`: `reduce(items, $s = 0, $s + a * b)`,
+		`(a+b)*c+d*(e+f)`:           `(a + b) * c + d * (e + f)`,
+		`a+(b+c)`:                   `a + (b + c)`,
+		`a*b*c`:                     `a * b * c`,
+	} {
+		out, err := Format(q)
+		if err != nil {
+			t.Errorf("Format(%s) failed: %s", q, err)
+			continue
+		}
+		if out != expected {
+			t.Errorf("Format(%s): got %s, expected %s", q, out, expected)
+		}
+	}
+	for _, q := range []string{
+		`reduce(items, $s = 0)`,
+		`reduce(items, s = 0, 1)`,
+		`reduce(items, $s = 0, $s + 1); $s`,
+		`reduce(items, $s = $s, 1)`,
+		`reduce(items, $s = 0, $s + 1`,
+		`a * `,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
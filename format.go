@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Format parses the query q and returns it in the canonical form. The
+// canonical form quotes only the keys that are not identifiers,
+// always quotes string literals, and separates the comparison and
+// logical operators with single spaces, for example:
+//
+//	issue.changelog.items[fieldId == "assignee" && priority >= 10][0]
+//
+// Queries that are equivalent modulo quoting and spacing have the
+// same canonical form.
+func Format(q string) (string, error) {
+	parsed, err := parseProgram(q)
+	if err != nil {
+		return "", err
+	}
+	return exprString(parsed), nil
+}
+
+// format returns the query in the canonical form.
+func (q *query) format() string {
+	var sb strings.Builder
+	for idx, s := range q.segments() {
+		if idx > 0 {
+			sb.WriteByte('.')
+		}
+		if s.optional {
+			sb.WriteByte('?')
+		}
+		sb.WriteString(formatKey(s.key))
+		for _, f := range s.filters {
+			sb.WriteByte('[')
+			formatFilter(&sb, f)
+			sb.WriteByte(']')
+		}
+	}
+	if len(q.typ) > 0 {
+		sb.WriteString("::")
+		sb.WriteString(q.typ)
+	}
+	return sb.String()
+}
+
+func formatFilter(sb *strings.Builder, f filter) {
+	switch f := f.(type) {
+	case *all:
+
+	case *logical:
+		// The logical operators are left-associative and have equal
+		// precedence so only the right operand needs parentheses.
+		formatFilter(sb, f.Left)
+		fmt.Fprintf(sb, " %s ", f.Op)
+		if _, ok := f.Right.(*logical); ok {
+			sb.WriteByte('(')
+			formatFilter(sb, f.Right)
+			sb.WriteByte(')')
+		} else {
+			formatFilter(sb, f.Right)
+		}
+
+	case *comparative:
+		if f.Op == tInt {
+			fmt.Fprintf(sb, "%d", f.Left.IntVal)
+			return
+		}
+		if f.Left.Optional {
+			sb.WriteByte('?')
+		}
+		if f.Left.Type == tExpr {
+			f.Left.Expr.format(sb)
+		} else {
+			sb.WriteString(formatKey(f.Left.StrVal))
+		}
+		if f.Right == nil {
+			return
+		}
+		fmt.Fprintf(sb, " %s ", f.Op)
+		switch f.Right.Type {
+		case tInt:
+			sb.WriteString(f.Right.intString())
+		case tNull:
+			sb.WriteString("null")
+		case tVariable, tExpr:
+			sb.WriteString(f.Right.String())
+		default:
+			formatString(sb, f.Right.StrVal)
+		}
+
+	default:
+		sb.WriteString(f.String())
+	}
+}
+
+// filterString returns the filter in the canonical form.
+func filterString(f filter) string {
+	var sb strings.Builder
+	formatFilter(&sb, f)
+	return sb.String()
+}
+
+// formatKey formats the key as an identifier if possible and as a
+// quoted string otherwise.
+func formatKey(key string) string {
+	if isIdentifier(key) {
+		return key
+	}
+	var sb strings.Builder
+	formatString(&sb, key)
+	return sb.String()
+}
+
+func formatString(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	escape(sb, s)
+	sb.WriteByte('"')
+}
+
+// QuoteKey returns the key in a form that can be embedded into query
+// strings as an object key. Identifiers are returned as-is and other
+// keys, including the keywords null, true, and false, are quoted and
+// escaped, for example:
+//
+//	q := "headers." + QuoteKey("Content-Type") + ".value"
+func QuoteKey(key string) string {
+	return formatKey(key)
+}
+
+// EscapeString escapes the quotes, backslashes, and control
+// characters of the string s so that the result can be embedded
+// between double quotes in query strings, for example:
+//
+//	q := `items[name=="` + EscapeString(name) + `"]`
+func EscapeString(s string) string {
+	var sb strings.Builder
+	escape(&sb, s)
+	return sb.String()
+}
+
+func escape(sb *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch ch {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(ch)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if ch < 0x20 {
+				fmt.Fprintf(sb, `\u%04x`, ch)
+			} else {
+				sb.WriteByte(ch)
+			}
+		}
+	}
+}
+
+// isIdentifier tests if the string s is lexed as an identifier that
+// names a key. The literal keywords null, true, and false are not
+// identifiers since they are literals in filters and expressions.
+func isIdentifier(s string) bool {
+	switch s {
+	case "null", "true", "false":
+		return false
+	}
+	for idx, r := range s {
+		if idx == 0 {
+			if !unicode.IsLetter(r) {
+				return false
+			}
+		} else if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
@@ -0,0 +1,195 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		q        string
+		expected string
+	}{
+		{`issue.key`, `issue.key`},
+		{`"issue"."key"`, `issue.key`},
+		{` issue . ?"key" `, `issue.?key`},
+		{`?issue.key`, `?issue.key`},
+		{`"a b"."1st"."_x".x_1`, `"a b"."1st"."_x".x_1`},
+		{`items[fieldId==assignee]`, `items[fieldId == "assignee"]`},
+		{`items["fieldId"!="a"&&priority>=10||x<1][0][]`,
+			`items[fieldId != "a" && priority >= 10 || x < 1][0][]`},
+		{`items [ 3 ] . to`, `items[3].to`},
+		{`items[a==1||(b==2&&(c==3))]`, `items[a == 1 || (b == 2 && c == 3)]`},
+		{`items[(a==1||b==2)&&c==3]`, `items[a == 1 || b == 2 && c == 3]`},
+		{`a["null" == "x"]`, `a["null" == "x"]`},
+		{`a[?null == "x"].null.true`, `a[?"null" == "x"]."null"."true"`},
+	}
+	for _, test := range tests {
+		result, err := Format(test.q)
+		if err != nil {
+			t.Fatalf("Format(%s) failed: %s", test.q, err)
+		}
+		if result != test.expected {
+			t.Errorf("Format(%s): got %s, expected %s", test.q, result,
+				test.expected)
+		}
+		again, err := Format(result)
+		if err != nil {
+			t.Fatalf("Format(%s) failed: %s", result, err)
+		}
+		if again != result {
+			t.Errorf("Format(%s) not idempotent: %s", result, again)
+		}
+	}
+	_, err := Format(`issue..key`)
+	if err == nil {
+		t.Errorf("Format accepted invalid query")
+	}
+}
+
+var roundTripKeys = []string{
+	"a", "key", "x_1", "Ärrä", "a b", "1st", "_x", "a.b", "[x]", "a==b",
+	"", "&&", "?", `a"b`, `back\slash`, "tab\there", "\x01", "null",
+	"true", "false",
+}
+
+func randomKey(rnd *rand.Rand) string {
+	return roundTripKeys[rnd.Intn(len(roundTripKeys))]
+}
+
+func randomFilter(rnd *rand.Rand, depth int) filter {
+	switch n := rnd.Intn(6); {
+	case n == 0:
+		return &all{}
+
+	case n == 1:
+		return &comparative{
+			Left: &atom{
+				Type:   tInt,
+				IntVal: rnd.Intn(100),
+			},
+			Op: tInt,
+		}
+
+	case n == 2 && depth < 3:
+		ops := []tokenType{tAnd, tOr}
+		return &logical{
+			Left:  randomCondition(rnd, depth+1),
+			Op:    ops[rnd.Intn(len(ops))],
+			Right: randomCondition(rnd, depth+1),
+		}
+
+	default:
+		return randomCondition(rnd, depth)
+	}
+}
+
+func randomCondition(rnd *rand.Rand, depth int) filter {
+	if depth < 3 && rnd.Intn(3) == 0 {
+		ops := []tokenType{tAnd, tOr}
+		return &logical{
+			Left:  randomCondition(rnd, depth+1),
+			Op:    ops[rnd.Intn(len(ops))],
+			Right: randomCondition(rnd, depth+1),
+		}
+	}
+	c := &comparative{
+		Left: &atom{
+			Type:   tString,
+			StrVal: randomKey(rnd),
+		},
+	}
+	ops := []tokenType{tEq, tNeq, tLt, tLe, tGt, tGe}
+	c.Op = ops[rnd.Intn(len(ops))]
+	if rnd.Intn(2) == 0 {
+		c.Right = &atom{
+			Type:   tInt,
+			IntVal: rnd.Intn(1000),
+		}
+	} else {
+		c.Right = &atom{
+			Type:   tString,
+			StrVal: randomKey(rnd),
+		}
+	}
+	return c
+}
+
+func randomQuery(rnd *rand.Rand) *query {
+	var q *query
+	for i := rnd.Intn(4); i >= 0; i-- {
+		q = &query{
+			left:     q,
+			optional: rnd.Intn(4) == 0,
+			key:      randomKey(rnd),
+		}
+		for j := rnd.Intn(3); j > 0; j-- {
+			q.filters = append(q.filters, randomFilter(rnd, 0))
+		}
+	}
+	if rnd.Intn(4) == 0 {
+		q.typ = "int"
+	}
+	return q
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		q := randomQuery(rnd)
+		str := q.String()
+		parsed, err := parse(str)
+		if err != nil {
+			t.Fatalf("parse(%s) failed: %s", str, err)
+		}
+		if !reflect.DeepEqual(q, parsed) {
+			t.Fatalf("parse(%s) returned a different query: %s", str, parsed)
+		}
+	}
+}
+
+func TestQuoteKey(t *testing.T) {
+	keys := []string{"name", "Content-Type", `a"b`, `a\b`, "a.b[0]", "",
+		"line\nfeed", "null", "true", "false"}
+	for _, key := range keys {
+		v := map[string]interface{}{
+			"root": map[string]interface{}{
+				key: "value",
+			},
+			"items": []interface{}{
+				map[string]interface{}{
+					"name": key,
+				},
+			},
+		}
+		q := "root." + QuoteKey(key)
+		val, err := GetString(v, q)
+		if err != nil {
+			t.Fatalf("GetString(%s) failed: %s", q, err)
+		}
+		if val != "value" {
+			t.Errorf("GetString(%s): got %s, expected value", q, val)
+		}
+		q = `items[name=="` + EscapeString(key) + `"].name`
+		names, err := Ctx(v).Select(q).Strings()
+		if err != nil {
+			t.Fatalf("Select(%s) failed: %s", q, err)
+		}
+		if len(names) != 1 || names[0] != key {
+			t.Errorf("Select(%s): got %q, expected %q", q, names, key)
+		}
+	}
+	if QuoteKey("name") != "name" {
+		t.Errorf("QuoteKey quoted identifier")
+	}
+	if QuoteKey("null") != `"null"` {
+		t.Errorf("QuoteKey did not quote null: %s", QuoteKey("null"))
+	}
+}
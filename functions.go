@@ -0,0 +1,356 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// function is a built-in function of the query expressions. The
+// function receives its evaluated arguments.
+type function struct {
+	minArgs int
+	maxArgs int
+	fn      func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]*function{
+	"tostring": {
+		minArgs: 1,
+		maxArgs: 1,
+		fn:      fnToString,
+	},
+	"tonumber": {
+		minArgs: 1,
+		maxArgs: 1,
+		fn:      fnToNumber,
+	},
+	"toboolean": {
+		minArgs: 1,
+		maxArgs: 1,
+		fn:      fnToBoolean,
+	},
+	"split": {
+		minArgs: 2,
+		maxArgs: 2,
+		fn:      fnSplit,
+	},
+	"substr": {
+		minArgs: 2,
+		maxArgs: 3,
+		fn:      fnSubstr,
+	},
+	"match": {
+		minArgs: 2,
+		maxArgs: 3,
+		fn:      fnMatch,
+	},
+	"b64decode": {
+		minArgs: 1,
+		maxArgs: 1,
+		fn:      fnB64Decode,
+	},
+	"urldecode": {
+		minArgs: 1,
+		maxArgs: 1,
+		fn:      fnURLDecode,
+	},
+	"transpose": {
+		minArgs: 1,
+		maxArgs: 1,
+		fn:      fnTranspose,
+	},
+}
+
+// stringArg returns the argument idx of the function name as string.
+func stringArg(name string, args []interface{}, idx int) (string, error) {
+	str, ok := args[idx].(string)
+	if !ok {
+		return "", fmt.Errorf("jsonq: %s: argument %d is %s, expected string",
+			name, idx+1, typeName(args[idx]))
+	}
+	return str, nil
+}
+
+// intArg returns the argument idx of the function name as a
+// non-negative int.
+func intArg(name string, args []interface{}, idx int) (int, error) {
+	n, ok := toNumber(args[idx])
+	if ok && n.integral() {
+		i, acc := n.bigFloat().Int64()
+		if acc == big.Exact && i >= 0 && i <= math.MaxInt32 {
+			return int(i), nil
+		}
+	}
+	return 0, fmt.Errorf("jsonq: %s: argument %d is %s, expected index",
+		name, idx+1, typeName(args[idx]))
+}
+
+// fnToString converts its argument to string. The strings are
+// returned as-is and the other values are converted to their JSON
+// encoding.
+func fnToString(args []interface{}) (interface{}, error) {
+	switch val := args[0].(type) {
+	case string:
+		return val, nil
+
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, fmt.Errorf("jsonq: tostring: %s", err)
+		}
+		return string(data), nil
+	}
+}
+
+// fnToNumber converts its argument to number. The numbers are returned
+// as-is and the strings are parsed as decimal numbers. The integers
+// that can't be represented exactly as float64 are returned as
+// json.Number values.
+func fnToNumber(args []interface{}) (interface{}, error) {
+	switch val := args[0].(type) {
+	case float64, json.Number:
+		return val, nil
+
+	case string:
+		str := strings.TrimSpace(val)
+		f, err := strconv.ParseFloat(str, 64)
+		if err == nil && math.Abs(f) < 1<<53 {
+			return f, nil
+		}
+		if json.Valid([]byte(str)) {
+			if _, ok := toNumber(json.Number(str)); ok {
+				return json.Number(str), nil
+			}
+		}
+		return nil, fmt.Errorf("jsonq: tonumber: invalid number %q", val)
+
+	default:
+		return nil, fmt.Errorf("jsonq: tonumber: can't convert %s to number",
+			typeName(val))
+	}
+}
+
+// fnToBoolean converts its argument to bool. The strings are parsed
+// with strconv.ParseBool and the numbers are true if they are not
+// zero.
+func fnToBoolean(args []interface{}) (interface{}, error) {
+	switch val := args[0].(type) {
+	case bool:
+		return val, nil
+
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("jsonq: toboolean: invalid boolean %q", val)
+		}
+		return b, nil
+
+	default:
+		n, ok := toNumber(val)
+		if !ok {
+			return nil, fmt.Errorf("jsonq: toboolean: can't convert %s to bool",
+				typeName(val))
+		}
+		return n.bigFloat().Sign() != 0, nil
+	}
+}
+
+// fnSplit splits its first argument into an array of substrings
+// separated by the second argument.
+func fnSplit(args []interface{}) (interface{}, error) {
+	str, err := stringArg("split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := stringArg("split", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(str, sep)
+	result := make([]interface{}, len(parts))
+	for idx, part := range parts {
+		result[idx] = part
+	}
+	return result, nil
+}
+
+// fnSubstr returns the substring of its first argument starting from
+// the character index of the second argument. The optional third
+// argument limits the number of characters. The indices past the end
+// of the string are truncated to the string length.
+func fnSubstr(args []interface{}) (interface{}, error) {
+	str, err := stringArg("substr", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(str)
+	start, err := intArg("substr", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if start > len(runes) {
+		start = len(runes)
+	}
+	end := len(runes)
+	if len(args) > 2 {
+		length, err := intArg("substr", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		if length < end-start {
+			end = start + length
+		}
+	}
+	return string(runes[start:end]), nil
+}
+
+// literalPattern compiles the pattern argument of match if it is a
+// string literal so that the pattern is compiled once when the query
+// is parsed. The function returns nil for the dynamic patterns that
+// are compiled when match is called.
+func literalPattern(arg expr) (*regexp.Regexp, error) {
+	lit, ok := arg.(*literalExpr)
+	if !ok {
+		return nil, nil
+	}
+	pattern, ok := lit.value.(string)
+	if !ok {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("jsonq: match: invalid pattern %q: %s",
+			pattern, err)
+	}
+	return re, nil
+}
+
+// fnMatch matches its first argument against the regular expression
+// of the second argument and returns the capture group of the
+// optional third argument. The group 0, the default, is the whole
+// match. The function returns null if the string does not match or
+// if the group did not participate in the match.
+func fnMatch(args []interface{}) (interface{}, error) {
+	str, err := stringArg("match", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	re, ok := args[1].(*regexp.Regexp)
+	if !ok {
+		pattern, err := stringArg("match", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("jsonq: match: invalid pattern %q: %s",
+				pattern, err)
+		}
+	}
+	var group int
+	if len(args) > 2 {
+		group, err = intArg("match", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		if group > re.NumSubexp() {
+			return nil, fmt.Errorf("jsonq: match: pattern %q has no group %d",
+				re, group)
+		}
+	}
+	m := re.FindStringSubmatchIndex(str)
+	if m == nil || m[2*group] < 0 {
+		return nil, nil
+	}
+	return str[m[2*group]:m[2*group+1]], nil
+}
+
+// fnB64Decode decodes its base64 encoded argument. The argument can
+// use the standard or the URL-safe alphabet, with or without padding,
+// so that it also decodes the JWT segments. The decoded data must be a
+// valid UTF-8 string.
+func fnB64Decode(args []interface{}) (interface{}, error) {
+	str, err := stringArg("b64decode", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	str = strings.TrimRight(strings.TrimSpace(str), "=")
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(str, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	data, err := encoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("jsonq: b64decode: %s", err)
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("jsonq: b64decode: data is not valid UTF-8")
+	}
+	return string(data), nil
+}
+
+// fnURLDecode decodes its URL encoded argument. The '+' characters are
+// decoded to spaces as in the URL query strings.
+func fnURLDecode(args []interface{}) (interface{}, error) {
+	str, err := stringArg("urldecode", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	val, err := url.QueryUnescape(str)
+	if err != nil {
+		return nil, fmt.Errorf("jsonq: urldecode: %s", err)
+	}
+	return val, nil
+}
+
+// fnTranspose transposes its array of arrays argument so that the
+// rows become columns and the columns rows. The rows shorter than the
+// longest row are padded with null values.
+func fnTranspose(args []interface{}) (interface{}, error) {
+	rows, ok := arrayValue(args[0])
+	if !ok {
+		return nil, fmt.Errorf("jsonq: transpose: argument is %s, expected array",
+			typeName(args[0]))
+	}
+	matrix := make([][]interface{}, len(rows))
+	var width int
+	for idx, row := range rows {
+		cols, ok := arrayValue(normalize(row))
+		if !ok {
+			return nil, fmt.Errorf("jsonq: transpose: row %d is %s, expected array",
+				idx, typeName(row))
+		}
+		matrix[idx] = cols
+		if len(cols) > width {
+			width = len(cols)
+		}
+	}
+	result := make([]interface{}, width)
+	for col := range result {
+		column := make([]interface{}, len(matrix))
+		for idx, cols := range matrix {
+			if col < len(cols) {
+				column[idx] = cols[col]
+			}
+		}
+		result[col] = column
+	}
+	return result, nil
+}
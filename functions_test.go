@@ -0,0 +1,448 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var loose = `{
+    "items": [
+        {"key": "OP-1", "priority": "100", "done": "true", "size": 3},
+        {"key": "OP-2", "priority": "5", "done": "false", "size": 0},
+        {"key": "OP-3", "priority": "12", "done": "TRUE", "size": 1.5}
+    ]
+}`
+
+var looseItem = `{
+    "key": "OP-1",
+    "priority": "100",
+    "done": "TRUE",
+    "size": 3,
+    "half": 1.5,
+    "zero": 0
+}`
+
+var conversionTests = []struct {
+	q        string
+	expected interface{}
+}{
+	{`tostring(size)`, "3"},
+	{`tostring(half)`, "1.5"},
+	{`tostring(key)`, "OP-1"},
+	{`tostring(null)`, "null"},
+	{`tostring(true)`, "true"},
+	{`tonumber(priority)`, 100.0},
+	{`tonumber(" 12.5 ")`, 12.5},
+	{`tonumber("123456789012345678901234567890")`,
+		json.Number("123456789012345678901234567890")},
+	{`tonumber(zero) + 1`, 1.0},
+	{`toboolean(done)`, true},
+	{`toboolean(zero)`, false},
+	{`toboolean(false)`, false},
+}
+
+func TestConversions(t *testing.T) {
+	v := unmarshal(t, looseItem)
+	for _, test := range conversionTests {
+		val, err := Get(v, test.q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", test.q, err)
+			continue
+		}
+		if val != test.expected {
+			t.Errorf("Get(%s): got %v (%T), expected %v", test.q, val, val,
+				test.expected)
+		}
+	}
+	for _, q := range []string{
+		`tonumber(key)`,
+		`tonumber(missing)`,
+		`toboolean(key)`,
+		`toboolean(null)`,
+	} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+}
+
+func TestConversionFilters(t *testing.T) {
+	keys, err := Ctx(loose).
+		Select(`items[tonumber(priority)>10].key`).
+		Strings()
+	if err != nil {
+		t.Fatalf("tonumber filter failed: %s", err)
+	}
+	if len(keys) != 2 || keys[0] != "OP-1" || keys[1] != "OP-3" {
+		t.Errorf("unexpected tonumber filter result: %v", keys)
+	}
+
+	keys, err = Ctx(loose).
+		Select(`items[toboolean(done) && tostring(size) == "3"].key`).
+		Strings()
+	if err != nil {
+		t.Fatalf("toboolean filter failed: %s", err)
+	}
+	if len(keys) != 1 || keys[0] != "OP-1" {
+		t.Errorf("unexpected toboolean filter result: %v", keys)
+	}
+
+	keys, err = Ctx(loose).
+		Select(`items[size < tonumber(priority)].key`).
+		Strings()
+	if err != nil {
+		t.Fatalf("call operand failed: %s", err)
+	}
+	if len(keys) != 3 {
+		t.Errorf("unexpected call operand result: %v", keys)
+	}
+
+	_, err = Ctx(loose).Select(`items[tonumber(key)>10]`).Get()
+	if err == nil {
+		t.Errorf("tonumber of invalid number did not fail")
+	}
+
+	out, err := Format(`items[tonumber( priority )>10 && x==tostring(y)]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	expected := `items[tonumber(priority) > 10 && x == tostring(y)]`
+	if out != expected {
+		t.Errorf("Format: got %s, expected %s", out, expected)
+	}
+	for _, q := range []string{
+		`items[nosuchfunction(x)]`,
+		`tostring()`,
+		`tostring(a, b)`,
+		`tostring(a b)`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+var splitTests = []struct {
+	q        string
+	expected interface{}
+}{
+	{`split(key, "-")[0]`, "OP"},
+	{`split(key, "-")[1]`, "1"},
+	{`split(key, "-")[2]`, nil},
+	{`tonumber(split(key, "-")[1]) + 1`, 2.0},
+	{`substr(key, 3)`, "1"},
+	{`substr(key, 0, 2)`, "OP"},
+	{`substr(key, 1, 100)`, "P-1"},
+	{`substr(key, 10)`, ""},
+	{`(key)[0]`, "O"},
+	{`let $k = key; $k[3]`, "1"},
+}
+
+func TestSplit(t *testing.T) {
+	v := unmarshal(t, looseItem)
+	for _, test := range splitTests {
+		val, err := Get(v, test.q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", test.q, err)
+			continue
+		}
+		if val != test.expected {
+			t.Errorf("Get(%s): got %v (%T), expected %v", test.q, val, val,
+				test.expected)
+		}
+	}
+	for _, q := range []string{
+		`split(size, "-")`,
+		`substr(key, -1)`,
+		`substr(key, half)`,
+		`tonumber(size)[0]`,
+	} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+
+	keys, err := Ctx(loose).
+		Select(`items[split(key, "-")[0] == "OP" && split(key, "-")[1] != "2"].key`).
+		Strings()
+	if err != nil {
+		t.Fatalf("split filter failed: %s", err)
+	}
+	if len(keys) != 2 || keys[0] != "OP-1" || keys[1] != "OP-3" {
+		t.Errorf("unexpected split filter result: %v", keys)
+	}
+
+	out, err := Format(`items[split(key,"-")[0]=="OP"]+substr( key,3 )[0]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	expected := `items[split(key, "-")[0] == "OP"] + substr(key, 3)[0]`
+	if out != expected {
+		t.Errorf("Format: got %s, expected %s", out, expected)
+	}
+	for _, q := range []string{
+		`split(key, "-")[`,
+		`split(key, "-")[x==]`,
+		`split(key, "-")[0`,
+		`split(key)`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+var matchTests = []struct {
+	q        string
+	expected interface{}
+}{
+	{`match(key, "OP-(\\d+)", 1)`, "1"},
+	{`match(key, "OP-(\\d+)")`, "OP-1"},
+	{`match(key, "[A-Z]+")`, "OP"},
+	{`match(key, "DEV-(\\d+)", 1)`, nil},
+	{`match(key, "OP-(x)?", 1)`, nil},
+	{`tonumber(match(key, "-(\\d+)$", 1)) + 1`, 2.0},
+}
+
+func TestMatch(t *testing.T) {
+	v := unmarshal(t, looseItem)
+	for _, test := range matchTests {
+		val, err := Get(v, test.q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", test.q, err)
+			continue
+		}
+		if val != test.expected {
+			t.Errorf("Get(%s): got %v (%T), expected %v", test.q, val, val,
+				test.expected)
+		}
+	}
+	for _, q := range []string{
+		`match(key, "(")`,
+		`match(key, "OP-(\\d+)", 2)`,
+		`match(size, "3")`,
+		`match(key, "OP", -1)`,
+	} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+
+	keys, err := Ctx(loose).
+		Select(`items[tonumber(match(key, "OP-(\\d+)", 1)) >= 2].key`).
+		Strings()
+	if err != nil {
+		t.Fatalf("match filter failed: %s", err)
+	}
+	if len(keys) != 2 || keys[0] != "OP-2" || keys[1] != "OP-3" {
+		t.Errorf("unexpected match filter result: %v", keys)
+	}
+
+	nums, err := Ctx(loose).
+		Select("items").
+		Select(`match(key, "\\d+")`).
+		Strings()
+	if err != nil {
+		t.Fatalf("match projection failed: %s", err)
+	}
+	if len(nums) != 3 || nums[0] != "1" || nums[2] != "3" {
+		t.Errorf("unexpected match projection result: %v", nums)
+	}
+
+	if Validate(`match(key, "(")`) == nil {
+		t.Errorf("Validate accepted invalid literal pattern")
+	}
+	dynamic := unmarshal(t, `{"key": "OP-12", "pattern": "OP-(\\d+)", "bad": "("}`)
+	val, err := Get(dynamic, `match(key, pattern, 1)`)
+	if err != nil || val != "12" {
+		t.Errorf("dynamic match: got %v, %v", val, err)
+	}
+	_, err = Get(dynamic, `match(key, bad)`)
+	if err == nil {
+		t.Errorf("dynamic match accepted invalid pattern")
+	}
+}
+
+var encoded = `{
+    "jwt": "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ2ZWlqbyIsIm4iOiI-Pz8ifQ.c2ln",
+    "std": "aGVsbG8sIHdvcmxkIQ==",
+    "raw": "aGVsbG8sIHdvcmxkIQ",
+    "query": "name=Veijo+Linux&q=a%26b%3Dc",
+    "binary": "//79"
+}`
+
+var decodeTests = []struct {
+	q        string
+	expected interface{}
+}{
+	{`b64decode(std)`, "hello, world!"},
+	{`b64decode(raw)`, "hello, world!"},
+	{`b64decode(split(jwt, ".")[0])`, `{"alg":"HS256"}`},
+	{`b64decode(split(jwt, ".")[1])`, `{"sub":"veijo","n":">??"}`},
+	{`urldecode(query)`, "name=Veijo Linux&q=a&b=c"},
+	{`urldecode(split(split(query, "&")[1], "=")[1])`, "a&b=c"},
+}
+
+func TestDecode(t *testing.T) {
+	v := unmarshal(t, encoded)
+	for _, test := range decodeTests {
+		val, err := Get(v, test.q)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %s", test.q, err)
+			continue
+		}
+		if val != test.expected {
+			t.Errorf("Get(%s): got %v, expected %v", test.q, val, test.expected)
+		}
+	}
+	for _, q := range []string{
+		`b64decode(binary)`,
+		`b64decode("a!b")`,
+		`urldecode("%zz")`,
+		`urldecode(null)`,
+	} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+}
+
+var columns = `{
+    "result": {
+        "names": ["Veijo Linux", "Bill Lumbergh", "Milton Waddams"],
+        "ages": [42, 50, 38],
+        "teams": ["ops", "mgmt", "ops"]
+    },
+    "short": [1]
+}`
+
+func TestZip(t *testing.T) {
+	var rows []struct {
+		Name string `jsonq:"names"`
+		Team string `jsonq:"teams"`
+	}
+	err := Ctx(columns).
+		Select(`zip(result.names, result.ages, result.teams)[ages > 40]`).
+		Extract(&rows)
+	if err != nil {
+		t.Fatalf("zip Extract failed: %s", err)
+	}
+	if len(rows) != 2 || rows[0].Name != "Veijo Linux" || rows[1].Team != "mgmt" {
+		t.Errorf("unexpected zip rows: %v", rows)
+	}
+
+	v := unmarshal(t, columns)
+	val, err := Get(v, `zip(result.names, result.teams, split("a b c", " "))[1]`)
+	if err != nil {
+		t.Fatalf("zip failed: %s", err)
+	}
+	obj, ok := val.(map[string]interface{})
+	if !ok || obj["names"] != "Bill Lumbergh" || obj["teams"] != "mgmt" ||
+		obj["2"] != "b" {
+		t.Errorf("unexpected zip element: %v", val)
+	}
+
+	names, err := Ctx(columns).
+		Select(`zip(result.names, result.teams)[teams == "ops"].names`).
+		Strings()
+	if err != nil {
+		t.Fatalf("zip path failed: %s", err)
+	}
+	if len(names) != 2 || names[1] != "Milton Waddams" {
+		t.Errorf("unexpected zip path result: %v", names)
+	}
+
+	for _, q := range []string{
+		`zip(result.names, short)`,
+		`zip(result.names, result)`,
+		`zip(result.names, result.ages)[missing > 1]`,
+	} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+	for _, q := range []string{
+		`zip(names)`,
+		`zip(a.names, b.names)`,
+		`zip(a, b`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+	out, err := Format(`zip( a.b,c )[b>1 && c=="x"]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if out != `zip(a.b, c)[b > 1 && c == "x"]` {
+		t.Errorf("Format: got %s", out)
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	v := unmarshal(t, `{
+    "rows": [["OP-1", 3, true], ["OP-2", 5, false]],
+    "ragged": [[1, 2], [3]],
+    "invalid": [[1], 2]
+}`)
+	val, err := Get(v, `transpose(rows)`)
+	if err != nil {
+		t.Fatalf("transpose failed: %s", err)
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	if string(data) != `[["OP-1","OP-2"],[3,5],[true,false]]` {
+		t.Errorf("unexpected transpose result: %s", data)
+	}
+
+	val, err = Get(v, `transpose(transpose(rows))`)
+	if err != nil {
+		t.Fatalf("transpose failed: %s", err)
+	}
+	data, _ = json.Marshal(val)
+	if string(data) != `[["OP-1",3,true],["OP-2",5,false]]` {
+		t.Errorf("unexpected double transpose result: %s", data)
+	}
+
+	val, err = Get(v, `transpose(ragged)`)
+	if err != nil {
+		t.Fatalf("ragged transpose failed: %s", err)
+	}
+	data, _ = json.Marshal(val)
+	if string(data) != `[[1,3],[2,null]]` {
+		t.Errorf("unexpected ragged transpose result: %s", data)
+	}
+	data, _ = json.Marshal(v)
+	if !strings.Contains(string(data), `"ragged":[[1,2],[3]]`) {
+		t.Errorf("transpose modified its argument: %s", data)
+	}
+
+	val, err = Get(v, `transpose([])`)
+	if err != nil {
+		t.Fatalf("empty transpose failed: %s", err)
+	}
+	if arr, ok := val.([]interface{}); !ok || len(arr) != 0 {
+		t.Errorf("unexpected empty transpose result: %v", val)
+	}
+
+	for _, q := range []string{`transpose(invalid)`, `transpose(rows.max_by(1))`, `transpose("x")`} {
+		_, err := Get(v, q)
+		if err == nil {
+			t.Errorf("Get(%s) did not fail", q)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+//go:build go1.18
+// +build go1.18
+
+package jsonq
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var fuzzQueries = []string{
+	`issue.key`,
+	`issue.?key`,
+	`issue.changelog.items[fieldId=="assignee"][1].toString`,
+	`issue.changelog.items[priority>=10 && (fieldId!="a" || x<1)][]`,
+	`"a b"."c\"d"[0]`,
+	`items[a=="ä\n"]`,
+}
+
+func FuzzParse(f *testing.F) {
+	for _, q := range fuzzQueries {
+		f.Add(q)
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		query, err := Compile(q)
+		if err != nil {
+			if Validate(q) == nil {
+				t.Fatalf("Validate accepted invalid query %q", q)
+			}
+			return
+		}
+		str := query.q.String()
+		again, err := parse(str)
+		if err != nil {
+			t.Fatalf("parse(%q) of %q failed: %s", str, q, err)
+		}
+		if again.String() != str {
+			t.Fatalf("String not stable: %q != %q", again.String(), str)
+		}
+	})
+}
+
+func FuzzEval(f *testing.F) {
+	for _, q := range fuzzQueries {
+		f.Add(q, assign)
+	}
+	f.Fuzz(func(t *testing.T, q, doc string) {
+		query, err := Compile(q)
+		if err != nil {
+			return
+		}
+		var v interface{}
+		if json.Unmarshal([]byte(doc), &v) != nil {
+			return
+		}
+		result, err := query.Eval(v)
+		if err != nil {
+			return
+		}
+		var items []interface{}
+		it := query.Iter(v)
+		for {
+			item, ok := it.Next()
+			if !ok {
+				break
+			}
+			items = append(items, item)
+		}
+		if it.Err() != nil {
+			t.Fatalf("Iter(%q) failed: %s", q, it.Err())
+		}
+		if _, ok := result.([]interface{}); !ok {
+			result = []interface{}{result}
+		}
+		a, _ := json.Marshal(result)
+		b, _ := json.Marshal(items)
+		if len(items) > 0 && string(a) != string(b) {
+			t.Fatalf("Eval(%q) and Iter differ: %s != %s", q, a, b)
+		}
+	})
+}
@@ -7,73 +7,317 @@
 package jsonq
 
 import (
-	"fmt"
+	"encoding/json"
+	"math/big"
 )
 
 // GetString gets the string value pointed by the query q.
-func GetString(value interface{}, q string) (string, error) {
-	v, err := Get(value, q)
+func GetString(value interface{}, q string, opts ...Option) (string, error) {
+	o := newOptions(opts)
+	query, err := o.compile(q)
 	if err != nil {
 		return "", err
 	}
-	switch val := v.(type) {
-	case string:
-		return val, nil
+	return query.getString(o.env(), value)
+}
 
-	case nil:
-		return "", nil
+// GetNumber gets the float64 number value pointed by the query q.
+func GetNumber(value interface{}, q string, opts ...Option) (float64, error) {
+	o := newOptions(opts)
+	query, err := o.compile(q)
+	if err != nil {
+		return 0, err
+	}
+	return query.getNumber(o.env(), value)
+}
 
-	default:
-		return "", fmt.Errorf("jsonq: value of '%s' is not string: %T", q, v)
+// GetInt gets the integer number value pointed by query q. The
+// function internally gets the value as number and casts it to int
+// type. With the Strict strictness, fractional numbers are rejected.
+func GetInt(value interface{}, q string, opts ...Option) (int, error) {
+	o := newOptions(opts)
+	query, err := o.compile(q)
+	if err != nil {
+		return 0, err
 	}
+	return query.getInt(o.env(), value)
 }
 
-// GetNumber gets the float64 number value pointed by the query q.
-func GetNumber(value interface{}, q string) (float64, error) {
-	v, err := Get(value, q)
+// GetBigInt gets the integer value pointed by the query q as a
+// big.Int. The value can be a JSON number or a string holding a
+// decimal integer. Decode the JSON data with json.Number numbers to
+// preserve the precision of large numbers.
+func GetBigInt(value interface{}, q string, opts ...Option) (*big.Int, error) {
+	o := newOptions(opts)
+	query, err := o.compile(q)
+	if err != nil {
+		return nil, err
+	}
+	return query.getBigInt(o.env(), value)
+}
+
+// GetBigFloat gets the number value pointed by the query q as a
+// big.Float. The value can be a JSON number or a string holding a
+// decimal number.
+func GetBigFloat(value interface{}, q string, opts ...Option) (
+	*big.Float, error) {
+
+	o := newOptions(opts)
+	query, err := o.compile(q)
+	if err != nil {
+		return nil, err
+	}
+	return query.getBigFloat(o.env(), value)
+}
+
+// GetBool gets the boolean value pointed by the query q.
+func GetBool(value interface{}, q string, opts ...Option) (bool, error) {
+	o := newOptions(opts)
+	query, err := o.compile(q)
+	if err != nil {
+		return false, err
+	}
+	return query.getBool(o.env(), value)
+}
+
+// GetJSON gets the value pointed by the query q and marshals it
+// back to JSON.
+func GetJSON(value interface{}, q string, opts ...Option) ([]byte, error) {
+	v, err := Get(value, q, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// Get gets the values pointed by the query q.
+func Get(value interface{}, q string, opts ...Option) (interface{}, error) {
+	o := newOptions(opts)
+	query, err := o.compile(q)
+	if err != nil {
+		return nil, err
+	}
+	return query.eval(o.env(), value)
+}
+
+// GetString gets the string value pointed by the query.
+func (q *Query) GetString(value interface{}) (string, error) {
+	return q.getString(nil, value)
+}
+
+func (q *Query) getString(e *env, value interface{}) (string, error) {
+	e = e.withOptions(q.opts)
+	v, err := q.eval(e, value)
+	if err != nil {
+		return "", err
+	}
+	return e.stringOf(q.String(), v)
+}
+
+// stringOf converts the value v of the query q to string.
+func (e *env) stringOf(q string, v interface{}) (string, error) {
+	val, ok := e.options().stringValue(v)
+	if !ok {
+		return "", &TypeError{
+			Query: q,
+			Want:  "string",
+			Got:   typeName(v),
+		}
+	}
+	return val, nil
+}
+
+// GetNumber gets the float64 number value pointed by the query.
+func (q *Query) GetNumber(value interface{}) (float64, error) {
+	return q.getNumber(nil, value)
+}
+
+func (q *Query) getNumber(e *env, value interface{}) (float64, error) {
+	e = e.withOptions(q.opts)
+	v, err := q.eval(e, value)
 	if err != nil {
 		return 0, err
 	}
-	switch val := v.(type) {
-	case float64:
-		return val, nil
+	return e.numberOf(q.String(), v)
+}
 
-	default:
-		return 0, fmt.Errorf("jsonq: value of '%s' is not float64: %T", q, val)
+// numberOf converts the value v of the query q to float64.
+func (e *env) numberOf(q string, v interface{}) (float64, error) {
+	val, ok, err := e.options().numberValue(v)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, &TypeError{
+			Query: q,
+			Want:  "number",
+			Got:   typeName(v),
+		}
 	}
+	return val, nil
 }
 
-// GetInt gets the integer number value pointed by query q. The
+// GetInt gets the integer number value pointed by the query. The
 // function internally gets the value as number and casts it to int
 // type.
-func GetInt(value interface{}, q string) (int, error) {
-	v, err := GetNumber(value, q)
+func (q *Query) GetInt(value interface{}) (int, error) {
+	return q.getInt(nil, value)
+}
+
+func (q *Query) getInt(e *env, value interface{}) (int, error) {
+	e = e.withOptions(q.opts)
+	v, err := q.eval(e, value)
 	if err != nil {
 		return 0, err
 	}
-	return int(v), nil
+	return e.intOf(q.String(), v)
 }
 
-// GetBool gets the boolean value pointed by the query q.
-func GetBool(value interface{}, q string) (bool, error) {
-	v, err := Get(value, q)
+// intOf converts the value v of the query q to int.
+func (e *env) intOf(q string, v interface{}) (int, error) {
+	num, err := e.numberOf(q, v)
+	if err != nil {
+		return 0, err
+	}
+	val, ok := e.options().intValue(num)
+	if !ok {
+		return 0, &TypeError{
+			Query: q,
+			Want:  "int",
+			Got:   "number",
+		}
+	}
+	return val, nil
+}
+
+// GetBigInt gets the integer value pointed by the query as a
+// big.Int. See the GetBigInt function for details.
+func (q *Query) GetBigInt(value interface{}) (*big.Int, error) {
+	return q.getBigInt(nil, value)
+}
+
+func (q *Query) getBigInt(e *env, value interface{}) (*big.Int, error) {
+	v, err := q.eval(e, value)
+	if err != nil {
+		return nil, err
+	}
+	return bigIntOf(q.String(), v)
+}
+
+// bigIntOf converts the value v of the query q to big.Int.
+func bigIntOf(q string, v interface{}) (*big.Int, error) {
+	val, ok := bigIntValue(v)
+	if !ok {
+		return nil, &TypeError{
+			Query: q,
+			Want:  "int",
+			Got:   typeName(v),
+		}
+	}
+	return val, nil
+}
+
+// GetBigFloat gets the number value pointed by the query as a
+// big.Float. See the GetBigFloat function for details.
+func (q *Query) GetBigFloat(value interface{}) (*big.Float, error) {
+	return q.getBigFloat(nil, value)
+}
+
+func (q *Query) getBigFloat(e *env, value interface{}) (*big.Float, error) {
+	v, err := q.eval(e, value)
+	if err != nil {
+		return nil, err
+	}
+	return bigFloatOf(q.String(), v)
+}
+
+// bigFloatOf converts the value v of the query q to big.Float.
+func bigFloatOf(q string, v interface{}) (*big.Float, error) {
+	val, ok := bigFloatValue(v)
+	if !ok {
+		return nil, &TypeError{
+			Query: q,
+			Want:  "number",
+			Got:   typeName(v),
+		}
+	}
+	return val, nil
+}
+
+// GetBool gets the boolean value pointed by the query.
+func (q *Query) GetBool(value interface{}) (bool, error) {
+	return q.getBool(nil, value)
+}
+
+func (q *Query) getBool(e *env, value interface{}) (bool, error) {
+	e = e.withOptions(q.opts)
+	v, err := q.eval(e, value)
 	if err != nil {
 		return false, err
 	}
-	switch val := v.(type) {
-	case bool:
-		return val, nil
+	return e.boolOf(q.String(), v)
+}
 
-	default:
-		return false, fmt.Errorf("jsonq: value of '%s' is not bool: %T", q, val)
+// boolOf converts the value v of the query q to bool.
+func (e *env) boolOf(q string, v interface{}) (bool, error) {
+	val, ok := e.options().boolValue(v)
+	if !ok {
+		return false, &TypeError{
+			Query: q,
+			Want:  "bool",
+			Got:   typeName(v),
+		}
 	}
+	return val, nil
 }
 
-// Get gets the values pointed by the query q.
-func Get(value interface{}, q string) (interface{}, error) {
-	query, err := parse(q)
+// GetJSON gets the value pointed by the query and marshals it back
+// to JSON.
+func (q *Query) GetJSON(value interface{}) ([]byte, error) {
+	v, err := q.Eval(value)
 	if err != nil {
 		return nil, err
 	}
-	return query.Eval(value)
+	return json.Marshal(v)
+}
+
+// stringValue converts the JSON value v to string. The null value is
+// converted to an empty string.
+func stringValue(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+
+	case nil:
+		return "", true
+
+	default:
+		return "", false
+	}
+}
+
+// numberValue converts the JSON number value v to float64.
+func numberValue(v interface{}) (float64, bool, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, true, nil
+
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil {
+			return 0, false, err
+		}
+		return f, true, nil
+
+	case *big.Int, big.Int, *big.Float, big.Float:
+		n, ok := toNumber(val)
+		if !ok {
+			return 0, false, nil
+		}
+		f, _ := n.bigFloat().Float64()
+		return f, true, nil
+
+	default:
+		return 0, false, nil
+	}
 }
@@ -0,0 +1,198 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompileGJSON compiles a gjson path into a Query. The function
+// supports the gjson path syntax for selecting values:
+//
+//   - keys separated with dots: issue.fields.summary, with the
+//     special characters escaped with backslash: fields.a\.b
+//   - array indices: items.0
+//   - all array elements: items.#.toString
+//   - the first matching element: items.#(fieldId=="assignee")
+//   - all matching elements: items.#(priority>=10)#
+//
+// The conditions of the queries have the jsonq filter syntax, which
+// is compatible with the gjson conditions that compare a key to a
+// string, number, boolean, or null value. The numeric keys always
+// index arrays, and the indices and the first matching elements are
+// selected as single element arrays, like with the jsonq filters. The
+// wildcards, modifiers, multipaths, pipes, and the array length # are
+// not supported. For example, the gjson path
+//
+//	issue.changelog.items.#(fieldId=="assignee").toString
+//
+// is equivalent to the query
+//
+//	issue.changelog.items[fieldId=="assignee"][0].toString
+func CompileGJSON(path string) (*Query, error) {
+	q, err := parseGJSON(path)
+	if err != nil {
+		return nil, err
+	}
+	return newQuery(path, q), nil
+}
+
+// TranslateGJSON translates the gjson path into the equivalent query
+// string. See CompileGJSON for the supported syntax.
+func TranslateGJSON(path string) (string, error) {
+	q, err := parseGJSON(path)
+	if err != nil {
+		return "", err
+	}
+	return q.format(), nil
+}
+
+func parseGJSON(path string) (*query, error) {
+	err := checkLength(path)
+	if err != nil {
+		return nil, err
+	}
+	var q *query
+	for pos := 0; ; pos++ {
+		if pos >= len(path) {
+			return nil, gjsonError(path, pos, "key")
+		}
+		if path[pos] == '#' {
+			q, pos, err = parseGJSONArray(path, pos, q)
+		} else {
+			q, pos, err = parseGJSONKey(path, pos, q)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if pos >= len(path) {
+			break
+		}
+		if path[pos] != '.' {
+			return nil, gjsonError(path, pos, "'.'")
+		}
+	}
+	err = q.checkDepth()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parseGJSONKey parses the key starting at the position pos of the
+// path. It returns the position following the key.
+func parseGJSONKey(path string, pos int, q *query) (*query, int, error) {
+	start := pos
+	var sb strings.Builder
+	for ; pos < len(path) && path[pos] != '.'; pos++ {
+		ch := path[pos]
+		switch ch {
+		case '\\':
+			pos++
+			if pos >= len(path) {
+				return nil, pos, gjsonError(path, pos, "escaped character")
+			}
+			sb.WriteByte(path[pos])
+
+		case '*', '?':
+			return nil, pos, fmt.Errorf("jsonq: gjson wildcards not supported")
+
+		case '@', '|', '{', '[', '!':
+			if pos == start || ch == '|' {
+				return nil, pos,
+					fmt.Errorf("jsonq: gjson '%c' paths not supported", ch)
+			}
+			sb.WriteByte(ch)
+
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	if pos == start {
+		return nil, pos, gjsonError(path, pos, "key")
+	}
+	key := sb.String()
+	if q != nil && isGJSONIndex(path[start:pos]) {
+		index, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, pos, fmt.Errorf("jsonq: array index %s out of range",
+				key)
+		}
+		q.filters = append(q.filters, &comparative{
+			Left: &atom{
+				Type:   tInt,
+				IntVal: index,
+			},
+			Op: tInt,
+		})
+		return q, pos, nil
+	}
+	return &query{
+		left: q,
+		key:  key,
+	}, pos, nil
+}
+
+// isGJSONIndex tests if the path component is an array index.
+func isGJSONIndex(component string) bool {
+	for i := 0; i < len(component); i++ {
+		if component[i] < '0' || component[i] > '9' {
+			return false
+		}
+	}
+	return len(component) > 0
+}
+
+// parseGJSONArray parses the array component, starting with '#', at
+// the position pos of the path. It returns the position following the
+// component.
+func parseGJSONArray(path string, pos int, q *query) (*query, int, error) {
+	if q == nil {
+		return nil, pos, fmt.Errorf("jsonq: gjson root array not supported")
+	}
+	pos++
+	if pos >= len(path) {
+		return nil, pos, fmt.Errorf("jsonq: gjson array length not supported")
+	}
+	if path[pos] == '.' {
+		q.filters = append(q.filters, &all{})
+		return q, pos, nil
+	}
+	if path[pos] != '(' {
+		return nil, pos, gjsonError(path, pos, "'.' or '('")
+	}
+	pos++
+	lexer := newLexer(path[pos:])
+	f, err := parseExpr(lexer, token{Type: tRParen})
+	if err != nil {
+		return nil, pos, err
+	}
+	pos += lexer.pos
+	q.filters = append(q.filters, f)
+	if pos < len(path) && path[pos] == '#' {
+		pos++
+	} else {
+		q.filters = append(q.filters, &comparative{
+			Left: &atom{
+				Type: tInt,
+			},
+			Op: tInt,
+		})
+	}
+	return q, pos, nil
+}
+
+func gjsonError(path string, pos int, expected string) error {
+	if pos >= len(path) {
+		return fmt.Errorf("jsonq: gjson path '%s': unexpected end of path, expected %s",
+			path, expected)
+	}
+	return fmt.Errorf("jsonq: gjson path '%s': unexpected '%c' at offset %d, expected %s",
+		path, path[pos], pos, expected)
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+var gjsonTests = []struct {
+	path     string
+	query    string
+	expected string
+}{
+	{`issue.key`, `issue.key`, `"OP-1"`},
+	{`issue.fields.project.name`, `issue.fields.project.name`,
+		`"Operations"`},
+	{`issue.changelog.items.1.toString`, `issue.changelog.items[1].toString`,
+		`["Veijo Linux"]`},
+	{`issue.changelog.items.#.fieldId`, `issue.changelog.items[].fieldId`,
+		`["status","assignee","assignee"]`},
+	{`issue.changelog.items.#(fieldId=="assignee").toString`,
+		`issue.changelog.items[fieldId == "assignee"][0].toString`,
+		`["Veijo Linux"]`},
+	{`issue.changelog.items.#(priority<=10)#.toString`,
+		`issue.changelog.items[priority <= 10].toString`,
+		`["Veijo Linux","Milton Waddams"]`},
+	{`issue.changelog.items.#(fieldId=="assignee" && fromString!=null)#.toString`,
+		`issue.changelog.items[fieldId == "assignee" && fromString != null].toString`,
+		`["Milton Waddams"]`},
+	{`issue_event_type_name`, `issue_event_type_name`, `"issue_assigned"`},
+}
+
+func TestCompileGJSON(t *testing.T) {
+	v := parseAssign(t)
+
+	for _, test := range gjsonTests {
+		q, err := CompileGJSON(test.path)
+		if err != nil {
+			t.Fatalf("CompileGJSON(%s) failed: %s", test.path, err)
+		}
+		data, err := q.GetJSON(v)
+		if err != nil {
+			t.Fatalf("GetJSON(%s) failed: %s", test.path, err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.path, data, test.expected)
+		}
+		query, err := TranslateGJSON(test.path)
+		if err != nil {
+			t.Fatalf("TranslateGJSON(%s) failed: %s", test.path, err)
+		}
+		if query != test.query {
+			t.Errorf("TranslateGJSON(%s): got %s, expected %s",
+				test.path, query, test.query)
+		}
+	}
+
+	query, err := TranslateGJSON(`fields.a\.b.c-d`)
+	if err != nil {
+		t.Fatalf("TranslateGJSON failed: %s", err)
+	}
+	if query != `fields."a.b"."c-d"` {
+		t.Errorf("TranslateGJSON: got %s", query)
+	}
+
+	for _, path := range []string{
+		``, `.a`, `a.`, `a..b`, `#.a`, `a.#`, `a.b*`, `a.?b`, `@reverse`,
+		`a|b`, `{a,b}`, `a.#(b==1`, `a.#(b)x`, `a.#x`, `a\`,
+	} {
+		_, err := CompileGJSON(path)
+		if err == nil {
+			t.Errorf("CompileGJSON accepted %s", path)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// FieldIndex is a hash index over the values of a field in the elements of
+// a JSON array. The equality filters on the indexed field, for
+// example, items[fieldId=="assignee"], consult the index instead of
+// scanning the whole array when the queries are evaluated with the
+// WithIndex option. The index is invalidated when any document is
+// modified with the Set, SetCreate, Update, Delete, InsertBefore, or
+// InsertAfter functions. If the array or its elements are modified
+// directly, the index must be rebuilt.
+type FieldIndex struct {
+	items    []interface{}
+	field    string
+	modified uint64
+	strings  map[string][]int
+	numbers  map[number][]int
+}
+
+// modifications counts the modifications of all documents made with
+// the modifying functions. The indices built before a modification
+// are not consulted.
+var modifications uint64
+
+// modified invalidates all indices.
+func modified() {
+	atomic.AddUint64(&modifications, 1)
+}
+
+// WithIndex makes the equality filters consult the field indices
+// when they filter the indexed arrays.
+func WithIndex(indices ...*FieldIndex) Option {
+	return func(o *options) {
+		o.indices = append(o.indices, indices...)
+	}
+}
+
+// Index builds a hash index over the field values of the array
+// pointed by the query q. The index is consulted by the queries
+// evaluated with the WithIndex option.
+//
+// The modifications are tracked with a single process-wide counter
+// since the modifying functions don't know which indexed arrays a
+// modification affects. Therefore, modifying any document, including
+// documents unrelated to the indexed array, invalidates all indices
+// and the queries fall back to scanning the arrays. The indices are
+// useful for documents that are queried repeatedly without concurrent
+// modifications; rebuild the index after the modifications.
+func Index(v interface{}, q string, field string) (*FieldIndex, error) {
+	val, err := Get(v, q)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jsonq: value of '%s' is not array: %T", q, val)
+	}
+	fq, err := cachedCompile(field)
+	if err != nil {
+		return nil, err
+	}
+	index := &FieldIndex{
+		items:    arr,
+		field:    field,
+		modified: atomic.LoadUint64(&modifications),
+		strings:  make(map[string][]int),
+		numbers:  make(map[number][]int),
+	}
+
+	// The index is used only if all elements have string values or
+	// all elements have number values so that the index lookups match
+	// the filter semantics exactly.
+	allStrings := true
+	allNumbers := true
+	for idx, item := range arr {
+		fv, err := fq.Eval(item)
+		if err != nil {
+			allStrings = false
+			allNumbers = false
+			break
+		}
+		if str, ok := stringValue(fv); ok && allStrings {
+			index.strings[str] = append(index.strings[str], idx)
+		} else {
+			allStrings = false
+		}
+		if num, ok := toNumber(fv); ok && allNumbers {
+			num = num.canonical()
+			index.numbers[num] = append(index.numbers[num], idx)
+		} else {
+			allNumbers = false
+		}
+	}
+	if !allStrings {
+		index.strings = nil
+	}
+	if !allNumbers {
+		index.numbers = nil
+	}
+
+	return index, nil
+}
+
+// indexes tests if the index is a valid index of the field in the
+// items array.
+func (index *FieldIndex) indexes(items []interface{}, field string) bool {
+	return index.field == field && len(index.items) == len(items) &&
+		len(items) > 0 && &index.items[0] == &items[0] &&
+		index.modified == atomic.LoadUint64(&modifications)
+}
+
+// lookupIndex finds the indices of the items matching the query's
+// first filter from the hash index of the items array. The function
+// returns false if the items do not have a suitable index.
+func (q *query) lookupIndex(e *env, items []interface{}) ([]int, bool) {
+	o := e.options()
+	if o == nil || len(o.indices) == 0 || len(items) == 0 ||
+		len(q.filters) == 0 || !e.defaultCompare() {
+		return nil, false
+	}
+	c, ok := q.filters[0].(*comparative)
+	if !ok || c.Op != tEq || c.Left.Type != tString || c.Right == nil {
+		return nil, false
+	}
+	var index *FieldIndex
+	for _, idx := range o.indices {
+		if idx.indexes(items, c.Left.StrVal) {
+			index = idx
+			break
+		}
+	}
+	if index == nil {
+		return nil, false
+	}
+	switch c.Right.Type {
+	case tString:
+		if index.strings == nil {
+			return nil, false
+		}
+		return index.strings[c.Right.StrVal], true
+
+	case tInt:
+		if index.numbers == nil {
+			return nil, false
+		}
+		return index.numbers[c.Right.number().canonical()], true
+
+	default:
+		return nil, false
+	}
+}
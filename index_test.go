@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	v := parseAssign(t)
+
+	queries := []string{
+		`issue.changelog.items[fieldId=="assignee"].toString`,
+		`issue.changelog.items[fieldId=="assignee"][1].toString`,
+		`issue.changelog.items[fieldId=="none"]`,
+		`issue.changelog.items[priority==10].toString`,
+	}
+	var expected []string
+	for _, q := range queries {
+		data, err := GetJSON(v, q)
+		if err != nil {
+			t.Fatalf("GetJSON failed: %s", err)
+		}
+		expected = append(expected, string(data))
+	}
+
+	byField, err := Index(v, "issue.changelog.items", "fieldId")
+	if err != nil {
+		t.Fatalf("Index failed: %s", err)
+	}
+	byPriority, err := Index(v, "issue.changelog.items", "priority")
+	if err != nil {
+		t.Fatalf("Index failed: %s", err)
+	}
+	withIndex := WithIndex(byField, byPriority)
+
+	q, err := Compile(queries[0], withIndex)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	arr, _ := Get(v, "issue.changelog.items")
+	idx, ok := q.q.left.lookupIndex(newEnv(nil).withOptions(q.opts),
+		arr.([]interface{}))
+	if !ok || len(idx) != 2 {
+		t.Errorf("index not used: %v %v", idx, ok)
+	}
+	_, ok = q.q.left.lookupIndex(nil, arr.([]interface{}))
+	if ok {
+		t.Errorf("index used without WithIndex")
+	}
+
+	for i, q := range queries {
+		data, err := GetJSON(v, q, withIndex)
+		if err != nil {
+			t.Fatalf("GetJSON failed: %s", err)
+		}
+		if string(data) != expected[i] {
+			t.Errorf("indexed %s: got %s, expected %s", q, data, expected[i])
+		}
+	}
+
+	// The index does not apply to other arrays of the same length.
+	other := parseAssign(t)
+	err = Set(other, `issue.changelog.items[0].fieldId`, "assignee")
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	byField, err = Index(v, "issue.changelog.items", "fieldId")
+	if err != nil {
+		t.Fatalf("Index failed: %s", err)
+	}
+	data, err := GetJSON(other, queries[0], WithIndex(byField))
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	if string(data) != `["development","Veijo Linux","Milton Waddams"]` {
+		t.Errorf("indexed other %s: got %s", queries[0], data)
+	}
+
+	_, err = Index(v, "issue.key", "fieldId")
+	if err == nil {
+		t.Errorf("Index accepted non-array value")
+	}
+}
+
+func TestIndexModified(t *testing.T) {
+	v := parseAssign(t)
+	index, err := Index(v, "issue.changelog.items", "fieldId")
+	if err != nil {
+		t.Fatalf("Index failed: %s", err)
+	}
+	err = Set(v, `issue.changelog.items[priority==100].fieldId`, "assignee")
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	q := `issue.changelog.items[fieldId=="status"]`
+	data, err := GetJSON(v, q, WithIndex(index))
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	if string(data) != "[]" {
+		t.Errorf("stale index %s: got %s, expected []", q, data)
+	}
+
+	index, err = Index(v, "issue.changelog.items", "fieldId")
+	if err != nil {
+		t.Fatalf("Index failed: %s", err)
+	}
+	err = Delete(v, `issue.changelog.items[0]`)
+	if err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	arr, _ := Get(v, "issue.changelog.items")
+	items := arr.([]interface{})
+	if index.indexes(items, "fieldId") {
+		t.Errorf("index valid after Delete")
+	}
+}
+
+func TestIndexPolicies(t *testing.T) {
+	v := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"f": "a"},
+			map[string]interface{}{"f": nil},
+		},
+	}
+	index, err := Index(v, "items", "f")
+	if err != nil {
+		t.Fatalf("Index failed: %s", err)
+	}
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"NullDefault", WithNullValues(NullDefault)},
+		{"NullFalse", WithNullValues(NullFalse)},
+		{"NullEqual", WithNullValues(NullEqual)},
+		{"NullError", WithNullValues(NullError)},
+		{"Strict", WithStrictness(Strict)},
+		{"Lenient", WithStrictness(Lenient)},
+	}
+	q := `items[f==""]`
+	for _, test := range tests {
+		expected, expectedErr := GetJSON(v, q, test.opt)
+		data, err := GetJSON(v, q, test.opt, WithIndex(index))
+		if (err == nil) != (expectedErr == nil) ||
+			string(data) != string(expected) {
+			t.Errorf("%s: indexed %s: got %s/%v, expected %s/%v",
+				test.name, q, data, err, expected, expectedErr)
+		}
+	}
+}
+
+func BenchmarkIndex(b *testing.B) {
+	var items []interface{}
+	for i := 0; i < 10000; i++ {
+		items = append(items, map[string]interface{}{
+			"id": fmt.Sprintf("id%d", i),
+		})
+	}
+	v := map[string]interface{}{
+		"items": items,
+	}
+	index, err := Index(v, "items", "id")
+	if err != nil {
+		b.Fatalf("Index failed: %s", err)
+	}
+	q, err := Compile(`items[id=="id5000"]`, WithIndex(index))
+	if err != nil {
+		b.Fatalf("Compile failed: %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = q.Eval(v)
+		if err != nil {
+			b.Fatalf("Eval failed: %s", err)
+		}
+	}
+}
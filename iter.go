@@ -0,0 +1,354 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+// Iterator iterates over query results. The iterator evaluates the
+// query filters lazily so that the elements after the last consumed
+// result are not evaluated.
+type Iterator struct {
+	src  source
+	err  error
+	done bool
+}
+
+// Iter returns an iterator over the query results for the value v. If
+// the query selects a single value, the iterator returns that value.
+func (q *Query) Iter(v interface{}) *Iterator {
+	e := (*env)(nil).withOptions(q.opts)
+	if q.x != nil {
+		return &Iterator{
+			src: evalSource(e, q.x, v),
+		}
+	}
+	return &Iterator{
+		src: q.q.iter(e, v),
+	}
+}
+
+// Next returns the next query result. The boolean return value is
+// false when the iteration is done or when an error occurred. Use Err
+// to check if the iteration stopped because of an error.
+func (it *Iterator) Next() (interface{}, bool) {
+	if it.done {
+		return nil, false
+	}
+	v, ok, err := it.src.next()
+	if err != nil {
+		it.err = err
+	}
+	if !ok || err != nil {
+		it.done = true
+		return nil, false
+	}
+	return normalize(v), true
+}
+
+// Err returns the error that stopped the iteration, or nil if the
+// iteration has not failed.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// source is a pull-based stream of values.
+type source interface {
+	next() (interface{}, bool, error)
+}
+
+// errorSource returns the error on the first call to next.
+type errorSource struct {
+	err error
+}
+
+func (s *errorSource) next() (interface{}, bool, error) {
+	return nil, false, s.err
+}
+
+// sliceSource returns the items of a slice.
+type sliceSource struct {
+	items []interface{}
+	pos   int
+}
+
+func (s *sliceSource) next() (interface{}, bool, error) {
+	if s.pos >= len(s.items) {
+		return nil, false, nil
+	}
+	item := s.items[s.pos]
+	s.pos++
+	return item, true, nil
+}
+
+// itemSource returns the items at the positions of its input
+// positions.
+type itemSource struct {
+	items []interface{}
+	in    positions
+}
+
+func (s *itemSource) next() (interface{}, bool, error) {
+	pos, ok, err := s.in.next()
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	return s.items[pos], true, nil
+}
+
+// positions is a pull-based stream of positions into an items array.
+type positions interface {
+	next() (int, bool, error)
+}
+
+// rangePositions returns the positions 0...n-1.
+type rangePositions struct {
+	n   int
+	pos int
+}
+
+func (p *rangePositions) next() (int, bool, error) {
+	if p.pos >= p.n {
+		return 0, false, nil
+	}
+	pos := p.pos
+	p.pos++
+	return pos, true, nil
+}
+
+// slicePositions returns the positions of a slice.
+type slicePositions struct {
+	positions []int
+	pos       int
+}
+
+func (p *slicePositions) next() (int, bool, error) {
+	if p.pos >= len(p.positions) {
+		return 0, false, nil
+	}
+	pos := p.positions[p.pos]
+	p.pos++
+	return pos, true, nil
+}
+
+// filterPositions returns the positions of its input positions whose
+// items match the filter. The filter index is the position's order in
+// the input positions. If the filter is an index filter, the
+// positions stop after the filter's index so that the rest of the
+// input is not evaluated.
+type filterPositions struct {
+	env   *env
+	q     *query
+	in    positions
+	items []interface{}
+	f     filter
+	idx   int
+	limit int
+}
+
+func newFilterPositions(e *env, q *query, in positions,
+	items []interface{}, f filter) *filterPositions {
+
+	limit := -1
+	c, ok := f.(*comparative)
+	if ok && c.Op == tInt {
+		limit = c.Left.IntVal
+	}
+	return &filterPositions{
+		env:   e,
+		q:     q,
+		in:    in,
+		items: items,
+		f:     f,
+		limit: limit,
+	}
+}
+
+func (p *filterPositions) next() (int, bool, error) {
+	for {
+		if p.limit >= 0 && p.idx > p.limit {
+			return 0, false, nil
+		}
+		err := p.env.check()
+		if err != nil {
+			return 0, false, err
+		}
+		pos, ok, err := p.in.next()
+		if !ok || err != nil {
+			return 0, false, err
+		}
+		idx := p.idx
+		p.idx++
+		match, err := p.env.evalFilter(p.f, idx, p.items[pos])
+		if err == errSkipElement {
+			match = false
+			err = nil
+		}
+		if err != nil {
+			return 0, false, &FilterError{
+				Query: p.q.String(),
+				Index: pos,
+				Err:   err,
+			}
+		}
+		p.env.traceFilter(p.f, pos, match)
+		if match {
+			return pos, true, nil
+		}
+	}
+}
+
+// typeSource checks that the items of its input source have the
+// query's asserted type.
+type typeSource struct {
+	in source
+	q  *query
+}
+
+func (s *typeSource) next() (interface{}, bool, error) {
+	v, ok, err := s.in.next()
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	err = s.q.checkType(v)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
+
+// flatSource evaluates the query segment for each item of its input
+// source and returns the flattened results.
+type flatSource struct {
+	env     *env
+	in      source
+	q       *query
+	current source
+}
+
+func (s *flatSource) next() (interface{}, bool, error) {
+	for {
+		if s.current != nil {
+			v, ok, err := s.current.next()
+			if ok || err != nil {
+				return v, ok, err
+			}
+			s.current = nil
+		}
+		item, ok, err := s.in.next()
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		src, err := s.q.segmentSource(s.env, item)
+		if err == ErrorOptionalMissing {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		s.current = src
+	}
+}
+
+// evalSource evaluates the expression x eagerly and returns a source
+// for its results.
+func evalSource(e *env, x expr, v interface{}) source {
+	val, err := x.eval(e, v)
+	if err != nil {
+		return &errorSource{
+			err: err,
+		}
+	}
+	if arr, ok := val.([]interface{}); ok && x.selects() {
+		return &sliceSource{
+			items: arr,
+		}
+	}
+	return &sliceSource{
+		items: []interface{}{val},
+	}
+}
+
+// iter returns a source for the query results. The segments before
+// the first selecting segment are evaluated eagerly and the rest are
+// chained as lazy sources.
+func (q *query) iter(e *env, v interface{}) source {
+	var buf [16]*query
+	var src source
+	var err error
+
+	segments := q.appendSegments(buf[:0])
+	for idx, s := range segments {
+		switch {
+		case src != nil:
+			src = &flatSource{
+				env: e,
+				in:  src,
+				q:   s,
+			}
+
+		case len(s.filters) > 0 || idx == len(segments)-1:
+			src, err = s.segmentSource(e, v)
+
+		default:
+			v, err = s.evalSegment(e, v)
+		}
+		if err != nil {
+			return &errorSource{
+				err: err,
+			}
+		}
+	}
+	if len(q.typ) > 0 {
+		src = &typeSource{
+			in: src,
+			q:  q,
+		}
+	}
+	return src
+}
+
+// segmentSource returns a source for the query segment's results for
+// the value v.
+func (q *query) segmentSource(e *env, v interface{}) (source, error) {
+	child, err := q.child(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.filters) == 0 {
+		return &sliceSource{
+			items: []interface{}{child},
+		}, nil
+	}
+	items, ok := arrayValue(child)
+	if !ok {
+		items = []interface{}{child}
+	}
+	return &itemSource{
+		items: items,
+		in:    q.positions(e, items),
+	}, nil
+}
+
+// positions returns the positions of the items matching the query
+// filters.
+func (q *query) positions(e *env, items []interface{}) positions {
+	filters := q.filters
+	var in positions
+	indices, ok := q.lookupIndex(e, items)
+	if ok {
+		in = &slicePositions{
+			positions: indices,
+		}
+		filters = filters[1:]
+	} else {
+		in = &rangePositions{
+			n: len(items),
+		}
+	}
+	for _, f := range filters {
+		in = newFilterPositions(e, q, in, items, f)
+	}
+	return in
+}
@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	v := parseAssign(t)
+
+	for _, q := range []string{
+		`issue.key`,
+		`issue.changelog.items[fieldId=="assignee"]`,
+		`issue.changelog.items[fieldId=="assignee"][1].toString`,
+		`issue.changelog.items[].?missing`,
+		`issue.changelog.items[priority==10].fieldId`,
+	} {
+		query, err := Compile(q)
+		if err != nil {
+			t.Fatalf("Compile failed: %s", err)
+		}
+		expected, err := query.Eval(v)
+		if err != nil {
+			t.Fatalf("Eval failed: %s", err)
+		}
+		if _, ok := expected.([]interface{}); !ok {
+			expected = []interface{}{expected}
+		}
+		result := []interface{}{}
+		it := query.Iter(v)
+		for {
+			item, ok := it.Next()
+			if !ok {
+				break
+			}
+			result = append(result, item)
+		}
+		if it.Err() != nil {
+			t.Fatalf("Iter failed: %s", it.Err())
+		}
+		if marshal(t, result) != marshal(t, expected) {
+			t.Errorf("Iter(%s): got %v, expected %v", q, result, expected)
+		}
+	}
+
+	query, err := Compile(`issue.changelog.items[].missing`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	it := query.Iter(v)
+	_, ok := it.Next()
+	if ok || it.Err() == nil {
+		t.Errorf("Iter did not fail with missing element")
+	}
+}
+
+func TestIterLazy(t *testing.T) {
+	var items []interface{}
+	for i := 0; i < 100; i++ {
+		items = append(items, map[string]interface{}{
+			"id": float64(i),
+		})
+	}
+	v := map[string]interface{}{
+		"items": items,
+	}
+	var evaluated int
+	query, err := Compile(`items[id>=10]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	query.q.filters[0] = &countingFilter{
+		filter: query.q.filters[0],
+		count:  &evaluated,
+	}
+	it := query.Iter(v)
+	item, ok := it.Next()
+	if !ok {
+		t.Fatalf("Iter returned no items: %v", it.Err())
+	}
+	if marshal(t, item) != `{"id":10}` {
+		t.Errorf("Iter: got %v", item)
+	}
+	if evaluated != 11 {
+		t.Errorf("Iter evaluated %v elements, expected 11", evaluated)
+	}
+}
+
+func TestEvalEarlyExit(t *testing.T) {
+	var items []interface{}
+	for i := 0; i < 100; i++ {
+		items = append(items, map[string]interface{}{
+			"id": float64(i),
+		})
+	}
+	v := map[string]interface{}{
+		"items": items,
+	}
+	var evaluated int
+	query, err := Compile(`items[id>=10][2].id`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	query.q.left.filters[0] = &countingFilter{
+		filter: query.q.left.filters[0],
+		count:  &evaluated,
+	}
+	result, err := query.Eval(v)
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if marshal(t, result) != `[12]` {
+		t.Errorf("Eval: got %v, expected [12]", result)
+	}
+	if evaluated != 13 {
+		t.Errorf("Eval evaluated %v elements, expected 13", evaluated)
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	var items []interface{}
+	for i := 0; i < 10000; i++ {
+		items = append(items, map[string]interface{}{
+			"id": float64(i),
+		})
+	}
+	v := map[string]interface{}{
+		"items": items,
+	}
+	query, err := Compile(`items[id>=0]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var evaluated int
+	query.q.filters[0] = &cancelFilter{
+		filter: query.q.filters[0],
+		count:  &evaluated,
+		after:  100,
+		cancel: cancel,
+	}
+	_, err = query.EvalContext(ctx, v)
+	if err != context.Canceled {
+		t.Errorf("EvalContext: expected context.Canceled, got %v", err)
+	}
+	if evaluated >= len(items) {
+		t.Errorf("EvalContext evaluated all %d elements", evaluated)
+	}
+
+	_, err = Ctx(v).SelectContext(ctx, `items[id>=0]`).Count()
+	if err != context.Canceled {
+		t.Errorf("SelectContext: expected context.Canceled, got %v", err)
+	}
+	n, err := Ctx(v).SelectContext(context.Background(), `items[id>=0]`).
+		Count()
+	if err != nil || n != len(items) {
+		t.Errorf("SelectContext: got %v %v, expected %v", n, err, len(items))
+	}
+}
+
+type cancelFilter struct {
+	filter
+	count  *int
+	after  int
+	cancel func()
+}
+
+func (f *cancelFilter) Eval(e *env, idx int, v interface{}) (bool, error) {
+	*f.count++
+	if *f.count == f.after {
+		f.cancel()
+	}
+	return f.filter.Eval(e, idx, v)
+}
+
+type countingFilter struct {
+	filter
+	count *int
+}
+
+func (f *countingFilter) Eval(e *env, idx int, v interface{}) (bool, error) {
+	*f.count++
+	return f.filter.Eval(e, idx, v)
+}
+
+func ExampleQuery_Iter() {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		panic(err)
+	}
+	q, err := Compile(`issue.changelog.items[fieldId=="assignee"].toString`)
+	if err != nil {
+		panic(err)
+	}
+	it := q.Iter(v)
+	for {
+		to, ok := it.Next()
+		if !ok {
+			break
+		}
+		fmt.Println(to)
+	}
+	// Output: Veijo Linux
+	// Milton Waddams
+}
@@ -0,0 +1,347 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"io"
+)
+
+// CompileJQ compiles a jq expression into a Query. The function
+// supports a practical subset of the jq syntax:
+//
+//   - paths: .issue.key, ."key", .["key"], and optional .key?
+//   - array iteration and indexing: .items[] and .items[0]
+//   - pipes: .issue | .key
+//   - select with comparisons combined with and and or:
+//     select(.fieldId=="assignee" and .priority>=10)
+//
+// The comparisons of missing paths in select evaluate to false. The
+// recursive descent .. is not supported.
+//
+// For example, the jq expression
+//
+//	.issue.changelog.items[] | select(.fieldId=="assignee") | .toString
+//
+// is equivalent to the query
+//
+//	issue.changelog.items[fieldId=="assignee"].toString
+func CompileJQ(expr string) (*Query, error) {
+	err := checkLength(expr)
+	if err != nil {
+		return nil, err
+	}
+	lexer := newLexer(expr)
+	var q *query
+	for {
+		q, err = parseJQStage(lexer, q)
+		if err != nil {
+			return nil, err
+		}
+		t, err := lexer.Get()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+		if t.Type != tPipe {
+			return nil, lexer.SyntaxError("'|' or end of expression")
+		}
+	}
+	if q == nil {
+		return nil, fmt.Errorf("jsonq: jq expression '%s' selects the root value",
+			expr)
+	}
+	err = q.checkDepth()
+	if err != nil {
+		return nil, err
+	}
+	return newQuery(expr, q), nil
+}
+
+func parseJQStage(lexer *lexer, q *query) (*query, error) {
+	t, err := lexer.Expect("path or select")
+	if err != nil {
+		return nil, err
+	}
+	switch t.Type {
+	case tDot:
+		lexer.Unget(t)
+		return parseJQPath(lexer, q)
+
+	case tString:
+		if t.StrVal != "select" {
+			return nil, fmt.Errorf("jsonq: jq function '%s' not supported",
+				t.StrVal)
+		}
+		if q == nil {
+			return nil, fmt.Errorf("jsonq: jq select of root value not supported")
+		}
+		err = expectToken(lexer, tLParen)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parseJQCondition(lexer)
+		if err != nil {
+			return nil, err
+		}
+		err = expectToken(lexer, tRParen)
+		if err != nil {
+			return nil, err
+		}
+		q.filters = append(q.filters, f)
+		return q, nil
+
+	default:
+		return nil, lexer.SyntaxError("path or select")
+	}
+}
+
+func parseJQPath(lexer *lexer, q *query) (*query, error) {
+	for first := true; ; first = false {
+		t, err := lexer.Get()
+		if err != nil {
+			if err == io.EOF {
+				return q, nil
+			}
+			return nil, err
+		}
+		switch t.Type {
+		case tDot:
+			// The dot is followed by a key or by brackets. Only the
+			// identity path . can end at the dot.
+			t, err = lexer.Get()
+			if err != nil {
+				if err == io.EOF && first {
+					return q, nil
+				}
+				if err == io.EOF {
+					return nil, lexer.SyntaxError("key or '['")
+				}
+				return nil, err
+			}
+			switch t.Type {
+			case tString:
+				q = &query{
+					left: q,
+					key:  t.StrVal,
+				}
+
+			case tLBracket, tPipe:
+				if t.Type == tPipe && !first {
+					return nil, lexer.SyntaxError("key or '['")
+				}
+				lexer.Unget(t)
+
+			default:
+				return nil, lexer.SyntaxError("key or '['")
+			}
+
+		case tQuestionMark:
+			if q == nil {
+				return nil, lexer.SyntaxError("path")
+			}
+			q.optional = true
+
+		case tLBracket:
+			if q == nil {
+				return nil, fmt.Errorf("jsonq: jq root array not supported")
+			}
+			t, err = lexer.Expect("']', index, or key")
+			if err != nil {
+				return nil, err
+			}
+			switch t.Type {
+			case tRBracket:
+				q.filters = append(q.filters, &all{})
+				continue
+
+			case tInt:
+				if t.Big != nil {
+					return nil, fmt.Errorf("jsonq: array index %s out of range",
+						t.Big)
+				}
+				q.filters = append(q.filters, &comparative{
+					Left: &atom{
+						Type:   tInt,
+						IntVal: t.Int,
+					},
+					Op: tInt,
+				})
+
+			case tString:
+				q = &query{
+					left: q,
+					key:  t.StrVal,
+				}
+
+			default:
+				return nil, lexer.SyntaxError("']', index, or key")
+			}
+			err = expectToken(lexer, tRBracket)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			lexer.Unget(t)
+			return q, nil
+		}
+	}
+}
+
+func parseJQCondition(lexer *lexer) (filter, error) {
+	left, err := parseJQComparison(lexer)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := lexer.Expect("'and', 'or', or ')'")
+		if err != nil {
+			return nil, err
+		}
+		var op tokenType
+		if t.Type == tString && t.StrVal == "and" {
+			op = tAnd
+		} else if t.Type == tString && t.StrVal == "or" {
+			op = tOr
+		} else {
+			lexer.Unget(t)
+			return left, nil
+		}
+		right, err := parseJQComparison(lexer)
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{
+			Left:  left,
+			Op:    op,
+			Right: right,
+		}
+	}
+}
+
+var mirrorOps = map[tokenType]tokenType{
+	tEq:  tEq,
+	tNeq: tNeq,
+	tLt:  tGt,
+	tLe:  tGe,
+	tGt:  tLt,
+	tGe:  tLe,
+}
+
+func parseJQComparison(lexer *lexer) (filter, error) {
+	left, leftPath, err := parseJQOperand(lexer)
+	if err != nil {
+		return nil, err
+	}
+	t, err := lexer.Expect("comparison operator")
+	if err != nil {
+		return nil, err
+	}
+	op, ok := mirrorOps[t.Type]
+	if !ok {
+		return nil, lexer.SyntaxError("comparison operator")
+	}
+	right, rightPath, err := parseJQOperand(lexer)
+	if err != nil {
+		return nil, err
+	}
+	if leftPath == rightPath {
+		return nil, fmt.Errorf("jsonq: jq comparison must compare a path to a literal")
+	}
+	if rightPath {
+		return &comparative{
+			Left:  right,
+			Op:    op,
+			Right: left,
+		}, nil
+	}
+	return &comparative{
+		Left:  left,
+		Op:    t.Type,
+		Right: right,
+	}, nil
+}
+
+// parseJQOperand parses a comparison operand. The path return value
+// tells if the operand is a path or a literal value.
+func parseJQOperand(lexer *lexer) (*atom, bool, error) {
+	t, err := lexer.Expect("path, string, or integer")
+	if err != nil {
+		return nil, false, err
+	}
+	switch t.Type {
+	case tDot:
+		var q *query
+		for {
+			t, err = lexer.Expect("key")
+			if err != nil {
+				return nil, false, err
+			}
+			if t.Type != tString {
+				return nil, false, lexer.SyntaxError("key")
+			}
+			q = &query{
+				left: q,
+				key:  t.StrVal,
+			}
+
+			t, err = lexer.Expect("')'")
+			if err != nil {
+				return nil, false, err
+			}
+			if t.Type != tDot {
+				lexer.Unget(t)
+				break
+			}
+		}
+		// The missing paths are optional so that the comparisons
+		// evaluate to false like in jq.
+		return &atom{
+			Type: tExpr,
+			Expr: &pathExpr{
+				q: q,
+			},
+			Optional: true,
+		}, true, nil
+
+	case tString:
+		if t.StrVal == "null" && !t.Quoted {
+			return &atom{
+				Type: tNull,
+			}, false, nil
+		}
+		return &atom{
+			Type:   tString,
+			StrVal: t.StrVal,
+		}, false, nil
+
+	case tInt:
+		return &atom{
+			Type:   tInt,
+			IntVal: t.Int,
+			BigVal: t.Big,
+		}, false, nil
+
+	default:
+		return nil, false, lexer.SyntaxError("path, string, or integer")
+	}
+}
+
+func expectToken(lexer *lexer, tt tokenType) error {
+	expected := fmt.Sprintf("'%s'", tt)
+	t, err := lexer.Expect(expected)
+	if err != nil {
+		return err
+	}
+	if t.Type != tt {
+		return lexer.SyntaxError(expected)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+var jqTests = []struct {
+	jq       string
+	expected string
+}{
+	{`.issue.key`, `"OP-1"`},
+	{`.issue | .fields | ."project".name`, `"Operations"`},
+	{`.issue.changelog.items[] | select(.fieldId=="assignee") | .toString`,
+		`["Veijo Linux","Milton Waddams"]`},
+	{`.issue.changelog.items[1].toString`, `["Veijo Linux"]`},
+	{`.issue.changelog.items[] | select(.priority > 10 or "backlog" == .fromString) | .["fieldId"]`,
+		`["status"]`},
+	{`.issue.changelog.items[] | select(.fieldId=="assignee" and 10 >= .priority)
+      | select(.fromString != "Veijo Linux") | .toString`,
+		`["Veijo Linux"]`},
+	{`.issue.changelog.items[] | .missing?`, `[]`},
+	{`.issue.changelog.items[] | select(.missing == 1)`, `[]`},
+	{`.issue.changelog.items[] | select(.missing.key != 1 or .priority > 10) | .fieldId`,
+		`["status"]`},
+	{`. | .issue.key`, `"OP-1"`},
+}
+
+func TestCompileJQ(t *testing.T) {
+	v := parseAssign(t)
+
+	for _, test := range jqTests {
+		q, err := CompileJQ(test.jq)
+		if err != nil {
+			t.Fatalf("CompileJQ(%s) failed: %s", test.jq, err)
+		}
+		data, err := q.GetJSON(v)
+		if err != nil {
+			t.Fatalf("GetJSON(%s) failed: %s", test.jq, err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.jq, data, test.expected)
+		}
+	}
+
+	keys := unmarshal(t, `{"items": [
+{"name": "first", "foo bar": "x", "a.b": "x", "c[0]": {"d": "x"}, "a": {"b": "y"}},
+{"name": "second", "foo bar": "y", "a.b": "y", "c[0]": {"d": "y"}, "a": {"b": "x"}}]}`)
+	for _, jq := range []string{
+		`.items[] | select(."foo bar" == "x") | .name`,
+		`.items[] | select(."a.b" == "x") | .name`,
+		`.items[] | select(."c[0]".d == "x") | .name`,
+		`.items[] | select(.a.b == "y") | .name`,
+	} {
+		q, err := CompileJQ(jq)
+		if err != nil {
+			t.Fatalf("CompileJQ(%s) failed: %s", jq, err)
+		}
+		data, err := q.GetJSON(keys)
+		if err != nil {
+			t.Fatalf("GetJSON(%s) failed: %s", jq, err)
+		}
+		if string(data) != `["first"]` {
+			t.Errorf("%s: got %s, expected [\"first\"]", jq, data)
+		}
+	}
+
+	for _, jq := range []string{
+		`.`, `.[]`, `select(.a==1)`, `.a | map(.b)`, `.a[] | select(.a==.b)`,
+		`.a[] | select(.a)`, `.a |`, `.issue..key`, `..key`, `.issue.`,
+		`.issue. | .key`, `.a.?`,
+	} {
+		_, err := CompileJQ(jq)
+		if err == nil {
+			t.Errorf("CompileJQ accepted %s", jq)
+		}
+	}
+}
@@ -7,23 +7,138 @@
 package jsonq
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Context filters JSON object with Select and extracts values with
-// Extract.
+// Extract. Contexts are immutable: the selection functions return a
+// new context and leave the receiver unmodified. This allows you to
+// reuse a context for several sub-selections and to share it between
+// goroutines. Note that the contexts share the underlying JSON
+// values, so the values must not be modified while the contexts are
+// in use.
 type Context struct {
 	selection []interface{}
 	err       error
+	opts      *options
+}
+
+// with returns a new context with the argument selection. The
+// selection is checked against the maximum number of results so that
+// the limit applies to all operations creating selections.
+func (ctx *Context) with(selection []interface{}) *Context {
+	err := ctx.opts.checkResults(len(selection))
+	if err != nil {
+		return ctx.fail(err)
+	}
+	result := *ctx
+	result.selection = selection
+	return &result
+}
+
+// fail returns a new context with the argument error.
+func (ctx *Context) fail(err error) *Context {
+	result := *ctx
+	result.selection = nil
+	result.err = err
+	return &result
 }
 
 // Ctx creates a new selection context for the argument JSON root
-// value.
-func Ctx(root interface{}) *Context {
+// value. If the root is a []byte or string, it is parsed as JSON
+// data and any parse errors are returned by the context's terminal
+// functions. The options apply to the queries of the context and of
+// the contexts derived from it.
+func Ctx(root interface{}, opts ...Option) *Context {
+	var ctx *Context
+	var err error
+
+	switch data := root.(type) {
+	case []byte:
+		ctx, err = FromBytes(data, opts...)
+
+	case string:
+		ctx, err = FromBytes([]byte(data), opts...)
+
+	default:
+		ctx, err = newContext(root, newOptions(opts))
+	}
+	if err != nil {
+		return &Context{
+			err:  err,
+			opts: newOptions(opts),
+		}
+	}
+	return ctx
+}
+
+// newContext creates a new selection context for the root value. The
+// root value is checked against the options' document limits.
+func newContext(root interface{}, o *options) (*Context, error) {
+	err := o.checkDocument(root)
+	if err != nil {
+		return nil, err
+	}
 	return &Context{
 		selection: []interface{}{root},
+		opts:      o,
+	}, nil
+}
+
+// FromBytes creates a new selection context from the JSON data. The
+// options apply to the queries of the context like with Ctx.
+func FromBytes(data []byte, opts ...Option) (*Context, error) {
+	var root interface{}
+	err := json.Unmarshal(data, &root)
+	if err != nil {
+		return nil, err
+	}
+	return newContext(root, newOptions(opts))
+}
+
+// FromReader creates a new selection context from the JSON data read
+// from the reader. The options apply to the queries of the context
+// like with Ctx.
+func FromReader(in io.Reader, opts ...Option) (*Context, error) {
+	return FromDecoder(json.NewDecoder(in), opts...)
+}
+
+// FromDecoder creates a new selection context from the next JSON
+// value decoded by the decoder. This allows you to configure the
+// decoder, for example, to decode numbers as json.Number with the
+// decoder's UseNumber method. The options apply to the queries of the
+// context like with Ctx.
+func FromDecoder(dec *json.Decoder, opts ...Option) (*Context, error) {
+	var root interface{}
+	err := dec.Decode(&root)
+	if err != nil {
+		return nil, err
+	}
+	return newContext(root, newOptions(opts))
+}
+
+// Clone creates a copy of the context. The copy shares the selected
+// JSON values with the original context. Since contexts are
+// immutable, cloning is only needed for getting a distinct context
+// value.
+func (ctx *Context) Clone() *Context {
+	selection := make([]interface{}, len(ctx.selection))
+	copy(selection, ctx.selection)
+	return &Context{
+		selection: selection,
+		err:       ctx.err,
+		opts:      ctx.opts,
 	}
 }
 
@@ -32,23 +147,468 @@ func (ctx *Context) Select(q string) *Context {
 	if ctx.err != nil {
 		return ctx
 	}
+	query, err := ctx.opts.compile(q)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	return ctx.SelectQ(query)
+}
+
+// SelectQ selects elements from the context with the compiled query.
+func (ctx *Context) SelectQ(q *Query) *Context {
+	return ctx.selectQ(ctx.opts.env(), q)
+}
+
+// SelectContext selects elements from the context like Select but
+// stops the evaluation when the context c is canceled or its
+// deadline expires. In that case, the returned context holds the
+// context's error.
+func (ctx *Context) SelectContext(c context.Context, q string) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	query, err := ctx.opts.compile(q)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	return ctx.SelectQContext(c, query)
+}
+
+// SelectQContext selects elements from the context with the compiled
+// query like SelectContext.
+func (ctx *Context) SelectQContext(c context.Context, q *Query) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	err := c.Err()
+	if err != nil {
+		return ctx.fail(err)
+	}
+	return ctx.selectQ(newEnv(c).withOptions(ctx.opts), q)
+}
+
+func (ctx *Context) selectQ(e *env, q *Query) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	buf := getValues()
+	values := *buf
+	for _, sel := range ctx.selection {
+		err := e.check()
+		if err != nil {
+			*buf = values
+			putValues(buf)
+			return ctx.fail(err)
+		}
+		value, err := q.eval(e, sel)
+		if err != nil {
+			*buf = values
+			putValues(buf)
+			return ctx.fail(err)
+		}
+		arr, ok := arrayValue(value)
+		if ok {
+			values = append(values, arr...)
+		} else {
+			values = append(values, value)
+		}
+	}
+	if err := e.checkResults(len(values)); err != nil {
+		*buf = values
+		putValues(buf)
+		return ctx.fail(err)
+	}
+	var result []interface{}
+	if len(values) > 0 {
+		result = copyValues(values)
+	}
+	*buf = values
+	putValues(buf)
+
+	return ctx.with(result)
+}
+
+// SelectAny evaluates all argument queries against each element of
+// the current selection and combines their results into the new
+// selection. Queries that do not match an element because a key is
+// missing or a value can't be indexed do not contribute to the
+// result. Other errors fail the selection.
+func (ctx *Context) SelectAny(q ...string) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	queries, err := ctx.compileAll(q)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	e := ctx.opts.env()
 	var result []interface{}
 	for _, sel := range ctx.selection {
-		value, err := Get(sel, q)
+		for _, query := range queries {
+			value, err := query.eval(e, sel)
+			if err != nil {
+				if mismatch(err) {
+					continue
+				}
+				return ctx.fail(err)
+			}
+			arr, ok := arrayValue(value)
+			if ok {
+				result = append(result, arr...)
+			} else {
+				result = append(result, value)
+			}
+		}
+	}
+	return ctx.with(result)
+}
+
+// SelectOr evaluates the argument queries in order against each
+// element of the current selection and selects the results of the
+// first query that matches the element with a non-empty result. This
+// allows you to select values from documents whose schema has
+// changed over time. Elements not matching any of the queries do not
+// contribute to the result. The queries match as in SelectAny.
+func (ctx *Context) SelectOr(q ...string) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	queries, err := ctx.compileAll(q)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	e := ctx.opts.env()
+	var result []interface{}
+	for _, sel := range ctx.selection {
+		for _, query := range queries {
+			value, err := query.eval(e, sel)
+			if err != nil {
+				if mismatch(err) {
+					continue
+				}
+				return ctx.fail(err)
+			}
+			arr, ok := arrayValue(value)
+			if ok {
+				if len(arr) == 0 {
+					continue
+				}
+				result = append(result, arr...)
+			} else {
+				result = append(result, value)
+			}
+			break
+		}
+	}
+	return ctx.with(result)
+}
+
+func (ctx *Context) compileAll(q []string) ([]*Query, error) {
+	var result []*Query
+	for _, str := range q {
+		query, err := ctx.opts.compile(str)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, query)
+	}
+	return result, nil
+}
+
+// SelectGrouped selects elements from the context like Select but
+// does not flatten the results. The resulting selection contains one
+// array for each element of the current selection, holding the
+// element's matches. The grouped selection can be extracted into a
+// slice of slices, for example, [][]Assignment.
+func (ctx *Context) SelectGrouped(q string) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	query, err := ctx.opts.compile(q)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	e := ctx.opts.env()
+	var result []interface{}
+	for _, sel := range ctx.selection {
+		value, err := query.eval(e, sel)
 		if err != nil {
-			ctx.err = err
-			return ctx
+			return ctx.fail(err)
 		}
-		arr, ok := value.([]interface{})
+		arr, ok := arrayValue(value)
 		if ok {
-			result = append(result, arr...)
+			result = append(result, arr)
 		} else {
-			result = append(result, value)
+			result = append(result, []interface{}{value})
 		}
 	}
-	ctx.selection = result
+	return ctx.with(result)
+}
 
-	return ctx
+// Join performs an equality join between the current selection and
+// the selection of the other context. The query onLeft is evaluated
+// against the elements of the current selection and onRight against
+// the elements of the other selection. For each pair of elements
+// whose keys are equal, the resulting selection contains the left
+// element merged with the right element as with Merge. The result is
+// ordered by the left elements and then by the right elements.
+// Elements whose key is missing, or is an array or an object, do not
+// take part in the join.
+func (ctx *Context) Join(other *Context, onLeft, onRight string) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	if other.err != nil {
+		return ctx.fail(other.err)
+	}
+	left, err := ctx.opts.compile(onLeft)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	right, err := ctx.opts.compile(onRight)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	e := ctx.opts.env()
+
+	matches := make(map[interface{}][]interface{})
+	for _, sel := range other.selection {
+		key, ok, err := joinKey(e, right, sel)
+		if err != nil {
+			return ctx.fail(err)
+		}
+		if ok {
+			matches[key] = append(matches[key], sel)
+		}
+	}
+	var result []interface{}
+	for _, sel := range ctx.selection {
+		key, ok, err := joinKey(e, left, sel)
+		if err != nil {
+			return ctx.fail(err)
+		}
+		if !ok {
+			continue
+		}
+		for _, match := range matches[key] {
+			result = append(result, Merge(sel, match))
+		}
+	}
+	return ctx.with(result)
+}
+
+// joinKey evaluates the join query q against the value v and returns
+// the hash key of the result. The numbers are keyed by their
+// canonical values so that equal numbers match regardless of their
+// representation.
+func joinKey(e *env, q *Query, v interface{}) (interface{}, bool, error) {
+	val, err := q.eval(e, v)
+	if err != nil {
+		if mismatch(err) || err == ErrorOptionalMissing {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	switch val := val.(type) {
+	case nil, bool, string:
+		return val, true, nil
+
+	default:
+		num, ok := toNumber(val)
+		if !ok {
+			return nil, false, nil
+		}
+		return num.canonical(), true, nil
+	}
+}
+
+// Filter keeps the selected elements for which the predicate
+// function returns true. If the predicate returns an error, the
+// error is stored in the context.
+func (ctx *Context) Filter(f func(v interface{}) (bool, error)) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	var result []interface{}
+	for _, sel := range ctx.selection {
+		ok, err := f(sel)
+		if err != nil {
+			return ctx.fail(err)
+		}
+		if ok {
+			result = append(result, sel)
+		}
+	}
+	return ctx.with(result)
+}
+
+// Map replaces each selected element with the value returned by the
+// transformation function. If the function returns an error, the
+// error is stored in the context.
+func (ctx *Context) Map(f func(v interface{}) (interface{}, error)) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	result := make([]interface{}, 0, len(ctx.selection))
+	for _, sel := range ctx.selection {
+		v, err := f(sel)
+		if err != nil {
+			return ctx.fail(err)
+		}
+		result = append(result, v)
+	}
+	return ctx.with(result)
+}
+
+// Limit limits the selection to its first n elements.
+func (ctx *Context) Limit(n int) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > len(ctx.selection) {
+		n = len(ctx.selection)
+	}
+	return ctx.with(ctx.selection[:n:n])
+}
+
+// Offset removes the first n elements from the selection.
+func (ctx *Context) Offset(n int) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	if n < 0 {
+		n = 0
+	}
+	end := len(ctx.selection)
+	if n > end {
+		n = end
+	}
+	return ctx.with(ctx.selection[n:end:end])
+}
+
+// Sort orders the selection by the value of the query byQuery,
+// evaluated on each selected element. Numbers are compared
+// numerically and strings lexicographically. Values of different
+// types are ordered as null, booleans, numbers, strings, arrays, and
+// objects. Elements missing an optional key are ordered as null
+// values. If desc is true, the selection is sorted in descending
+// order. The sort is stable.
+func (ctx *Context) Sort(byQuery string, desc bool) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	q, err := ctx.opts.compile(byQuery)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	e := ctx.opts.env()
+	keys := make([]interface{}, len(ctx.selection))
+	for idx, sel := range ctx.selection {
+		key, err := q.eval(e, sel)
+		if err != nil && err != ErrorOptionalMissing {
+			return ctx.fail(err)
+		}
+		keys[idx] = key
+	}
+	order := make([]int, len(ctx.selection))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		cmp := compareValues(keys[order[i]], keys[order[j]])
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	result := make([]interface{}, len(order))
+	for idx, o := range order {
+		result[idx] = ctx.selection[o]
+	}
+	return ctx.with(result)
+}
+
+// compareValues compares two JSON values and returns -1, 0, or 1 if
+// a is less than, equal to, or greater than b.
+func compareValues(a, b interface{}) int {
+	ra := typeRank(a)
+	rb := typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch av := a.(type) {
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0
+		}
+		if !av {
+			return -1
+		}
+		return 1
+
+	case float64, json.Number:
+		an, _ := toNumber(a)
+		bn, _ := toNumber(b)
+		return an.cmp(bn)
+
+	case string:
+		return strings.Compare(av, b.(string))
+
+	default:
+		return 0
+	}
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64, json.Number:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// Len returns the number of elements in the current selection. It
+// returns 0 if the context has an error.
+func (ctx *Context) Len() int {
+	if ctx.err != nil {
+		return 0
+	}
+	return len(ctx.selection)
+}
+
+// First narrows the selection to its first element. An empty
+// selection remains empty.
+func (ctx *Context) First() *Context {
+	if ctx.err != nil || len(ctx.selection) == 0 {
+		return ctx
+	}
+	return ctx.with(ctx.selection[:1:1])
+}
+
+// Last narrows the selection to its last element. An empty selection
+// remains empty.
+func (ctx *Context) Last() *Context {
+	if ctx.err != nil || len(ctx.selection) == 0 {
+		return ctx
+	}
+	n := len(ctx.selection)
+	return ctx.with(ctx.selection[n-1 : n : n])
 }
 
 // Error describes an invalid argument passed to Extract.
@@ -74,16 +634,182 @@ func (ctx *Context) Get() ([]interface{}, error) {
 	return ctx.selection, nil
 }
 
+// Count returns the number of elements in the current selection.
+func (ctx *Context) Count() (int, error) {
+	if ctx.err != nil {
+		return 0, ctx.err
+	}
+	return len(ctx.selection), nil
+}
+
+// Chunk splits the current selection into batches of n elements. The
+// last batch contains the remaining elements and it can be shorter
+// than n. The batches are copies and modifying them does not change
+// the selection or the other batches.
+func (ctx *Context) Chunk(n int) ([][]interface{}, error) {
+	if ctx.err != nil {
+		return nil, ctx.err
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("jsonq: invalid chunk size %d", n)
+	}
+	result := make([][]interface{}, 0, (len(ctx.selection)+n-1)/n)
+	for start := 0; start < len(ctx.selection); start += n {
+		end := start + n
+		if end > len(ctx.selection) {
+			end = len(ctx.selection)
+		}
+		result = append(result,
+			append([]interface{}(nil), ctx.selection[start:end]...))
+	}
+	return result, nil
+}
+
+// ForEachChunk calls the function f for each batch of n elements of
+// the current selection, as returned by Chunk. If the function
+// returns an error, ForEachChunk stops and returns the error.
+func (ctx *Context) ForEachChunk(n int, f func(chunk []interface{}) error) error {
+	chunks, err := ctx.Chunk(n)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		err = f(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Strings returns the current selection as strings. The null values
+// are returned as empty strings.
+func (ctx *Context) Strings() ([]string, error) {
+	if ctx.err != nil {
+		return nil, ctx.err
+	}
+	result := make([]string, 0, len(ctx.selection))
+	for idx, sel := range ctx.selection {
+		val, ok := ctx.opts.stringValue(sel)
+		if !ok {
+			return nil, elementTypeError(idx, "string", sel)
+		}
+		result = append(result, val)
+	}
+	return result, nil
+}
+
+// Floats returns the current selection as float64 numbers.
+func (ctx *Context) Floats() ([]float64, error) {
+	if ctx.err != nil {
+		return nil, ctx.err
+	}
+	result := make([]float64, 0, len(ctx.selection))
+	for idx, sel := range ctx.selection {
+		val, ok, err := ctx.opts.numberValue(sel)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, elementTypeError(idx, "number", sel)
+		}
+		result = append(result, val)
+	}
+	return result, nil
+}
+
+// Ints returns the current selection as integer numbers. The function
+// internally gets the values as numbers and casts them to int type.
+func (ctx *Context) Ints() ([]int, error) {
+	floats, err := ctx.Floats()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int, 0, len(floats))
+	for idx, f := range floats {
+		val, ok := ctx.opts.intValue(f)
+		if !ok {
+			return nil, elementTypeError(idx, "int", ctx.selection[idx])
+		}
+		result = append(result, val)
+	}
+	return result, nil
+}
+
+// Bools returns the current selection as booleans.
+func (ctx *Context) Bools() ([]bool, error) {
+	if ctx.err != nil {
+		return nil, ctx.err
+	}
+	result := make([]bool, 0, len(ctx.selection))
+	for idx, sel := range ctx.selection {
+		val, ok := ctx.opts.boolValue(sel)
+		if !ok {
+			return nil, elementTypeError(idx, "bool", sel)
+		}
+		result = append(result, val)
+	}
+	return result, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface. It marshals a
+// single-element selection as the element value and other selections
+// as JSON arrays.
+func (ctx *Context) MarshalJSON() ([]byte, error) {
+	if ctx.err != nil {
+		return nil, ctx.err
+	}
+	if len(ctx.selection) == 1 {
+		return json.Marshal(ctx.selection[0])
+	}
+	if ctx.selection == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(ctx.selection)
+}
+
+// Raw returns the current selection as JSON data. See MarshalJSON for
+// details about the encoding.
+func (ctx *Context) Raw() ([]byte, error) {
+	return ctx.MarshalJSON()
+}
+
 // Extract extracts values from the current selection into the
 // argument value object.
 func (ctx *Context) Extract(v interface{}) error {
 	if ctx.err != nil {
 		return ctx.err
 	}
-	return extract(ctx.selection, reflect.ValueOf(v))
+	return extract(ctx.opts, ctx.selection, reflect.ValueOf(v))
 }
 
-func extract(selection []interface{}, rv reflect.Value) error {
+// ExtractFunc extracts the current selection one element at a
+// time. For each selected element, the function allocates a new
+// value with newT, extracts the element into it, and passes it to
+// the visit function. The newT function must return a pointer value,
+// suitable for Extract. The extraction stops at the first error
+// returned by visit.
+func (ctx *Context) ExtractFunc(newT func() interface{},
+	visit func(v interface{}) error) error {
+
+	if ctx.err != nil {
+		return ctx.err
+	}
+	for idx, sel := range ctx.selection {
+		v := newT()
+		err := extract(ctx.opts, []interface{}{sel}, reflect.ValueOf(v))
+		if err != nil {
+			return elementFieldError(idx, err)
+		}
+		err = visit(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extract(o *options, selection []interface{}, rv reflect.Value) error {
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return &Error{
 			Type: rv.Type(),
@@ -103,7 +829,7 @@ func extract(selection []interface{}, rv reflect.Value) error {
 		if len(selection) != 1 {
 			return errors.New("jsonq: selection matches more than one item")
 		}
-		return extractStruct(selection[0], pointed)
+		return extractStruct(o, selection[0], pointed)
 
 	case reflect.Slice:
 		elemType := pointed.Type().Elem()
@@ -115,11 +841,11 @@ func extract(selection []interface{}, rv reflect.Value) error {
 				return fmt.Errorf("jsonq: slice with invalid pointer type %s",
 					p.Kind())
 			}
-			for _, sel := range selection {
+			for idx, sel := range selection {
 				v := reflect.New(p)
-				err := extract([]interface{}{sel}, v)
+				err := extract(o, []interface{}{sel}, v)
 				if err != nil {
-					return err
+					return elementFieldError(idx, err)
 				}
 				pointed = reflect.Append(pointed, v)
 			}
@@ -127,11 +853,31 @@ func extract(selection []interface{}, rv reflect.Value) error {
 			return nil
 
 		case reflect.Struct:
-			for _, sel := range selection {
+			for idx, sel := range selection {
 				v := reflect.New(elemType)
-				err := extract([]interface{}{sel}, v)
+				err := extract(o, []interface{}{sel}, v)
 				if err != nil {
-					return err
+					return elementFieldError(idx, err)
+				}
+				pointed = reflect.Append(pointed, reflect.Indirect(v))
+			}
+			reflect.Indirect(rv).Set(pointed)
+			return nil
+
+		case reflect.Slice:
+			// Support slice of slices for grouped selections.
+			for _, sel := range selection {
+				group, ok := sel.([]interface{})
+				if !ok {
+					return fmt.Errorf("jsonq: selection is not grouped: %T",
+						sel)
+				}
+				v := reflect.New(elemType)
+				if len(group) > 0 {
+					err := extract(o, group, v)
+					if err != nil {
+						return err
+					}
 				}
 				pointed = reflect.Append(pointed, reflect.Indirect(v))
 			}
@@ -148,29 +894,470 @@ func extract(selection []interface{}, rv reflect.Value) error {
 	}
 }
 
-func extractStruct(sel interface{}, value reflect.Value) error {
-	for i := 0; i < value.NumField(); i++ {
-		tag := value.Type().Field(i).Tag.Get("jsonq")
+func extractStruct(o *options, sel interface{}, value reflect.Value) error {
+	plan, err := structPlan(value.Type(), o.useJSONTags())
+	if err != nil {
+		return err
+	}
+	e := o.env()
+	for _, f := range plan {
+		var v interface{}
+		v, err = f.query.eval(e, sel)
+		if err == ErrorOptionalMissing {
+			continue
+		}
+		if err == nil {
+			err = f.set(e, f.query.String(), v, value.Field(f.index))
+		}
+		if err != nil {
+			t := value.Type()
+			name := t.Name()
+			if len(name) == 0 {
+				name = t.String()
+			}
+			return &FieldError{
+				Struct: name,
+				Field:  t.Field(f.index).Name,
+				Query:  f.query.String(),
+				Index:  -1,
+				Err:    err,
+			}
+		}
+	}
+	return nil
+}
+
+// fieldPlan describes how a struct field is extracted: the field
+// index, the compiled query of the field's jsonq tag, and the setter
+// function for the field type.
+type fieldPlan struct {
+	index int
+	query *Query
+	set   fieldSetter
+}
+
+// fieldSetter sets the struct field to the value v of the query q.
+// The query is used in the error messages.
+type fieldSetter func(e *env, q string, v interface{},
+	field reflect.Value) error
+
+// planKey identifies the cached extraction plans. The plans depend on
+// the struct type and on the json tag fallback.
+type planKey struct {
+	t        reflect.Type
+	jsonTags bool
+}
+
+type cachedPlan struct {
+	fields []fieldPlan
+	err    error
+}
+
+var structPlans sync.Map
+
+// structPlan returns the extraction plan for the struct type. The
+// plans are cached by the struct type. If jsonTags is true, the fields
+// without jsonq tags are extracted by their json tags.
+func structPlan(t reflect.Type, jsonTags bool) ([]fieldPlan, error) {
+	key := planKey{
+		t:        t,
+		jsonTags: jsonTags,
+	}
+	cached, ok := structPlans.Load(key)
+	if ok {
+		plan := cached.(*cachedPlan)
+		return plan.fields, plan.err
+	}
+	fields, err := newStructPlan(t, jsonTags)
+	structPlans.Store(key, &cachedPlan{
+		fields: fields,
+		err:    err,
+	})
+	return fields, err
+}
+
+func newStructPlan(t reflect.Type, jsonTags bool) ([]fieldPlan, error) {
+	var plan []fieldPlan
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("jsonq")
+		var fallback bool
+		if len(tag) == 0 && jsonTags {
+			tag = jsonTagQuery(field)
+			fallback = true
+		}
 		if len(tag) == 0 {
 			continue
 		}
-		field := value.Field(i)
-		switch field.Type().Kind() {
-		case reflect.String:
-			val, err := GetString(sel, tag)
-			if err == ErrorOptionalMissing {
+		tag, opts, err := parseTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("jsonq: field %s: %s", field.Name,
+				strings.TrimPrefix(err.Error(), "jsonq: "))
+		}
+		var set fieldSetter
+		switch {
+		case field.Type.Kind() == reflect.Map:
+			set, err = mapSetter(field.Type, opts)
+			if err != nil {
+				return nil, fmt.Errorf("jsonq: field %s: %s", field.Name,
+					strings.TrimPrefix(err.Error(), "jsonq: "))
+			}
+
+		case opts.keys != nil:
+			return nil, fmt.Errorf("jsonq: field %s: keys option requires a map field",
+				field.Name)
+
+		default:
+			set, err = valueSetter(field.Type, opts)
+			if err != nil {
+				return nil, fmt.Errorf("jsonq: field %s: %s", field.Name,
+					strings.TrimPrefix(err.Error(), "jsonq: "))
+			}
+		}
+		if set == nil {
+			if fallback {
+				continue
+			}
+			return nil, fmt.Errorf("jsonq: field type %s not supported",
+				field.Type)
+		}
+		q, err := Compile(tag)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, fieldPlan{
+			index: i,
+			query: q,
+			set:   set,
+		})
+	}
+	return plan, nil
+}
+
+// tagOptions define the options of the jsonq struct tags. The options
+// follow the query as comma-separated name=value pairs, for example:
+//
+//	Created time.Time `jsonq:"created,epoch=ms,tz=Europe/Helsinki"`
+type tagOptions struct {
+	tz    *time.Location
+	epoch time.Duration
+	keys  *regexp.Regexp
+}
+
+// parseTag splits the tag into the query and the tag options.
+func parseTag(tag string) (string, *tagOptions, error) {
+	opts := new(tagOptions)
+	for {
+		idx := strings.LastIndexByte(tag, ',')
+		if idx < 0 {
+			break
+		}
+		opt := strings.TrimSpace(tag[idx+1:])
+		eq := strings.IndexByte(opt, '=')
+		if eq <= 0 || !isTagOptionName(opt[:eq]) {
+			// The comma is part of the query.
+			break
+		}
+		name := opt[:eq]
+		value := opt[eq+1:]
+		switch name {
+		case "tz":
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				return "", nil, fmt.Errorf("jsonq: invalid tz option %q: %s",
+					value, err)
+			}
+			opts.tz = loc
+
+		case "epoch":
+			switch value {
+			case "s":
+				opts.epoch = time.Second
+			case "ms":
+				opts.epoch = time.Millisecond
+			case "ns":
+				opts.epoch = time.Nanosecond
+			default:
+				return "", nil, fmt.Errorf("jsonq: invalid epoch option %q",
+					value)
+			}
+
+		case "keys":
+			opts.keys = globRegexp(value)
+
+		default:
+			return "", nil, fmt.Errorf("jsonq: unknown tag option %q", name)
+		}
+		tag = tag[:idx]
+	}
+	return tag, opts, nil
+}
+
+// globRegexp converts the glob pattern into a regular expression. In
+// the pattern, '*' matches any sequence of characters and '?' matches
+// any single character.
+func globRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString(`^(?s:`)
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteByte('.')
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString(`)$`)
+	return regexp.MustCompile(sb.String())
+}
+
+func isTagOptionName(name string) bool {
+	for _, r := range name {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonTagQuery returns the query for the field's json tag. The query
+// selects the optional key named by the tag, or by the field name if
+// the tag does not specify a name. It returns an empty string if the
+// field does not have a json tag, if the tag is "-", or if the field
+// is not exported.
+func jsonTagQuery(field reflect.StructField) string {
+	tag, ok := field.Tag.Lookup("json")
+	if !ok || tag == "-" || len(field.PkgPath) > 0 {
+		return ""
+	}
+	name := tag
+	if idx := strings.IndexByte(tag, ','); idx >= 0 {
+		name = tag[:idx]
+	}
+	if len(name) == 0 {
+		name = field.Name
+	}
+	return "?" + QuoteKey(name)
+}
+
+// valueSetter returns the setter function for the field type and the
+// tag options. It returns nil if the type is not supported.
+func valueSetter(t reflect.Type, opts *tagOptions) (fieldSetter, error) {
+	if t == timeType {
+		return timeSetter(opts), nil
+	}
+	if opts.tz != nil || opts.epoch != 0 {
+		return nil, fmt.Errorf("jsonq: tz and epoch options require a time field")
+	}
+	return fieldSetterFor(t), nil
+}
+
+// mapSetter returns the setter function for the map type and the tag
+// options. The map is set from the entries of the selected object
+// whose keys match the keys option. The values of the entries are
+// set with the setter of the map's element type. It returns nil if
+// the map type is not supported.
+func mapSetter(t reflect.Type, opts *tagOptions) (fieldSetter, error) {
+	if t.Key().Kind() != reflect.String {
+		return nil, nil
+	}
+	var set fieldSetter
+	elem := t.Elem()
+	if elem.Kind() == reflect.Interface && elem.NumMethod() == 0 {
+		set = setInterface
+	} else {
+		var err error
+		set, err = valueSetter(elem, opts)
+		if err != nil || set == nil {
+			return nil, err
+		}
+	}
+	return func(e *env, q string, obj interface{}, field reflect.Value) error {
+		if _, _, ok := lookup(obj, ""); !ok {
+			return &TypeError{
+				Query: q,
+				Want:  "object",
+				Got:   typeName(obj),
+			}
+		}
+		m := reflect.MakeMap(t)
+		for _, key := range objectKeys(obj) {
+			if opts.keys != nil && !opts.keys.MatchString(key) {
 				continue
 			}
+			child, _, _ := e.lookup(obj, key)
+			val := reflect.New(elem).Elem()
+			err := set(e, q+"."+QuoteKey(key), child, val)
 			if err != nil {
 				return err
 			}
-			field.SetString(val)
+			m.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), val)
+		}
+		field.Set(m)
+		return nil
+	}, nil
+}
 
-		default:
-			return fmt.Errorf("jsonq: field type %s not supported",
-				field.Type())
+func setInterface(e *env, q string, v interface{}, field reflect.Value) error {
+	if v != nil {
+		field.Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// fieldSetterFor returns the setter function for the field type. It
+// returns nil if the type is not supported.
+func fieldSetterFor(t reflect.Type) fieldSetter {
+	switch t.Kind() {
+	case reflect.String:
+		return setString
+
+	case reflect.Bool:
+		return setBool
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return setInt
+
+	case reflect.Float32, reflect.Float64:
+		return setFloat
+
+	case reflect.Ptr:
+		switch t.Elem() {
+		case bigIntType:
+			return setBigInt
+
+		case bigFloatType:
+			return setBigFloat
 		}
+	}
+	return nil
+}
+
+func setString(e *env, q string, v interface{}, field reflect.Value) error {
+	val, err := e.stringOf(q, v)
+	if err != nil {
+		return err
+	}
+	field.SetString(val)
+	return nil
+}
+
+func setBool(e *env, q string, v interface{}, field reflect.Value) error {
+	val, err := e.boolOf(q, v)
+	if err != nil {
+		return err
+	}
+	field.SetBool(val)
+	return nil
+}
+
+func setInt(e *env, q string, v interface{}, field reflect.Value) error {
+	val, err := e.intOf(q, v)
+	if err != nil {
+		return err
+	}
+	if field.OverflowInt(int64(val)) {
+		return &TypeError{
+			Query: q,
+			Want:  field.Type().String(),
+			Got:   "number",
+		}
+	}
+	field.SetInt(int64(val))
+	return nil
+}
+
+func setFloat(e *env, q string, v interface{}, field reflect.Value) error {
+	val, err := e.numberOf(q, v)
+	if err != nil {
+		return err
+	}
+	field.SetFloat(val)
+	return nil
+}
+
+var (
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+	timeType     = reflect.TypeOf(time.Time{})
+)
 
+func setBigInt(e *env, q string, v interface{}, field reflect.Value) error {
+	val, err := bigIntOf(q, v)
+	if err != nil {
+		return err
 	}
+	field.Set(reflect.ValueOf(val))
 	return nil
 }
+
+func setBigFloat(e *env, q string, v interface{}, field reflect.Value) error {
+	val, err := bigFloatOf(q, v)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(val))
+	return nil
+}
+
+// timeLayouts define the accepted layouts of the time strings. The
+// layouts without time zones are parsed in the location of the tz tag
+// option, or in UTC if the option is not set.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// timeSetter returns the setter function for the time.Time fields.
+// If the epoch option is set, the value must be a number of epoch
+// units since the Unix epoch. Otherwise the value must be a time
+// string. If the tz option is set, the time is converted to its
+// location. Otherwise the epoch times are in UTC.
+func timeSetter(opts *tagOptions) fieldSetter {
+	loc := opts.tz
+	if loc == nil {
+		loc = time.UTC
+	}
+	return func(e *env, q string, v interface{}, field reflect.Value) error {
+		var t time.Time
+		if opts.epoch != 0 {
+			val, err := bigFloatOf(q, v)
+			if err != nil {
+				return err
+			}
+			unit := big.NewFloat(float64(opts.epoch))
+			ns, _ := new(big.Float).SetPrec(128).Mul(val, unit).Int64()
+			t = time.Unix(0, ns).In(loc)
+		} else {
+			val, err := e.stringOf(q, v)
+			if err != nil {
+				return err
+			}
+			t, err = parseTime(val, loc)
+			if err != nil {
+				return err
+			}
+		}
+		if opts.tz != nil {
+			t = t.In(opts.tz)
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+}
+
+func parseTime(val string, loc *time.Location) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, val, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("jsonq: invalid time %q", val)
+}
@@ -8,7 +8,12 @@ package jsonq
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var assign = `{
@@ -233,6 +238,251 @@ func TestExtractPtrArray(t *testing.T) {
 	}
 }
 
+func TestExtractFieldError(t *testing.T) {
+	v := unmarshal(t, `{
+    "items": [
+        {"toString": "Veijo Linux"},
+        {"toString": 42}
+    ]
+}`)
+	var history []Assignment
+	err := Ctx(v).Select("items[]").Extract(&history)
+	if err == nil {
+		t.Fatalf("Extract accepted number for string field")
+	}
+	expected := `jsonq: Assignment.To (query "?toString") at element 1: ` +
+		`value of '?toString' is int, expected string`
+	if err.Error() != expected {
+		t.Errorf("unexpected error: got %q, expected %q", err, expected)
+	}
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "To" ||
+		fieldErr.Index != 1 {
+		t.Errorf("unexpected field error: %#v", err)
+	}
+
+	var assignment Assignment
+	err = Ctx(v).Select("items[1]").Extract(&assignment)
+	if err == nil {
+		t.Fatalf("Extract accepted number for string field")
+	}
+	expected = `jsonq: Assignment.To (query "?toString"): ` +
+		`value of '?toString' is int, expected string`
+	if err.Error() != expected {
+		t.Errorf("unexpected error: got %q, expected %q", err, expected)
+	}
+}
+
+type Event struct {
+	Created time.Time `jsonq:"created,tz=Europe/Helsinki"`
+	Updated time.Time `jsonq:"updated"`
+	Stamp   time.Time `jsonq:"stamp,epoch=ms,tz=Europe/Helsinki"`
+	Nanos   time.Time `jsonq:"?nanos,epoch=ns"`
+}
+
+func TestExtractTime(t *testing.T) {
+	v := unmarshal(t, `{
+    "created": "2020-06-01 12:00:00",
+    "updated": "2020-06-01T12:00:00+03:00",
+    "stamp": 1590998400000
+}`)
+	v.(map[string]interface{})["nanos"] = json.Number("1590998400000000001")
+	var event Event
+	err := Ctx(v).Extract(&event)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if event.Created.Location().String() != "Europe/Helsinki" ||
+		event.Created.Format(time.RFC3339) != "2020-06-01T12:00:00+03:00" {
+		t.Errorf("unexpected created: %s", event.Created)
+	}
+	if !event.Updated.Equal(event.Created) {
+		t.Errorf("unexpected updated: %s", event.Updated)
+	}
+	if event.Stamp.Location().String() != "Europe/Helsinki" ||
+		event.Stamp.Format(time.RFC3339) != "2020-06-01T11:00:00+03:00" {
+		t.Errorf("unexpected stamp: %s", event.Stamp)
+	}
+	if event.Nanos.UnixNano() != 1590998400000000001 ||
+		event.Nanos.Location() != time.UTC {
+		t.Errorf("unexpected nanos: %d %s", event.Nanos.UnixNano(),
+			event.Nanos.Location())
+	}
+
+	var naive struct {
+		Created time.Time `jsonq:"created"`
+	}
+	err = Ctx(v).Extract(&naive)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if naive.Created.Format(time.RFC3339) != "2020-06-01T12:00:00Z" {
+		t.Errorf("unexpected naive time: %s", naive.Created)
+	}
+
+	invalid := []interface{}{
+		&struct {
+			Created time.Time `jsonq:"created,tz=Nowhere/Nothing"`
+		}{},
+		&struct {
+			Created time.Time `jsonq:"created,epoch=h"`
+		}{},
+		&struct {
+			Created time.Time `jsonq:"created,zone=UTC"`
+		}{},
+		&struct {
+			Created string `jsonq:"created,tz=UTC"`
+		}{},
+		&struct {
+			Created time.Time `jsonq:"stamp"`
+		}{},
+		&struct {
+			Created time.Time `jsonq:"created,epoch=s"`
+		}{},
+		&struct {
+			Created time.Time `jsonq:"issue"`
+		}{},
+	}
+	for _, target := range invalid {
+		err = Ctx(v).Extract(target)
+		if err == nil {
+			t.Errorf("Extract accepted %T", target)
+		}
+	}
+}
+
+func TestExtractMap(t *testing.T) {
+	v := unmarshal(t, `{
+    "issue": {
+        "fields": {
+            "summary": "Disk full",
+            "customfield_10": "team-a",
+            "customfield_11": "P1",
+            "created": "2020-06-01 12:00:00"
+        },
+        "counts": {"open": 2, "done": 5}
+    }
+}`)
+	var issue struct {
+		Custom  map[string]string      `jsonq:"issue.fields,keys=customfield_*"`
+		Times   map[string]time.Time   `jsonq:"issue.fields,keys=created,tz=UTC"`
+		Counts  map[string]int         `jsonq:"issue.counts"`
+		All     map[string]interface{} `jsonq:"issue.fields"`
+		Missing map[string]string      `jsonq:"issue.?missing"`
+	}
+	err := Ctx(v).Extract(&issue)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if len(issue.Custom) != 2 || issue.Custom["customfield_10"] != "team-a" ||
+		issue.Custom["customfield_11"] != "P1" {
+		t.Errorf("unexpected custom fields: %v", issue.Custom)
+	}
+	if len(issue.Times) != 1 ||
+		issue.Times["created"].Format(time.RFC3339) != "2020-06-01T12:00:00Z" {
+		t.Errorf("unexpected times: %v", issue.Times)
+	}
+	if len(issue.Counts) != 2 || issue.Counts["done"] != 5 {
+		t.Errorf("unexpected counts: %v", issue.Counts)
+	}
+	if len(issue.All) != 4 || issue.All["summary"] != "Disk full" {
+		t.Errorf("unexpected fields: %v", issue.All)
+	}
+	if issue.Missing != nil {
+		t.Errorf("unexpected missing: %v", issue.Missing)
+	}
+
+	invalid := []interface{}{
+		&struct {
+			Custom map[string]int `jsonq:"issue.fields,keys=customfield_*"`
+		}{},
+		&struct {
+			Custom map[string]string `jsonq:"issue.fields.summary"`
+		}{},
+		&struct {
+			Custom string `jsonq:"issue.fields,keys=customfield_*"`
+		}{},
+		&struct {
+			Custom map[int]string `jsonq:"issue.fields"`
+		}{},
+		&struct {
+			Custom map[string]string `jsonq:"issue.fields,tz=UTC"`
+		}{},
+	}
+	for _, target := range invalid {
+		err = Ctx(v).Extract(target)
+		if err == nil {
+			t.Errorf("Extract accepted %T", target)
+		}
+	}
+
+	var typeErr *TypeError
+	err = Ctx(v).Extract(invalid[0])
+	if !errors.As(err, &typeErr) ||
+		typeErr.Query != "issue.fields.customfield_10" {
+		t.Errorf("Extract: unexpected error: %v", err)
+	}
+
+	// The map entries are read without compiling queries.
+	m := new(countingMetrics)
+	SetMetrics(m)
+	defer SetMetrics(nil)
+	err = Ctx(v).Extract(&issue)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if m.parsed != 0 || m.misses != 0 || m.evals != 5 {
+		t.Errorf("Extract metrics: %+v", *m)
+	}
+}
+
+type JSONIssue struct {
+	Key      string  `json:"key"`
+	Count    int     `json:"count"`
+	Critical bool    `json:"critical"`
+	Ratio    float64 `json:"ratio,omitempty"`
+	Project  string  `jsonq:"fields.project.name"`
+	Ignored  string  `json:"-"`
+	Fields   []int   `json:"fields"`
+	Missing  string  `json:",omitempty"`
+}
+
+func TestExtractJSONTags(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+
+	issue := new(JSONIssue)
+	err = Ctx(v, WithJSONTags()).Select("issue").Extract(issue)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if issue.Key != "OP-1" || issue.Count != 42 || issue.Critical ||
+		issue.Ratio != 0 || issue.Project != "Operations" ||
+		len(issue.Ignored) != 0 || len(issue.Missing) != 0 {
+		t.Errorf("unexpected Extract result: %+v", issue)
+	}
+
+	issue = new(JSONIssue)
+	err = Ctx(v).Select("issue").Extract(issue)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if len(issue.Key) != 0 || issue.Project != "Operations" {
+		t.Errorf("json tags used without WithJSONTags: %+v", issue)
+	}
+
+	var wrong struct {
+		Key int `json:"key"`
+	}
+	err = Ctx(v, WithJSONTags()).Select("issue").Extract(&wrong)
+	if err == nil {
+		t.Errorf("Extract accepted string for int field")
+	}
+}
+
 var exprTests = []struct {
 	q  string
 	to string
@@ -293,6 +543,42 @@ var exprTests = []struct {
 		q:  `issue.changelog.items[priority == 10 || fieldId == "status"][0]`,
 		to: "development",
 	},
+	{
+		q:  `issue.changelog.items[maybe == "x" || priority == 100]`,
+		to: "development",
+	},
+	{
+		q:  `issue.changelog.items[priority == 100 && maybe != "x" || fieldId == "status"]`,
+		to: "development",
+	},
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	v := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{
+				"kind":  "number",
+				"value": 42.0,
+			},
+			map[string]interface{}{
+				"kind":  "string",
+				"value": "forty-two",
+			},
+		},
+	}
+	n, err := Ctx(v).
+		Select(`items[kind == "number" && value == 42]`).
+		Count()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	if n != 1 {
+		t.Errorf("Select: got %d items, expected 1", n)
+	}
+	_, err = Ctx(v).Select(`items[value == 42]`).Count()
+	if err == nil {
+		t.Errorf("Select did not fail with type error")
+	}
 }
 
 func TestExtractExprs(t *testing.T) {
@@ -319,3 +605,1128 @@ func TestExtractExprs(t *testing.T) {
 		}
 	}
 }
+
+func TestGetJSON(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	data, err := GetJSON(v, "issue.fields")
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	expected := `{"project":{"name":"Operations"}}`
+	if string(data) != expected {
+		t.Errorf("GetJSON: got %s, expected %s", data, expected)
+	}
+	_, err = GetJSON(v, "issue.nonexistent")
+	if err == nil {
+		t.Errorf("GetJSON found non-existent element")
+	}
+}
+
+func TestCompile(t *testing.T) {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	_, err = Compile("issue..key")
+	if err == nil {
+		t.Fatalf("Compile accepted invalid query")
+	}
+	q, err := Compile("issue.key")
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		val, err := q.GetString(v)
+		if err != nil {
+			t.Fatalf("Query.GetString failed: %s", err)
+		}
+		if val != "OP-1" {
+			t.Errorf("Query.GetString: got %s, expected OP-1", val)
+		}
+	}
+	q, err = Compile("issue.count")
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	ival, err := q.GetInt(v)
+	if err != nil {
+		t.Fatalf("Query.GetInt failed: %s", err)
+	}
+	if ival != 42 {
+		t.Errorf("Query.GetInt: got %v, expected 42", ival)
+	}
+}
+
+func TestMustCompile(t *testing.T) {
+	q := MustCompile("issue.key")
+	if q.String() != "issue.key" {
+		t.Errorf("MustCompile: got %s, expected issue.key", q)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustCompile did not panic on invalid query")
+		}
+	}()
+	MustCompile("issue..key")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		q        string
+		offset   int
+		token    string
+		expected string
+	}{
+		{`issue..key`, 6, ".", "key"},
+		{`issue.`, 6, "", "key"},
+		{`issue.items[fieldId=="a" status]`, 25, "status",
+			"'&&', '||', or ']'"},
+		{`issue.items[fieldId="a"]`, 19, "=", "'=='"},
+		{`issue.items[fieldId=="a`, 21, `"a`, `closing '"'`},
+		{`issue key`, 6, "key", "'.', '[', '::', or end of query"},
+		{`issue.items[`, 12, "", "filter or ']'"},
+	}
+	for _, test := range tests {
+		err := Validate(test.q)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Validate(%s): expected *SyntaxError, got %v", test.q, err)
+			continue
+		}
+		if serr.Offset != test.offset || serr.Token != test.token ||
+			serr.Expected != test.expected {
+			t.Errorf("Validate(%s): got %d %q %q, expected %d %q %q",
+				test.q, serr.Offset, serr.Token, serr.Expected,
+				test.offset, test.token, test.expected)
+		}
+	}
+	err := Validate(`issue.changelog.items[fieldId=="assignee"][0]`)
+	if err != nil {
+		t.Errorf("Validate failed: %s", err)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	defer SetQueryCacheSize(DefaultQueryCacheSize)
+
+	c := newLRU(2)
+	a, _ := Compile("a")
+	b, _ := Compile("b")
+	d, _ := Compile("d")
+	c.Add("a", a)
+	c.Add("b", b)
+	if c.Get("a") != a {
+		t.Errorf("LRU lost entry a")
+	}
+	c.Add("d", d)
+	if c.Get("b") != nil {
+		t.Errorf("LRU did not evict least recently used entry")
+	}
+	if c.Get("a") != a || c.Get("d") != d {
+		t.Errorf("LRU evicted wrong entry")
+	}
+	c.Resize(0)
+	if c.Len() != 0 {
+		t.Errorf("LRU not emptied on resize: %v", c.Len())
+	}
+	c.Add("a", a)
+	if c.Get("a") != nil {
+		t.Errorf("disabled LRU stored entry")
+	}
+
+	SetQueryCacheSize(0)
+	_, err := Get(map[string]interface{}{"a": 1.0}, "a")
+	if err != nil {
+		t.Fatalf("Get with disabled cache failed: %s", err)
+	}
+	if queryCache.Len() != 0 {
+		t.Errorf("disabled query cache stored queries")
+	}
+}
+
+func TestFromBytes(t *testing.T) {
+	ctx, err := FromBytes([]byte(assign))
+	if err != nil {
+		t.Fatalf("FromBytes failed: %s", err)
+	}
+	issue := new(Issue)
+	err = ctx.Extract(issue)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if issue.Key != "OP-1" {
+		t.Errorf("Invalid issue.key value: %s", issue.Key)
+	}
+
+	issue = new(Issue)
+	err = Ctx(assign).Extract(issue)
+	if err != nil {
+		t.Fatalf("Extract from string failed: %s", err)
+	}
+	if issue.Key != "OP-1" {
+		t.Errorf("Invalid issue.key value: %s", issue.Key)
+	}
+
+	_, err = FromBytes([]byte("{"))
+	if err == nil {
+		t.Errorf("FromBytes accepted invalid JSON")
+	}
+	_, err = Ctx([]byte("{")).Select("issue").Get()
+	if err == nil {
+		t.Errorf("Ctx accepted invalid JSON")
+	}
+}
+
+func TestFromReader(t *testing.T) {
+	ctx, err := FromReader(strings.NewReader(assign))
+	if err != nil {
+		t.Fatalf("FromReader failed: %s", err)
+	}
+	var history []Assignment
+	err = ctx.Select(`issue.changelog.items[priority==10]`).Extract(&history)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("unexpected number of items: %v", history)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(assign))
+	dec.UseNumber()
+	ctx, err = FromDecoder(dec)
+	if err != nil {
+		t.Fatalf("FromDecoder failed: %s", err)
+	}
+	result, err := ctx.Select(`issue.changelog.items[priority==100]`).Get()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	if len(result) != 1 {
+		t.Errorf("unexpected number of items: %v", result)
+	}
+	dec = json.NewDecoder(strings.NewReader(assign))
+	dec.UseNumber()
+	ctx, err = FromDecoder(dec)
+	if err != nil {
+		t.Fatalf("FromDecoder failed: %s", err)
+	}
+	result, err = ctx.Select("issue").Get()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	ival, err := GetInt(result[0], "count")
+	if err != nil {
+		t.Fatalf("GetInt failed: %s", err)
+	}
+	if ival != 42 {
+		t.Errorf("GetInt: got %v, expected 42", ival)
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	ctx := Ctx(assign).Select(`issue.changelog.items[fieldId=="assignee"]`)
+	if ctx.Len() != 2 {
+		t.Fatalf("Len: got %v, expected 2", ctx.Len())
+	}
+	assignment := new(Assignment)
+	err := ctx.Last().Extract(assignment)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if assignment.To != "Milton Waddams" {
+		t.Errorf("Last: got %s", assignment.To)
+	}
+
+	ctx = Ctx(assign).Select(`issue.changelog.items[fieldId=="assignee"]`)
+	err = ctx.First().Extract(assignment)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if assignment.To != "Veijo Linux" {
+		t.Errorf("First: got %s", assignment.To)
+	}
+	if ctx.Len() != 2 {
+		t.Errorf("First modified context: got %v, expected 2", ctx.Len())
+	}
+
+	ctx = Ctx(assign).Select(`issue.changelog.items[fieldId=="none"]`)
+	if ctx.First().Len() != 0 {
+		t.Errorf("First of empty selection is not empty")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var history []Assignment
+	err := Ctx(assign).
+		Select(`issue.changelog.items`).
+		Filter(func(v interface{}) (bool, error) {
+			to, err := GetString(v, "toString")
+			if err != nil {
+				return false, err
+			}
+			return strings.HasPrefix(to, "Milton"), nil
+		}).
+		Extract(&history)
+	if err != nil {
+		t.Fatalf("Filter failed: %s", err)
+	}
+	if len(history) != 1 || history[0].To != "Milton Waddams" {
+		t.Errorf("Filter returned unexpected items: %v", history)
+	}
+
+	_, err = Ctx(assign).
+		Select(`issue.changelog.items`).
+		Filter(func(v interface{}) (bool, error) {
+			_, err := GetString(v, "priority")
+			return false, err
+		}).
+		Get()
+	if err == nil {
+		t.Errorf("Filter did not return predicate error")
+	}
+}
+
+func TestMap(t *testing.T) {
+	var history []Assignment
+	err := Ctx(assign).
+		Select(`issue.changelog.items[fieldId=="assignee"]`).
+		Map(func(v interface{}) (interface{}, error) {
+			to, err := GetString(v, "toString")
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"toString": strings.ToUpper(to),
+			}, nil
+		}).
+		Extract(&history)
+	if err != nil {
+		t.Fatalf("Map failed: %s", err)
+	}
+	if len(history) != 2 || history[1].To != "MILTON WADDAMS" {
+		t.Errorf("Map returned unexpected items: %v", history)
+	}
+}
+
+func TestClone(t *testing.T) {
+	items := Ctx(assign).Select(`issue.changelog.items`)
+	if items.Len() != 3 {
+		t.Fatalf("Len: got %v, expected 3", items.Len())
+	}
+	to, err := items.Clone().Select("toString").Get()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	if len(to) != 3 || to[0] != "development" {
+		t.Errorf("toString: got %v", to)
+	}
+	assignee := items.Clone().Last()
+	if assignee.Len() != 1 {
+		t.Errorf("assignee: got %v items, expected 1", assignee.Len())
+	}
+	if items.Len() != 3 {
+		t.Errorf("Clone modified original context: %v", items.Len())
+	}
+}
+
+func TestLimitOffset(t *testing.T) {
+	tests := []struct {
+		offset int
+		limit  int
+		result []interface{}
+	}{
+		{0, 2, []interface{}{"development", "Veijo Linux"}},
+		{1, 1, []interface{}{"Veijo Linux"}},
+		{1, 10, []interface{}{"Veijo Linux", "Milton Waddams"}},
+		{3, 1, []interface{}{}},
+		{5, 1, []interface{}{}},
+		{0, 0, []interface{}{}},
+	}
+	for _, test := range tests {
+		result, err := Ctx(assign).
+			Select(`issue.changelog.items`).
+			Offset(test.offset).
+			Limit(test.limit).
+			Select("toString").
+			Get()
+		if err != nil {
+			t.Fatalf("Offset(%v).Limit(%v) failed: %s",
+				test.offset, test.limit, err)
+		}
+		if len(result) != len(test.result) {
+			t.Fatalf("Offset(%v).Limit(%v): got %v, expected %v",
+				test.offset, test.limit, result, test.result)
+		}
+		for idx, r := range result {
+			if r != test.result[idx] {
+				t.Errorf("Offset(%v).Limit(%v): got %v, expected %v",
+					test.offset, test.limit, result, test.result)
+			}
+		}
+	}
+
+	ctx := Ctx(unmarshal(t, `{"a": [1, 2, 3]}`)).Select("a[]")
+	limited, err := ctx.Limit(1).Get()
+	if err != nil {
+		t.Fatalf("Limit failed: %s", err)
+	}
+	_ = append(limited, "X")
+	offset, err := ctx.Limit(2).Offset(1).Get()
+	if err != nil {
+		t.Fatalf("Offset failed: %s", err)
+	}
+	_ = append(offset, "Y")
+	all, err := ctx.Get()
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if data := marshal(t, all); data != "[1,2,3]" {
+		t.Errorf("append to Limit or Offset modified parent: %s", data)
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		by     string
+		desc   bool
+		result []interface{}
+	}{
+		{"priority", false,
+			[]interface{}{"Veijo Linux", "Milton Waddams", "development"}},
+		{"priority", true,
+			[]interface{}{"development", "Veijo Linux", "Milton Waddams"}},
+		{"toString", false,
+			[]interface{}{"Milton Waddams", "Veijo Linux", "development"}},
+		{"fromString", false,
+			[]interface{}{"Veijo Linux", "Milton Waddams", "development"}},
+		{"?missing", true,
+			[]interface{}{"development", "Veijo Linux", "Milton Waddams"}},
+	}
+	for _, test := range tests {
+		result, err := Ctx(assign).
+			Select(`issue.changelog.items`).
+			Sort(test.by, test.desc).
+			Select("toString").
+			Get()
+		if err != nil {
+			t.Fatalf("Sort(%s) failed: %s", test.by, err)
+		}
+		for idx, r := range result {
+			if r != test.result[idx] {
+				t.Errorf("Sort(%s, %v): got %v, expected %v",
+					test.by, test.desc, result, test.result)
+				break
+			}
+		}
+	}
+	_, err := Ctx(assign).Select(`issue.changelog.items`).Sort("missing", false).
+		Get()
+	if err == nil {
+		t.Errorf("Sort by missing key succeeded")
+	}
+}
+
+var groups = `{
+    "issues": [
+        {
+            "key": "OP-1",
+            "items": [
+                {"toString": "Veijo Linux"},
+                {"toString": "Milton Waddams"}
+            ]
+        },
+        {
+            "key": "OP-2",
+            "items": []
+        },
+        {
+            "key": "OP-3",
+            "items": [
+                {"toString": "Bill Lumbergh"}
+            ]
+        }
+    ]
+}`
+
+func TestSelectGrouped(t *testing.T) {
+	var history [][]Assignment
+	err := Ctx(groups).
+		Select("issues").
+		SelectGrouped("items").
+		Extract(&history)
+	if err != nil {
+		t.Fatalf("Extract grouped failed: %s", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("unexpected number of groups: %v", history)
+	}
+	if len(history[0]) != 2 || history[0][1].To != "Milton Waddams" {
+		t.Errorf("invalid first group: %v", history[0])
+	}
+	if len(history[1]) != 0 {
+		t.Errorf("invalid second group: %v", history[1])
+	}
+	if len(history[2]) != 1 || history[2][0].To != "Bill Lumbergh" {
+		t.Errorf("invalid third group: %v", history[2])
+	}
+
+	err = Ctx(groups).Select("issues").Extract(&history)
+	if err == nil {
+		t.Errorf("extracted non-grouped selection into slice of slices")
+	}
+}
+
+var users = `{
+    "users": [
+        {"name": "Milton Waddams", "email": "milton@initech.com"},
+        {"name": "Bill Lumbergh", "email": "bill@initech.com"},
+        {"name": "Peter Gibbons", "email": "peter@initech.com"}
+    ]
+}`
+
+func TestJoin(t *testing.T) {
+	type Change struct {
+		To    string `jsonq:"toString"`
+		Email string `jsonq:"email"`
+	}
+	var changes []Change
+	err := Ctx(groups).
+		Select("issues").
+		Select("items").
+		Join(Ctx(users).Select("users"), "toString", "name").
+		Extract(&changes)
+	if err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("unexpected number of joined elements: %v", changes)
+	}
+	if changes[0].To != "Milton Waddams" ||
+		changes[0].Email != "milton@initech.com" {
+		t.Errorf("invalid first element: %v", changes[0])
+	}
+	if changes[1].To != "Bill Lumbergh" ||
+		changes[1].Email != "bill@initech.com" {
+		t.Errorf("invalid second element: %v", changes[1])
+	}
+
+	count, err := Ctx(`{"a": [{"id": 1}, {"id": "1"}, {"x": 1}]}`).
+		Select("a").
+		Join(Ctx(`{"ref": 1.0, "v": true}`), "id", "ref").
+		Count()
+	if err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+	if count != 1 {
+		t.Errorf("unexpected number of joined elements: %d", count)
+	}
+
+	_, err = Ctx(groups).Join(Ctx("{"), "x", "y").Get()
+	if err == nil {
+		t.Errorf("Join did not propagate the other context's error")
+	}
+}
+
+var versions = `{
+    "issues": [
+        {"fields": {"assignee": {"displayName": "Veijo Linux"}}},
+        {"fields": {"assignee": {"name": "Milton Waddams"}}},
+        {"fields": {"assignee": {
+            "displayName": "Bill Lumbergh",
+            "name": "bill"
+        }}}
+    ]
+}`
+
+func TestSelectAny(t *testing.T) {
+	result, err := Ctx(versions).
+		Select("issues").
+		SelectAny("fields.assignee.displayName", "fields.assignee.name").
+		Get()
+	if err != nil {
+		t.Fatalf("SelectAny failed: %s", err)
+	}
+	expected := []interface{}{
+		"Veijo Linux", "Milton Waddams", "Bill Lumbergh", "bill",
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("SelectAny: got %v, expected %v", result, expected)
+	}
+	for idx, r := range result {
+		if r != expected[idx] {
+			t.Errorf("SelectAny: got %v, expected %v", result, expected)
+		}
+	}
+	_, err = Ctx(versions).SelectAny("fields", "fields..name").Get()
+	if err == nil {
+		t.Errorf("SelectAny accepted invalid query")
+	}
+}
+
+func TestSelectOr(t *testing.T) {
+	result, err := Ctx(versions).
+		Select("issues").
+		SelectOr("fields.assignee.displayName", "fields.assignee.name").
+		Get()
+	if err != nil {
+		t.Fatalf("SelectOr failed: %s", err)
+	}
+	expected := []interface{}{
+		"Veijo Linux", "Milton Waddams", "Bill Lumbergh",
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("SelectOr: got %v, expected %v", result, expected)
+	}
+	for idx, r := range result {
+		if r != expected[idx] {
+			t.Errorf("SelectOr: got %v, expected %v", result, expected)
+		}
+	}
+
+	result, err = Ctx(assign).
+		SelectOr(`issue.changelog.items[fieldId=="comment"]`,
+			`issue.changelog.items[fieldId=="status"]`).
+		Select("toString").
+		Get()
+	if err != nil {
+		t.Fatalf("SelectOr failed: %s", err)
+	}
+	if len(result) != 1 || result[0] != "development" {
+		t.Errorf("SelectOr: got %v, expected [development]", result)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		q        string
+		expected string
+	}{
+		{`issue.key`, `"OP-1"`},
+		{`issue.changelog.items[fieldId=="assignee"]`,
+			`[{"fieldId":"assignee","fromString":null,"priority":10,"toString":"Veijo Linux"},{"fieldId":"assignee","fromString":"Veijo Linux","priority":10,"toString":"Milton Waddams"}]`},
+		{`issue.changelog.items[fieldId=="none"]`, `[]`},
+	}
+	for _, test := range tests {
+		data, err := Ctx(assign).Select(test.q).Raw()
+		if err != nil {
+			t.Fatalf("Raw failed: %s", err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("Raw %s: got %s, expected %s", test.q, data, test.expected)
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"key": Ctx(assign).Select("issue.key"),
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+	if string(data) != `{"key":"OP-1"}` {
+		t.Errorf("json.Marshal: got %s", data)
+	}
+}
+
+func TestTypedSelections(t *testing.T) {
+	strs, err := Ctx(assign).Select("issue.changelog.items").
+		Select("fromString").Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	if len(strs) != 3 || strs[0] != "backlog" || strs[1] != "" {
+		t.Errorf("Strings: got %v", strs)
+	}
+	ints, err := Ctx(assign).Select("issue.changelog.items").
+		Select("priority").Ints()
+	if err != nil {
+		t.Fatalf("Ints failed: %s", err)
+	}
+	if len(ints) != 3 || ints[0] != 100 || ints[2] != 10 {
+		t.Errorf("Ints: got %v", ints)
+	}
+	floats, err := Ctx(assign).Select("issue.count").Floats()
+	if err != nil {
+		t.Fatalf("Floats failed: %s", err)
+	}
+	if len(floats) != 1 || floats[0] != 42 {
+		t.Errorf("Floats: got %v", floats)
+	}
+	bools, err := Ctx(assign).Select("issue.critical").Bools()
+	if err != nil {
+		t.Fatalf("Bools failed: %s", err)
+	}
+	if len(bools) != 1 || bools[0] {
+		t.Errorf("Bools: got %v", bools)
+	}
+
+	_, err = Ctx(assign).Select("issue.changelog.items").
+		Select("priority").Strings()
+	if err == nil {
+		t.Errorf("Strings accepted numbers")
+	}
+	_, err = Ctx(assign).Select("issue.key").Ints()
+	if err == nil {
+		t.Errorf("Ints accepted strings")
+	}
+	_, err = Ctx(assign).Select("issue.key").Bools()
+	if err == nil {
+		t.Errorf("Bools accepted strings")
+	}
+}
+
+func TestExtractFunc(t *testing.T) {
+	var to []string
+	err := Ctx(assign).
+		Select(`issue.changelog.items[fieldId=="assignee"]`).
+		ExtractFunc(func() interface{} {
+			return new(Assignment)
+		}, func(v interface{}) error {
+			to = append(to, v.(*Assignment).To)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("ExtractFunc failed: %s", err)
+	}
+	if len(to) != 2 || to[0] != "Veijo Linux" || to[1] != "Milton Waddams" {
+		t.Errorf("ExtractFunc: got %v", to)
+	}
+
+	stop := errors.New("stop")
+	var count int
+	err = Ctx(assign).
+		Select(`issue.changelog.items`).
+		ExtractFunc(func() interface{} {
+			return new(Assignment)
+		}, func(v interface{}) error {
+			count++
+			return stop
+		})
+	if err != stop || count != 1 {
+		t.Errorf("ExtractFunc did not stop: err=%v, count=%v", err, count)
+	}
+}
+
+func TestSelectQ(t *testing.T) {
+	q, err := Compile(`issue.changelog.items[fieldId=="assignee"]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		var history []Assignment
+		err = Ctx(assign).SelectQ(q).Extract(&history)
+		if err != nil {
+			t.Fatalf("SelectQ failed: %s", err)
+		}
+		if len(history) != 2 {
+			t.Errorf("SelectQ returned unexpected items: %v", history)
+		}
+	}
+}
+
+func TestImmutable(t *testing.T) {
+	items := Ctx(assign).Select(`issue.changelog.items`)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sel := items.Offset(i % 3).First().Select("toString")
+			if sel.Len() != 1 {
+				errs <- fmt.Errorf("unexpected selection: %v", sel.Len())
+			}
+			_, err := items.Select("nonexistent").Get()
+			if err == nil {
+				errs <- fmt.Errorf("non-existent element found")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if items.Len() != 3 {
+		t.Errorf("selections modified context: %v", items.Len())
+	}
+	_, err := items.Get()
+	if err != nil {
+		t.Errorf("failed selection modified context: %s", err)
+	}
+
+	ctx := Ctx(unmarshal(t, `{"a": [1, 2, 3]}`)).Select("a[]")
+	for name, derived := range map[string]*Context{
+		"Limit":  ctx.Limit(1),
+		"Offset": ctx.Limit(2).Offset(1),
+		"First":  ctx.First(),
+		"Last":   ctx.Limit(2).Last(),
+	} {
+		sel, err := derived.Get()
+		if err != nil {
+			t.Fatalf("%s failed: %s", name, err)
+		}
+		_ = append(sel, "X")
+		all, err := ctx.Get()
+		if err != nil {
+			t.Fatalf("Get failed: %s", err)
+		}
+		if data := marshal(t, all); data != "[1,2,3]" {
+			t.Errorf("append to %s modified parent: %s", name, data)
+		}
+	}
+}
+
+type nativeItem struct {
+	FieldID  string `json:"fieldId"`
+	Priority int    `json:"priority"`
+	To       string `json:"toString"`
+	Internal string `json:"-"`
+}
+
+type nativeBase struct {
+	Key string `json:"key"`
+}
+
+type nativeIssue struct {
+	nativeBase
+	Labels   map[string]string `json:"labels"`
+	Items    []nativeItem      `json:"items,omitempty"`
+	Critical bool
+}
+
+func TestNative(t *testing.T) {
+	v := map[string]*nativeIssue{
+		"issue": {
+			nativeBase: nativeBase{
+				Key: "OP-1",
+			},
+			Labels: map[string]string{
+				"team": "ops",
+			},
+			Items: []nativeItem{
+				{"status", 100, "development", "x"},
+				{"assignee", 10, "Veijo Linux", "y"},
+				{"assignee", 10, "Milton Waddams", "z"},
+			},
+			Critical: true,
+		},
+	}
+	key, err := GetString(v, "issue.key")
+	if err != nil {
+		t.Fatalf("GetString failed: %s", err)
+	}
+	if key != "OP-1" {
+		t.Errorf("GetString: got %s, expected OP-1", key)
+	}
+	team, err := GetString(v, "issue.labels.team")
+	if err != nil {
+		t.Fatalf("GetString failed: %s", err)
+	}
+	if team != "ops" {
+		t.Errorf("GetString: got %s, expected ops", team)
+	}
+	critical, err := GetBool(v, "issue.Critical")
+	if err != nil {
+		t.Fatalf("GetBool failed: %s", err)
+	}
+	if !critical {
+		t.Errorf("GetBool: got %v, expected true", critical)
+	}
+	_, err = Ctx(v).Select("issue.items").Select("Internal").Get()
+	if err == nil {
+		t.Errorf("Get found ignored field")
+	}
+
+	var history []Assignment
+	err = Ctx(v).
+		Select(`issue.items[fieldId=="assignee" && priority==10]`).
+		Extract(&history)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if len(history) != 2 || history[1].To != "Milton Waddams" {
+		t.Errorf("Extract: got %v", history)
+	}
+	ints, err := Ctx(v).Select("issue.items").Select("priority").Ints()
+	if err != nil {
+		t.Fatalf("Ints failed: %s", err)
+	}
+	if len(ints) != 3 || ints[0] != 100 {
+		t.Errorf("Ints: got %v", ints)
+	}
+}
+
+func TestCount(t *testing.T) {
+	count, err := Ctx(assign).
+		Select(`issue.changelog.items[fieldId=="assignee"]`).
+		Count()
+	if err != nil {
+		t.Fatalf("Count failed: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("Count: got %v, expected 2", count)
+	}
+	_, err = Ctx(assign).Select("nonexistent").Count()
+	if err == nil {
+		t.Errorf("Count did not return selection error")
+	}
+}
+
+func BenchmarkExtractArray(b *testing.B) {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		b.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	ctx := Ctx(v).Select(`issue.changelog.items`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var history []Assignment
+		err = ctx.Extract(&history)
+		if err != nil {
+			b.Fatalf("Extract failed: %s", err)
+		}
+	}
+}
+
+func BenchmarkSelectFlatten(b *testing.B) {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		b.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	q, err := Compile(`issue.changelog.items[fieldId=="assignee"].toString`)
+	if err != nil {
+		b.Fatalf("Compile failed: %s", err)
+	}
+	ctx := Ctx(v)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ctx.SelectQ(q).Len() != 2 {
+			b.Fatalf("SelectQ returned unexpected number of items")
+		}
+	}
+}
+
+func TestEvalPath(t *testing.T) {
+	v := parseAssign(t)
+	q, err := Compile(`issue.fields.project.name`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	if len(q.path) != 4 {
+		t.Errorf("key path not precomputed: %v", q.path)
+	}
+	name, err := q.GetString(v)
+	if err != nil || name != "Operations" {
+		t.Errorf("GetString: got %v %v, expected Operations", name, err)
+	}
+	q, err = Compile(`issue.fields.missing.name`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	_, err = q.Eval(v)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Eval did not report missing element: %v", err)
+	}
+	q, err = Compile(`issue.?fields.project`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	if q.path != nil {
+		t.Errorf("key path computed for optional query")
+	}
+}
+
+var custom = `{
+    "issues": [
+        {
+            "key": "OP-1",
+            "fields": {
+                "summary": "Printer on fire",
+                "customfield_10002": "high",
+                "customfield_10001": 3,
+                "customfield_20001": null
+            }
+        },
+        {
+            "key": "OP-2",
+            "fields": {
+                "summary": "Stapler missing",
+                "customfield_10001": 5
+            }
+        }
+    ]
+}`
+
+func TestKeyFilter(t *testing.T) {
+	v := unmarshal(t, custom)
+	vals, err := Get(v, `issues[0].fields[key=~"^customfield_1"]`)
+	if err != nil {
+		t.Fatalf("key filter failed: %s", err)
+	}
+	arr := vals.([]interface{})
+	if len(arr) != 2 || arr[0] != 3.0 || arr[1] != "high" {
+		t.Errorf("unexpected key filter result: %v", arr)
+	}
+
+	n, err := Ctx(v).
+		Select(`issues[].fields[key=~"^customfield_"]`).
+		Count()
+	if err != nil {
+		t.Fatalf("flattened key filter failed: %s", err)
+	}
+	if n != 4 {
+		t.Errorf("unexpected flattened key filter count: %d", n)
+	}
+
+	ints, err := Ctx(v).
+		Select(`issues[].fields[key=~"10001$"]`).
+		Ints()
+	if err != nil {
+		t.Fatalf("key filter selection failed: %s", err)
+	}
+	if len(ints) != 2 || ints[0] != 3 || ints[1] != 5 {
+		t.Errorf("unexpected key filter selection: %v", ints)
+	}
+
+	keys, err := Ctx(v).Select(`issues[key=="OP-2"].key`).Strings()
+	if err != nil {
+		t.Fatalf("key field filter failed: %s", err)
+	}
+	if len(keys) != 1 || keys[0] != "OP-2" {
+		t.Errorf("unexpected key field filter result: %v", keys)
+	}
+
+	vals, err = Get(v, `issues[0].fields[key=~"^nothing"]`)
+	if err != nil {
+		t.Fatalf("empty key filter failed: %s", err)
+	}
+	if len(vals.([]interface{})) != 0 {
+		t.Errorf("unexpected empty key filter result: %v", vals)
+	}
+
+	err = Delete(v, `issues[].fields[key=~"^customfield_"]`)
+	if err != nil {
+		t.Fatalf("key filter Delete failed: %s", err)
+	}
+	summary, err := Get(v, `issues[0].fields`)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	fields := summary.([]interface{})[0].(map[string]interface{})
+	if len(fields) != 1 || fields["summary"] != "Printer on fire" {
+		t.Errorf("unexpected fields after Delete: %v", fields)
+	}
+
+	_, err = Get(v, `issues[key=~"OP"]`)
+	if err == nil {
+		t.Errorf("key filter accepted array")
+	}
+	for _, q := range []string{
+		`fields[key=~"("]`,
+		`fields[key=~x]`,
+		`fields[key=~"x" && a==1]`,
+		`fields[0][key=~"x"]`,
+		`fields[name=~"x"]`,
+	} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+	out, err := Format(`fields[ key =~ "^a\"b" ][0]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if out != `fields[key =~ "^a\"b"][0]` {
+		t.Errorf("Format: got %s", out)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	ctx := Ctx(assign).Select("issue.changelog.items[]")
+	for n, expected := range map[int][]int{
+		1: {1, 1, 1},
+		2: {2, 1},
+		3: {3},
+		5: {3},
+	} {
+		chunks, err := ctx.Chunk(n)
+		if err != nil {
+			t.Fatalf("Chunk(%d) failed: %s", n, err)
+		}
+		if len(chunks) != len(expected) {
+			t.Errorf("Chunk(%d): got %d chunks, expected %d", n, len(chunks),
+				len(expected))
+			continue
+		}
+		for idx, chunk := range chunks {
+			if len(chunk) != expected[idx] {
+				t.Errorf("Chunk(%d): chunk %d has %d elements, expected %d",
+					n, idx, len(chunk), expected[idx])
+			}
+		}
+	}
+
+	chunks, err := ctx.Chunk(1)
+	if err != nil {
+		t.Fatalf("Chunk(1) failed: %s", err)
+	}
+	_ = append(chunks[0], "appended")
+	chunks[2][0] = "replaced"
+	if id, err := GetString(chunks[1][0], "fieldId"); err != nil ||
+		id != "assignee" {
+		t.Errorf("append to chunk modified next chunk: %v", chunks[1])
+	}
+	if _, ok := ctx.selection[2].(map[string]interface{}); !ok {
+		t.Errorf("chunk modification changed selection: %v", ctx.selection[2])
+	}
+
+	chunks, err = ctx.Limit(0).Chunk(2)
+	if err != nil || len(chunks) != 0 {
+		t.Errorf("unexpected empty Chunk result: %v", chunks)
+	}
+	for _, n := range []int{0, -1} {
+		_, err = ctx.Chunk(n)
+		if err == nil {
+			t.Errorf("Chunk accepted size %d", n)
+		}
+	}
+
+	var keys []string
+	err = ctx.ForEachChunk(2, func(chunk []interface{}) error {
+		var ids []string
+		for _, item := range chunk {
+			id, err := GetString(item, "fieldId")
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		keys = append(keys, strings.Join(ids, "+"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachChunk failed: %s", err)
+	}
+	if strings.Join(keys, ",") != "status+assignee,assignee" {
+		t.Errorf("unexpected ForEachChunk result: %v", keys)
+	}
+
+	stop := errors.New("stop")
+	var calls int
+	err = ctx.ForEachChunk(1, func(chunk []interface{}) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("ForEachChunk did not stop: %v, %d calls", err, calls)
+	}
+}
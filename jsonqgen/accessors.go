@@ -0,0 +1,242 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonqgen
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/markkurossi/jsonq"
+)
+
+// accessor describes a generated accessor method.
+type accessor struct {
+	method string
+	query  string
+	typ    string
+	getter string
+}
+
+// getters maps the schema types to the Go types and the query getters
+// of the accessors.
+var getters = map[string][2]string{
+	"bool":   {"bool", "GetBool"},
+	"number": {"float64", "GetNumber"},
+	"string": {"string", "GetString"},
+}
+
+// Accessors generates a Go source file for the package pkg. The file
+// defines the type name wrapping a document and an accessor method
+// for each leaf value of the schema, for example:
+//
+//	// IssueKey returns the value of the query issue.key.
+//	func (p *Payload) IssueKey() (string, error) {
+//	    return payloadIssueKey.GetString(p.doc)
+//	}
+//
+// The queries are compiled once when the package is initialized. The
+// values with a single bool, number, or string type have typed
+// accessors, and all other values, including arrays, have accessors
+// returning interface{}. The array elements have no accessors. The
+// optional fields are marked optional in the queries so their
+// accessors return jsonq.ErrorOptionalMissing if the fields are
+// missing.
+func Accessors(pkg, name string, schema *jsonq.Schema) ([]byte, error) {
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("jsonqgen: schema has no fields")
+	}
+	var accessors []accessor
+	collectAccessors(schema, "", "", make(map[string]bool), &accessors)
+
+	recv := string(unicode.ToLower([]rune(name)[0]))
+	prefix := recv + name[len(recv):]
+
+	var sb strings.Builder
+	sb.WriteString("// Code generated by jsonqgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&sb, "package %s\n\n", pkg)
+	sb.WriteString("import \"github.com/markkurossi/jsonq\"\n\n")
+
+	fmt.Fprintf(&sb, "// %s provides typed accessors to the values of a document.\n",
+		name)
+	fmt.Fprintf(&sb, "type %s struct {\n\tdoc interface{}\n}\n\n", name)
+	fmt.Fprintf(&sb, "// New%s creates accessors for the document doc.\n", name)
+	fmt.Fprintf(&sb, "func New%s(doc interface{}) *%s {\n", name, name)
+	fmt.Fprintf(&sb, "\treturn &%s{\n\t\tdoc: doc,\n\t}\n}\n\n", name)
+
+	sb.WriteString("var (\n")
+	for _, a := range accessors {
+		fmt.Fprintf(&sb, "\t%s%s = jsonq.MustCompile(%s)\n",
+			prefix, a.method, strconv.Quote(a.query))
+	}
+	sb.WriteString(")\n")
+
+	for _, a := range accessors {
+		fmt.Fprintf(&sb, "\n// %s returns the value of the query %s.\n",
+			a.method, a.query)
+		fmt.Fprintf(&sb, "func (%s *%s) %s() (%s, error) {\n",
+			recv, name, a.method, a.typ)
+		fmt.Fprintf(&sb, "\treturn %s%s.%s(%s.doc)\n}\n",
+			prefix, a.method, a.getter, recv)
+	}
+
+	src, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("jsonqgen: %s", err)
+	}
+	return src, nil
+}
+
+// collectAccessors collects the accessors for the leaf fields of the
+// schema s in sorted key order.
+func collectAccessors(s *jsonq.Schema, query, method string,
+	names map[string]bool, result *[]accessor) {
+
+	var keys []string
+	for key := range s.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field := s.Fields[key]
+		q := jsonq.QuoteKey(key)
+		if field.Optional {
+			q = "?" + q
+		}
+		if len(query) > 0 {
+			q = query + "." + q
+		}
+		m := method + goName(key)
+
+		if len(field.Fields) > 0 {
+			collectAccessors(field, q, m, names, result)
+			continue
+		}
+		m = uniqueName(names, m)
+		names[m] = true
+
+		a := accessor{
+			method: m,
+			query:  q,
+			typ:    "interface{}",
+			getter: "Eval",
+		}
+		if len(field.Types) == 1 {
+			if g, ok := getters[field.Types[0]]; ok {
+				a.typ = g[0]
+				a.getter = g[1]
+			}
+		}
+		*result = append(*result, a)
+	}
+}
+
+// jsonSchemaTypes maps the JSON Schema types to the jsonq.Schema
+// types.
+var jsonSchemaTypes = map[string]string{
+	"array":   "array",
+	"boolean": "bool",
+	"integer": "number",
+	"null":    "null",
+	"number":  "number",
+	"object":  "object",
+	"string":  "string",
+}
+
+// FromJSONSchema converts the JSON Schema document doc into a
+// jsonq.Schema. The conversion uses the type, properties, required,
+// and items keywords of the schema. The properties that are not
+// required are optional. The schema references are not supported.
+func FromJSONSchema(doc interface{}) (*jsonq.Schema, error) {
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jsonqgen: schema must be an object, got %T",
+			doc)
+	}
+	if _, ok := m["$ref"]; ok {
+		return nil, fmt.Errorf("jsonqgen: schema references not supported")
+	}
+	s := new(jsonq.Schema)
+
+	var types []string
+	switch t := m["type"].(type) {
+	case nil:
+		if _, ok := m["properties"]; ok {
+			types = append(types, "object")
+		}
+
+	case string:
+		types = append(types, t)
+
+	case []interface{}:
+		for _, el := range t {
+			str, ok := el.(string)
+			if !ok {
+				return nil, fmt.Errorf("jsonqgen: invalid type %v", el)
+			}
+			types = append(types, str)
+		}
+
+	default:
+		return nil, fmt.Errorf("jsonqgen: invalid type %v", t)
+	}
+	seen := make(map[string]bool)
+	for _, t := range types {
+		name, ok := jsonSchemaTypes[t]
+		if !ok {
+			return nil, fmt.Errorf("jsonqgen: unknown type %s", t)
+		}
+		if !seen[name] {
+			seen[name] = true
+			s.Types = append(s.Types, name)
+		}
+	}
+	sort.Strings(s.Types)
+
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("jsonqgen: properties must be an object")
+		}
+		required := make(map[string]bool)
+		if v, ok := m["required"]; ok {
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("jsonqgen: required must be an array")
+			}
+			for _, el := range arr {
+				key, ok := el.(string)
+				if !ok {
+					return nil, fmt.Errorf("jsonqgen: invalid required %v",
+						el)
+				}
+				required[key] = true
+			}
+		}
+		s.Fields = make(map[string]*jsonq.Schema)
+		for key, prop := range props {
+			field, err := FromJSONSchema(prop)
+			if err != nil {
+				return nil, err
+			}
+			field.Optional = !required[key]
+			s.Fields[key] = field
+		}
+	}
+	if v, ok := m["items"]; ok {
+		items, err := FromJSONSchema(v)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	}
+	return s, nil
+}
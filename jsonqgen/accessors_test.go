@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonqgen
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/jsonq"
+)
+
+const jsonSchema = `{
+  "type": "object",
+  "required": ["issue"],
+  "properties": {
+    "issue": {
+      "type": "object",
+      "required": ["key", "id"],
+      "properties": {
+        "key": {"type": "string"},
+        "id": {"type": "integer"},
+        "flagged": {"type": "boolean"},
+        "labels": {"type": "array", "items": {"type": "string"}},
+        "x-y": {"type": ["string", "null"]}
+      }
+    }
+  }
+}`
+
+var reMustCompile = regexp.MustCompile(`jsonq\.MustCompile\(("(?:[^"\\]|\\.)*")\)`)
+
+func parseSchema(t *testing.T) *jsonq.Schema {
+	var v interface{}
+	err := json.Unmarshal([]byte(jsonSchema), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	s, err := FromJSONSchema(v)
+	if err != nil {
+		t.Fatalf("FromJSONSchema failed: %s", err)
+	}
+	return s
+}
+
+func TestFromJSONSchema(t *testing.T) {
+	s := parseSchema(t)
+	issue := s.Fields["issue"]
+	if issue == nil || issue.Optional {
+		t.Fatalf("FromJSONSchema: invalid issue: %v", issue)
+	}
+	tests := []struct {
+		key      string
+		types    string
+		optional bool
+	}{
+		{"key", "string", false},
+		{"id", "number", false},
+		{"flagged", "bool", true},
+		{"labels", "array", true},
+		{"x-y", "null,string", true},
+	}
+	for _, test := range tests {
+		field := issue.Fields[test.key]
+		if field == nil {
+			t.Errorf("FromJSONSchema: field %s missing", test.key)
+			continue
+		}
+		types := strings.Join(field.Types, ",")
+		if types != test.types || field.Optional != test.optional {
+			t.Errorf("FromJSONSchema: %s: got %s/%v, expected %s/%v",
+				test.key, types, field.Optional, test.types, test.optional)
+		}
+	}
+	if issue.Fields["labels"].Items == nil {
+		t.Errorf("FromJSONSchema: labels items missing")
+	}
+
+	for _, invalid := range []string{
+		`[]`,
+		`{"$ref": "#/definitions/issue"}`,
+		`{"type": "date"}`,
+		`{"type": 1}`,
+		`{"properties": []}`,
+		`{"properties": {}, "required": "key"}`,
+	} {
+		var v interface{}
+		err := json.Unmarshal([]byte(invalid), &v)
+		if err != nil {
+			t.Fatalf("json.Unmarshal failed: %s", err)
+		}
+		_, err = FromJSONSchema(v)
+		if err == nil {
+			t.Errorf("FromJSONSchema accepted %s", invalid)
+		}
+	}
+}
+
+func TestAccessors(t *testing.T) {
+	src, err := Accessors("events", "Payload", parseSchema(t))
+	if err != nil {
+		t.Fatalf("Accessors failed: %s", err)
+	}
+	_, err = parser.ParseFile(token.NewFileSet(), "payload.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated source does not parse: %s\n%s", err, src)
+	}
+	for _, expected := range []string{
+		"type Payload struct {",
+		"func NewPayload(doc interface{}) *Payload {",
+		`payloadIssueKey     = jsonq.MustCompile("issue.key")`,
+		"func (p *Payload) IssueKey() (string, error) {",
+		"\treturn payloadIssueKey.GetString(p.doc)",
+		"func (p *Payload) IssueID() (float64, error) {",
+		"func (p *Payload) IssueFlagged() (bool, error) {",
+		`payloadIssueFlagged = jsonq.MustCompile("issue.?flagged")`,
+		"func (p *Payload) IssueLabels() (interface{}, error) {",
+		"\treturn payloadIssueLabels.Eval(p.doc)",
+		`payloadIssueXY      = jsonq.MustCompile("issue.?\"x-y\"")`,
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Errorf("Accessors: %q missing from:\n%s", expected, src)
+		}
+	}
+
+	var doc interface{}
+	err = json.Unmarshal([]byte(`{"issue": {"key": "OPS-1", "id": 7}}`), &doc)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	matches := reMustCompile.FindAllSubmatch(src, -1)
+	if len(matches) != 5 {
+		t.Fatalf("Accessors: got %d queries, expected 5", len(matches))
+	}
+	for _, m := range matches {
+		q, err := strconv.Unquote(string(m[1]))
+		if err != nil {
+			t.Fatalf("strconv.Unquote failed: %s", err)
+		}
+		_, err = jsonq.Get(doc, q)
+		if err != nil && err != jsonq.ErrorOptionalMissing {
+			t.Errorf("query %s: %s", q, err)
+		}
+	}
+
+	_, err = Accessors("events", "Payload", &jsonq.Schema{})
+	if err == nil {
+		t.Errorf("Accessors accepted schema without fields")
+	}
+}
@@ -0,0 +1,321 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+// Package jsonqgen generates Go struct definitions for extracting
+// values with jsonq. The generator evaluates the field queries
+// against a sample document and infers the Go types of the fields
+// from the selected values, for example:
+//
+//	src, err := jsonqgen.File("events", "Issue", sample, []jsonqgen.Field{
+//	    {Query: "issue.key"},
+//	    {Name: "Project", Query: "issue.fields.project.name"},
+//	    {Query: "issue.?created"},
+//	})
+//
+// generates the file:
+//
+//	package events
+//
+//	import "time"
+//
+//	type Issue struct {
+//	    Key     string    `jsonq:"issue.key"`
+//	    Project string    `jsonq:"issue.fields.project.name"`
+//	    Created time.Time `jsonq:"issue.?created"`
+//	}
+//
+// The Accessors function generates typed accessor methods for the
+// leaf values of a schema.
+package jsonqgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/markkurossi/jsonq"
+)
+
+// Field defines a field of the generated struct.
+type Field struct {
+	// Name is the Go name of the field. If the name is empty, it is
+	// derived from the last key of the query.
+	Name string
+	// Query selects the value of the field.
+	Query string
+}
+
+// Struct generates the definition of the struct type name with a
+// field for each argument field. The field types are inferred from
+// the values that the field queries select from the sample document
+// doc. The function returns the formatted definition and the sorted
+// import paths of the packages that the definition uses.
+func Struct(name string, doc interface{}, fields []Field) (
+	string, []string, error) {
+
+	imports := make(map[string]bool)
+	names := make(map[string]bool)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "type %s struct {\n", name)
+	for _, field := range fields {
+		v, err := jsonq.Get(doc, field.Query)
+		if err != nil {
+			return "", nil, fmt.Errorf("jsonqgen: query %q: %s",
+				field.Query, strings.TrimPrefix(err.Error(), "jsonq: "))
+		}
+		typ, pkg, err := goType(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("jsonqgen: query %q: %s",
+				field.Query, err)
+		}
+		if len(pkg) > 0 {
+			imports[pkg] = true
+		}
+		fieldName := field.Name
+		if len(fieldName) == 0 {
+			fieldName = uniqueName(names, goName(lastKey(field.Query)))
+		} else if names[fieldName] {
+			return "", nil, fmt.Errorf("jsonqgen: duplicate field %s",
+				fieldName)
+		}
+		names[fieldName] = true
+
+		fmt.Fprintf(&sb, "\t%s %s `jsonq:%s`\n", fieldName, typ,
+			strconv.Quote(field.Query))
+	}
+	sb.WriteString("}\n")
+
+	src, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return "", nil, fmt.Errorf("jsonqgen: %s", err)
+	}
+	var result []string
+	for pkg := range imports {
+		result = append(result, pkg)
+	}
+	sort.Strings(result)
+	return string(src), result, nil
+}
+
+// File generates a Go source file for the package pkg. The file
+// contains the imports and the definition of the struct type name
+// generated with Struct.
+func File(pkg, name string, doc interface{}, fields []Field) (
+	[]byte, error) {
+
+	def, imports, err := Struct(name, doc, fields)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "package %s\n\n", pkg)
+	if len(imports) > 0 {
+		sb.WriteString("import (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&sb, "\t%s\n", strconv.Quote(imp))
+		}
+		sb.WriteString(")\n\n")
+	}
+	sb.WriteString(def)
+
+	src, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("jsonqgen: %s", err)
+	}
+	return src, nil
+}
+
+// goType returns the Go type for the value v and the import path of
+// the type's package.
+func goType(v interface{}) (string, string, error) {
+	switch val := v.(type) {
+	case nil:
+		// The null values are extracted as empty strings.
+		return "string", "", nil
+
+	case bool:
+		return "bool", "", nil
+
+	case string:
+		_, err := time.Parse(time.RFC3339Nano, val)
+		if err == nil {
+			return "time.Time", "time", nil
+		}
+		return "string", "", nil
+
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return "int", "", nil
+		}
+		return "float64", "", nil
+
+	case json.Number:
+		_, err := val.Int64()
+		if err == nil {
+			return "int", "", nil
+		}
+		if strings.IndexAny(string(val), ".eE") < 0 {
+			return "*big.Int", "math/big", nil
+		}
+		return "float64", "", nil
+
+	case map[string]interface{}:
+		elem, pkg := "interface{}", ""
+		for idx, key := range sortedKeys(val) {
+			typ, p, err := goType(val[key])
+			if err != nil || (idx > 0 && typ != elem) {
+				elem, pkg = "interface{}", ""
+				break
+			}
+			elem, pkg = typ, p
+		}
+		return "map[string]" + elem, pkg, nil
+
+	case []interface{}:
+		return "", "", fmt.Errorf("arrays not supported by Extract")
+
+	default:
+		return "", "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lastKey returns the last key of the query q's path. The keys inside
+// filters, function call arguments, and object constructors are
+// skipped.
+func lastKey(q string) string {
+	var key strings.Builder
+	var depth int
+
+	for i := 0; i < len(q); i++ {
+		ch := q[i]
+		switch ch {
+		case '"':
+			end := i + 1
+			for ; end < len(q) && q[end] != '"'; end++ {
+				if q[end] == '\\' {
+					end++
+				}
+			}
+			if depth == 0 && end < len(q) {
+				str, err := strconv.Unquote(q[i : end+1])
+				if err == nil {
+					key.WriteString(str)
+				}
+			}
+			i = end
+
+		case '[', '(', '{':
+			depth++
+
+		case ']', ')', '}':
+			depth--
+
+		case '.':
+			if depth == 0 {
+				key.Reset()
+			}
+
+		case ':':
+			if depth == 0 {
+				// The type assertion ends the path.
+				return key.String()
+			}
+
+		case '?', ' ', '\t', '\n':
+
+		default:
+			if depth == 0 {
+				key.WriteByte(ch)
+			}
+		}
+	}
+	return key.String()
+}
+
+var initialisms = map[string]bool{
+	"api":  true,
+	"html": true,
+	"http": true,
+	"id":   true,
+	"json": true,
+	"uri":  true,
+	"url":  true,
+	"uuid": true,
+}
+
+// goName converts the key into an exported Go identifier. The words
+// of the key are separated by non-alphanumeric characters and by
+// lowercase to uppercase transitions.
+func goName(key string) string {
+	var words []string
+	var word []rune
+	var prev rune
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			prev = r
+			continue
+		}
+		if unicode.IsUpper(r) && unicode.IsLower(prev) && len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+		word = append(word, r)
+		prev = r
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+
+	var sb strings.Builder
+	for _, w := range words {
+		if initialisms[strings.ToLower(w)] {
+			sb.WriteString(strings.ToUpper(w))
+			continue
+		}
+		runes := []rune(w)
+		sb.WriteRune(unicode.ToUpper(runes[0]))
+		sb.WriteString(string(runes[1:]))
+	}
+	name := sb.String()
+	if len(name) == 0 || !unicode.IsLetter([]rune(name)[0]) {
+		name = "Field" + name
+	}
+	return name
+}
+
+// uniqueName returns the name, or the name with a numeric suffix, so
+// that the result is not in names.
+func uniqueName(names map[string]bool, name string) string {
+	if !names[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		n := fmt.Sprintf("%s%d", name, i)
+		if !names[n] {
+			return n
+		}
+	}
+}
@@ -0,0 +1,140 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonqgen
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const sample = `{
+  "issue": {
+    "id": 10001,
+    "key": "OPS-1",
+    "created": "2020-06-01T12:00:00Z",
+    "fields": {
+      "project": {"name": "Operations"},
+      "customfield_10": "team-a",
+      "customfield_11": "P1",
+      "ratio": 0.5,
+      "flagged": false,
+      "resolution": null
+    },
+    "counts": {"open": 2, "done": 5},
+    "labels": ["a", "b"]
+  },
+  "issue_event_type_name": "issue_assigned",
+  "big": 100000000000000000000
+}`
+
+func parseSample(t *testing.T) interface{} {
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(sample))
+	d.UseNumber()
+	err := d.Decode(&v)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	return v
+}
+
+func TestFile(t *testing.T) {
+	src, err := File("events", "Issue", parseSample(t), []Field{
+		{Query: "issue.id"},
+		{Query: "issue.key"},
+		{Query: "issue.created"},
+		{Name: "Project", Query: "issue.fields.project.name"},
+		{Query: `issue.fields."customfield_10"`},
+		{Query: "issue.fields.ratio"},
+		{Query: "issue.fields.flagged"},
+		{Query: "issue.fields.resolution::null"},
+		{Query: "issue.counts"},
+		{Query: "issue_event_type_name"},
+		{Query: "big"},
+		{Query: "issue.key"},
+	})
+	if err != nil {
+		t.Fatalf("File failed: %s", err)
+	}
+	expected := "package events\n" +
+		"\n" +
+		"import (\n" +
+		"\t\"math/big\"\n" +
+		"\t\"time\"\n" +
+		")\n" +
+		"\n" +
+		"type Issue struct {\n" +
+		"\tID                 int            `jsonq:\"issue.id\"`\n" +
+		"\tKey                string         `jsonq:\"issue.key\"`\n" +
+		"\tCreated            time.Time      `jsonq:\"issue.created\"`\n" +
+		"\tProject            string         `jsonq:\"issue.fields.project.name\"`\n" +
+		"\tCustomfield10      string         `jsonq:\"issue.fields.\\\"customfield_10\\\"\"`\n" +
+		"\tRatio              float64        `jsonq:\"issue.fields.ratio\"`\n" +
+		"\tFlagged            bool           `jsonq:\"issue.fields.flagged\"`\n" +
+		"\tResolution         string         `jsonq:\"issue.fields.resolution::null\"`\n" +
+		"\tCounts             map[string]int `jsonq:\"issue.counts\"`\n" +
+		"\tIssueEventTypeName string         `jsonq:\"issue_event_type_name\"`\n" +
+		"\tBig                *big.Int       `jsonq:\"big\"`\n" +
+		"\tKey2               string         `jsonq:\"issue.key\"`\n" +
+		"}\n"
+	if string(src) != expected {
+		t.Errorf("File: got\n%s\nexpected\n%s", src, expected)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	doc := parseSample(t)
+
+	def, imports, err := Struct("Fields", doc, []Field{
+		{Query: "issue.fields"},
+	})
+	if err != nil {
+		t.Fatalf("Struct failed: %s", err)
+	}
+	if !strings.Contains(def, "map[string]interface{}") || len(imports) != 0 {
+		t.Errorf("Struct: got %s, imports %v", def, imports)
+	}
+
+	for _, fields := range [][]Field{
+		{{Query: "issue.labels"}},
+		{{Query: "issue.missing"}},
+		{{Query: "issue["}},
+		{{Name: "Key", Query: "issue.key"}, {Name: "Key", Query: "issue.id"}},
+	} {
+		_, _, err = Struct("Invalid", doc, fields)
+		if err == nil {
+			t.Errorf("Struct accepted %v", fields)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"issue.key", "Key"},
+		{"issue.?fieldId", "FieldID"},
+		{`issue."Content-Type"`, "ContentType"},
+		{`issue."a.b"`, "AB"},
+		{`items[fieldId == "x.y"][0].toString`, "ToString"},
+		{"issue.key::string", "Key"},
+		{"items.HTMLURL", "HTMLURL"},
+		{`"10"`, "Field10"},
+	}
+	for _, test := range tests {
+		name := goName(lastKey(test.query))
+		if name != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.query, name, test.expected)
+		}
+	}
+	names := map[string]bool{"Key": true, "Key2": true}
+	if name := uniqueName(names, "Key"); name != "Key3" {
+		t.Errorf("uniqueName: got %s", name)
+	}
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+// Package jsonqrepl implements an interactive read-eval-print loop
+// for developing jsonq queries against a document. The document is
+// loaded once and the queries are refined iteratively. The REPL
+// completes object keys derived from the document: a line ending with
+// a tab character prints the completions of the line instead of
+// evaluating it. Line editors can also call Complete directly to
+// implement completion on the tab key.
+package jsonqrepl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/markkurossi/jsonq"
+)
+
+// DefaultPrompt specifies the default REPL prompt.
+const DefaultPrompt = "jsonq> "
+
+// REPL implements the read-eval-print loop for a document.
+type REPL struct {
+	// Prompt is printed before reading each line.
+	Prompt string
+	doc    interface{}
+}
+
+// New creates a new REPL for the document.
+func New(doc interface{}) *REPL {
+	return &REPL{
+		Prompt: DefaultPrompt,
+		doc:    doc,
+	}
+}
+
+// Load creates a new REPL for the JSON document read from r.
+func Load(r io.Reader) (*REPL, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return New(doc), nil
+}
+
+// Run reads lines from in and writes the results to out until in is
+// exhausted or the user enters the :quit command. The lines are
+// evaluated as jsonq queries unless they start with one of the
+// following commands:
+//
+//	:jq EXPR       evaluate jq expression EXPR
+//	:explain QUERY explain the query plan of QUERY
+//	:keys QUERY    list the keys of the objects selected by QUERY
+//	:help          print help
+//	:quit          exit the REPL
+func (r *REPL) Run(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, r.Prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		line := scanner.Text()
+		if strings.HasSuffix(line, "\t") {
+			for _, c := range r.Complete(strings.TrimRight(line, "\t")) {
+				fmt.Fprintln(out, c)
+			}
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == ":quit" || line == ":q" {
+			return nil
+		}
+		err := r.eval(line, out)
+		if err != nil {
+			fmt.Fprintf(out, "error: %s\n", err)
+		}
+	}
+}
+
+func (r *REPL) eval(line string, out io.Writer) error {
+	cmd, arg := line, ""
+	if strings.HasPrefix(line, ":") {
+		idx := strings.IndexAny(line, " \t")
+		if idx > 0 {
+			cmd, arg = line[:idx], strings.TrimSpace(line[idx:])
+		}
+	} else {
+		cmd, arg = "", line
+	}
+	switch cmd {
+	case "":
+		if len(arg) == 0 {
+			return nil
+		}
+		q, err := jsonq.Compile(arg)
+		if err != nil {
+			return err
+		}
+		return r.print(q, out)
+
+	case ":jq":
+		q, err := jsonq.CompileJQ(arg)
+		if err != nil {
+			return err
+		}
+		return r.print(q, out)
+
+	case ":explain":
+		q, err := jsonq.Compile(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, q.Explain())
+		return nil
+
+	case ":keys":
+		var v interface{} = r.doc
+		if len(arg) > 0 {
+			var err error
+			v, err = jsonq.Get(r.doc, arg)
+			if err != nil {
+				return err
+			}
+		}
+		for _, key := range keys(v, strings.IndexByte(arg, '[') >= 0) {
+			fmt.Fprintln(out, key)
+		}
+		return nil
+
+	case ":help":
+		fmt.Fprint(out, help)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown command %s", cmd)
+	}
+}
+
+const help = `Enter a query to evaluate it against the document. End the line
+with a tab character to list its completions. Commands:
+  :jq EXPR        evaluate jq expression EXPR
+  :explain QUERY  explain the query plan of QUERY
+  :keys [QUERY]   list the keys of the objects selected by QUERY
+  :help           print this help
+  :quit           exit
+`
+
+func (r *REPL) print(q *jsonq.Query, out io.Writer) error {
+	v, err := q.Eval(r.doc)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n", data)
+	return nil
+}
+
+// Complete returns the completions for the partial query line. The
+// completions are full lines extending the line with the object keys
+// of the document. Inside a filter, the keys are completed from the
+// elements of the filtered array.
+func (r *REPL) Complete(line string) []string {
+	var base, partial string
+	var v interface{}
+	var elements bool
+
+	bracket := strings.LastIndexByte(line, '[')
+	if bracket > strings.LastIndexByte(line, ']') {
+		// Inside filter: complete the last field of the filter
+		// expression from the elements of the filtered array.
+		start := strings.LastIndexAny(line, "[&| !=<>") + 1
+		base, partial = line[:start], line[start:]
+		v = r.value(line[:bracket])
+		elements = true
+	} else {
+		dot := strings.LastIndexByte(line, '.')
+		if dot >= 0 {
+			base, partial = line[:dot+1], line[dot+1:]
+			v = r.value(line[:dot])
+			elements = strings.IndexByte(line[:dot], '[') >= 0
+		} else {
+			partial = line
+			v = r.doc
+		}
+		if strings.HasPrefix(partial, "?") {
+			base += "?"
+			partial = partial[1:]
+		}
+	}
+	var result []string
+	for _, key := range keys(v, elements) {
+		if strings.HasPrefix(key, partial) {
+			result = append(result, base+key)
+		}
+	}
+	return result
+}
+
+// value evaluates the query q against the document. The empty query
+// selects the whole document. The function returns nil if the query
+// fails.
+func (r *REPL) value(q string) interface{} {
+	if len(q) == 0 {
+		return r.doc
+	}
+	v, err := jsonq.Get(r.doc, q)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// keys returns the sorted object keys of the value v. If elements is
+// true and v is an array, the function returns the union of its
+// elements' keys.
+func keys(v interface{}, elements bool) []string {
+	seen := make(map[string]bool)
+	add := func(v interface{}) {
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key := range obj {
+				seen[key] = true
+			}
+		}
+	}
+	if arr, ok := v.([]interface{}); ok && elements {
+		for _, item := range arr {
+			add(item)
+		}
+	} else {
+		add(v)
+	}
+	var result []string
+	for key := range seen {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonqrepl
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const doc = `{
+  "issue": {
+    "key": "OPS-1",
+    "changelog": {
+      "items": [
+        {"fieldId": "assignee", "toString": "Veijo Linux"},
+        {"fieldId": "status", "toString": "development", "from": "backlog"}
+      ]
+    }
+  }
+}`
+
+func TestComplete(t *testing.T) {
+	repl, err := Load(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"is", []string{"issue"}},
+		{"issue.", []string{"issue.changelog", "issue.key"}},
+		{"issue.?k", []string{"issue.?key"}},
+		{"issue.changelog.items", []string{"issue.changelog.items"}},
+		{"issue.changelog.items.", nil},
+		{"issue.changelog.items[f", []string{
+			"issue.changelog.items[fieldId",
+			"issue.changelog.items[from",
+		}},
+		{`issue.changelog.items[fieldId=="status" && t`, []string{
+			`issue.changelog.items[fieldId=="status" && toString`,
+		}},
+		{"issue.changelog.items[].t", []string{
+			"issue.changelog.items[].toString",
+		}},
+		{"missing.", nil},
+	}
+	for _, test := range tests {
+		result := repl.Complete(test.line)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Complete(%q): got %q, expected %q",
+				test.line, result, test.expected)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	repl, err := Load(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	repl.Prompt = ""
+	in := strings.NewReader(`issue.key
+issue.ch	
+:jq .issue.changelog.items[] | select(.fieldId=="status") | .from
+:keys issue
+issue.missing
+:quit
+issue.key
+`)
+	var out bytes.Buffer
+	err = repl.Run(in, &out)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	expected := `"OPS-1"
+issue.changelog
+[
+  "backlog"
+]
+changelog
+key
+error: jsonq: element 'issue.missing' not found: no key 'missing' in 'issue', available keys: changelog, key
+`
+	if out.String() != expected {
+		t.Errorf("Run: got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
@@ -0,0 +1,115 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+// Package jsonqtest implements test helpers for comparing jsonq
+// selections against golden files. The golden files hold the expected
+// selections as indented JSON with sorted object keys so the changes
+// produce stable diffs. The tests update the golden files when they
+// are run with the -jsonqtest.update flag. The flag is namespaced so
+// that it does not conflict with the tests' own -update flags. For
+// example:
+//
+//	func TestAssignees(t *testing.T) {
+//	    ctx := jsonq.Ctx(payload).Select("issue.changelog.items[fieldId == \"assignee\"]")
+//	    jsonqtest.MatchGolden(t, ctx, "testdata/assignees.json")
+//	}
+package jsonqtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/jsonq"
+)
+
+var update = flag.Bool("jsonqtest.update", false,
+	"update the jsonqtest golden files")
+
+// MatchGolden marshals the current selection of the context ctx and
+// compares it against the golden file. If the selection does not
+// match the file, MatchGolden reports the differences as JSON Patch
+// operations from the golden file to the selection. If the test is
+// run with the -jsonqtest.update flag, MatchGolden writes the selection to the
+// golden file instead.
+func MatchGolden(t testing.TB, ctx *jsonq.Context, file string) {
+	t.Helper()
+
+	data, err := ctx.Raw()
+	if err != nil {
+		t.Fatalf("jsonqtest: %s: %s", file, err)
+		return
+	}
+	got, gotValue, err := normalize(data)
+	if err != nil {
+		t.Fatalf("jsonqtest: %s: %s", file, err)
+		return
+	}
+	if *update {
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(file, got, 0644)
+		}
+		if err != nil {
+			t.Fatalf("jsonqtest: %s", err)
+		}
+		return
+	}
+
+	data, err = ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("jsonqtest: %s (run with -jsonqtest.update to create)", err)
+		return
+	}
+	want, wantValue, err := normalize(data)
+	if err != nil {
+		t.Fatalf("jsonqtest: golden file %s: %s", file, err)
+		return
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	ops, err := jsonq.Diff(wantValue, gotValue)
+	if err != nil {
+		t.Fatalf("jsonqtest: %s: %s", file, err)
+		return
+	}
+	var lines []string
+	for _, op := range ops {
+		lines = append(lines, "\t"+op.String())
+	}
+	t.Errorf("jsonqtest: selection does not match golden file %s:\n%s",
+		file, strings.Join(lines, "\n"))
+}
+
+// normalize decodes the JSON data and encodes it as indented JSON with
+// sorted object keys. It returns the normalized data and the decoded
+// value.
+func normalize(data []byte) ([]byte, interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v interface{}
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "  ")
+	err = e.Encode(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), v, nil
+}
@@ -0,0 +1,116 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonqtest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/markkurossi/jsonq"
+)
+
+const payload = `{
+  "issue": {
+    "key": "OPS-1",
+    "changelog": {
+      "items": [
+        {"fieldId": "status", "toString": "Done", "priority": 100},
+        {"fieldId": "assignee", "toString": "Veijo Linux", "priority": 10},
+        {"fieldId": "assignee", "toString": "Markku <mtr>", "priority": 10}
+      ]
+    }
+  }
+}`
+
+const assignees = `issue.changelog.items[fieldId == "assignee"]`
+
+// recorder records the failures of MatchGolden.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+func TestMatchGolden(t *testing.T) {
+	ctx := jsonq.Ctx(payload).Select(assignees)
+	MatchGolden(t, ctx, "testdata/assignees.json")
+}
+
+func TestMatchGoldenMismatch(t *testing.T) {
+	r := &recorder{TB: t}
+	ctx := jsonq.Ctx(payload).Select(`issue.changelog.items[priority == 10]`)
+	MatchGolden(r, ctx, "testdata/assignees.json")
+	if len(r.errors) != 0 {
+		t.Errorf("MatchGolden failed: %v", r.errors)
+	}
+
+	r = &recorder{TB: t}
+	ctx = jsonq.Ctx(payload).Select(`issue.changelog.items[toString != "Markku <mtr>"]`)
+	MatchGolden(r, ctx, "testdata/assignees.json")
+	if len(r.errors) != 1 {
+		t.Fatalf("MatchGolden: got %d errors, expected 1", len(r.errors))
+	}
+	if !strings.Contains(r.errors[0], "replace /0/fieldId status") {
+		t.Errorf("MatchGolden: unexpected error: %s", r.errors[0])
+	}
+
+	r = &recorder{TB: t}
+	MatchGolden(r, ctx, "testdata/nonexistent.json")
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "-jsonqtest.update") {
+		t.Errorf("MatchGolden: unexpected errors: %v", r.errors)
+	}
+}
+
+func TestUpdateFlag(t *testing.T) {
+	if flag.Lookup("jsonqtest.update") == nil {
+		t.Errorf("jsonqtest.update flag not registered")
+	}
+	if flag.Lookup("update") != nil {
+		t.Errorf("jsonqtest registered the -update flag")
+	}
+}
+
+func TestMatchGoldenUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonqtest")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "golden", "assignees.json")
+
+	*update = true
+	ctx := jsonq.Ctx(payload).Select(assignees)
+	MatchGolden(t, ctx, file)
+	*update = false
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed: %s", err)
+	}
+	expected, err := ioutil.ReadFile("testdata/assignees.json")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed: %s", err)
+	}
+	if string(data) != string(expected) {
+		t.Errorf("MatchGolden -jsonqtest.update: got\n%s\nexpected\n%s", data, expected)
+	}
+	MatchGolden(t, ctx, file)
+}
@@ -7,12 +7,14 @@
 package jsonq
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"unicode"
+	"unicode/utf8"
 )
 
 type tokenType int
@@ -22,6 +24,9 @@ const (
 	tLBracket
 	tRBracket
 	tQuestionMark
+	tLParen
+	tRParen
+	tPipe
 	tAnd
 	tOr
 	tEq
@@ -32,6 +37,20 @@ const (
 	tGe
 	tString
 	tInt
+	tColonColon
+	tNull
+	tVariable
+	tAssign
+	tSemicolon
+	tPlus
+	tComma
+	tExpr
+	tMatch
+	tLBrace
+	tRBrace
+	tColon
+	tStar
+	tLiteral
 )
 
 var tokens = map[tokenType]string{
@@ -39,6 +58,9 @@ var tokens = map[tokenType]string{
 	tLBracket:     "[",
 	tRBracket:     "]",
 	tQuestionMark: "?",
+	tLParen:       "(",
+	tRParen:       ")",
+	tPipe:         "|",
 	tAnd:          "&&",
 	tOr:           "||",
 	tEq:           "==",
@@ -49,6 +71,20 @@ var tokens = map[tokenType]string{
 	tGe:           ">=",
 	tString:       "string",
 	tInt:          "int",
+	tColonColon:   "::",
+	tNull:         "null",
+	tVariable:     "variable",
+	tAssign:       "=",
+	tSemicolon:    ";",
+	tPlus:         "+",
+	tComma:        ",",
+	tExpr:         "expression",
+	tMatch:        "=~",
+	tLBrace:       "{",
+	tRBrace:       "}",
+	tColon:        ":",
+	tStar:         "*",
+	tLiteral:      "string literal",
 }
 
 func (tt tokenType) String() string {
@@ -63,240 +99,470 @@ type token struct {
 	Type   tokenType
 	StrVal string
 	Int    int
+	Big    *big.Int
+	Quoted bool
 }
 
+// keyword returns the token for the keyword kw.
+func keyword(kw string) token {
+	return token{
+		Type:   tString,
+		StrVal: kw,
+	}
+}
+
+// is tests if the token t is the token o. The keyword tokens match
+// the unquoted identifiers with the same name.
+func (t token) is(o token) bool {
+	if t.Type != o.Type {
+		return false
+	}
+	if t.Type == tString {
+		return !t.Quoted && t.StrVal == o.StrVal
+	}
+	return true
+}
+
+func (t token) String() string {
+	if t.Type == tString {
+		return t.StrVal
+	}
+	return t.Type.String()
+}
+
+// lexer tokenizes query strings. It indexes the input string directly
+// and returns tokens by value so that lexing does not allocate
+// memory.
 type lexer struct {
-	input    string
-	in       *bufio.Reader
-	pos      int
-	lastSize int
-	unget    *token
+	input     string
+	pos       int
+	start     int
+	unget     token
+	hasUnget  bool
+	tokens    int
+	maxTokens int
+	nesting   int
+	maxNest   int
+	vars      []string
+	segments  int
+	filters   int
+	calls     int
+	sql       bool
 }
 
 func newLexer(input string) *lexer {
 	return &lexer{
-		input: input,
-		in:    bufio.NewReader(strings.NewReader(input)),
+		input:     input,
+		maxTokens: int(atomic.LoadInt32(&maxQueryTokens)),
+		maxNest:   int(atomic.LoadInt32(&maxQueryDepth)),
 	}
 }
 
-func (l *lexer) Get() (*token, error) {
-	if l.unget != nil {
-		ret := l.unget
-		l.unget = nil
-		return ret, nil
+// complexity returns the complexity of the parsed query. The
+// complexity is the product of the number of path segments, the
+// number of filters plus one, and the number of function calls plus
+// one.
+func (l *lexer) complexity() int {
+	return l.segments * (l.filters + 1) * (l.calls + 1)
+}
+
+func (l *lexer) Get() (token, error) {
+	if l.hasUnget {
+		l.hasUnget = false
+		return l.unget, nil
 	}
-	var r rune
-	var err error
-	for {
-		r, _, err = l.ReadRune()
-		if err != nil {
-			return nil, err
-		}
+	// Skip whitespace.
+	for l.pos < len(l.input) {
+		r, size := l.peekRune()
 		if !unicode.IsSpace(r) {
 			break
 		}
+		l.pos += size
+	}
+	l.start = l.pos
+	if l.pos >= len(l.input) {
+		return token{}, io.EOF
 	}
-	switch r {
+	l.tokens++
+	if l.maxTokens > 0 && l.tokens > l.maxTokens {
+		return token{}, fmt.Errorf("jsonq: too many tokens in query, maximum is %d",
+			l.maxTokens)
+	}
+
+	switch l.input[l.pos] {
 	case '.':
-		return &token{
-			Type: tDot,
-		}, nil
+		return l.single(tDot)
 
 	case '[':
-		return &token{
-			Type: tLBracket,
-		}, nil
+		return l.single(tLBracket)
 
 	case ']':
-		return &token{
-			Type: tRBracket,
-		}, nil
+		return l.single(tRBracket)
 
 	case '?':
-		return &token{
-			Type: tQuestionMark,
-		}, nil
+		return l.single(tQuestionMark)
+
+	case '(':
+		return l.single(tLParen)
+
+	case ')':
+		return l.single(tRParen)
 
 	case '&':
-		r, _, err = l.ReadRune()
-		if err != nil {
-			return nil, err
+		if l.next('&') {
+			return token{Type: tAnd}, nil
 		}
-		if r != '&' {
-			l.UnreadRune()
-			return nil, l.SyntaxError()
-		}
-		return &token{
-			Type: tAnd,
-		}, nil
+		l.pos++
+		return token{}, l.SyntaxError("'&&'")
 
 	case '|':
-		r, _, err = l.ReadRune()
-		if err != nil {
-			return nil, err
-		}
-		if r != '|' {
-			l.UnreadRune()
-			return nil, l.SyntaxError()
+		if l.next('|') {
+			return token{Type: tOr}, nil
 		}
-		return &token{
-			Type: tOr,
-		}, nil
+		return l.single(tPipe)
 
 	case '=':
-		r, _, err = l.ReadRune()
-		if err != nil {
-			return nil, err
+		if l.next('=') {
+			return token{Type: tEq}, nil
+		}
+		if l.next('~') {
+			return token{Type: tMatch}, nil
 		}
-		if r != '=' {
-			l.UnreadRune()
-			return nil, l.SyntaxError()
+		return l.single(tAssign)
+
+	case ';':
+		return l.single(tSemicolon)
+
+	case '+':
+		return l.single(tPlus)
+
+	case '*':
+		return l.single(tStar)
+
+	case ',':
+		return l.single(tComma)
+
+	case '$':
+		l.pos++
+		name := l.identifier()
+		if len(name) == 0 {
+			return token{}, l.SyntaxError("variable name")
 		}
-		return &token{
-			Type: tEq,
+		return token{
+			Type:   tVariable,
+			StrVal: name,
 		}, nil
 
 	case '!':
-		r, _, err := l.ReadRune()
-		if err != nil {
-			return nil, err
-		}
-		if r != '=' {
-			l.UnreadRune()
-			return nil, l.SyntaxError()
+		if l.next('=') {
+			return token{Type: tNeq}, nil
 		}
-		return &token{
-			Type: tNeq,
-		}, nil
+		l.pos++
+		return token{}, l.SyntaxError("'!='")
 
 	case '<':
-		r, _, err := l.ReadRune()
-		if err != nil {
-			return nil, err
+		if l.next('=') {
+			return token{Type: tLe}, nil
 		}
-		if r == '=' {
-			return &token{
-				Type: tLe,
-			}, nil
+		if l.sql && l.next('>') {
+			return token{Type: tNeq}, nil
 		}
-		l.UnreadRune()
-		return &token{
-			Type: tLt,
-		}, nil
+		return l.single(tLt)
 
 	case '>':
-		r, _, err := l.ReadRune()
-		if err != nil {
-			return nil, err
+		if l.next('=') {
+			return token{Type: tGe}, nil
 		}
-		if r == '=' {
-			return &token{
-				Type: tGe,
-			}, nil
+		return l.single(tGt)
+
+	case ':':
+		if l.next(':') {
+			return token{Type: tColonColon}, nil
 		}
-		l.UnreadRune()
-		return &token{
-			Type: tGt,
-		}, nil
+		return l.single(tColon)
+
+	case '{':
+		return l.single(tLBrace)
+
+	case '}':
+		return l.single(tRBrace)
 
 	case '"':
-		var str []rune
-		for {
-			r, _, err = l.ReadRune()
-			if err != nil {
-				return nil, err
-			}
-			if r == '"' {
-				break
-			}
-			// XXX escapes
-			str = append(str, r)
+		return l.quoted()
+
+	case '\'':
+		if l.sql {
+			return l.literal()
 		}
-		return &token{
+	}
+
+	name := l.identifier()
+	if len(name) > 0 {
+		return token{
 			Type:   tString,
-			StrVal: string(str),
+			StrVal: name,
 		}, nil
+	}
+	if isDigit(l.input[l.pos]) {
+		start := l.pos
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+		ival, err := strconv.Atoi(l.input[start:l.pos])
+		if err != nil {
+			// The integers not fitting into int are big integers.
+			bval, ok := new(big.Int).SetString(l.input[start:l.pos], 10)
+			if !ok {
+				return token{}, err
+			}
+			return token{
+				Type: tInt,
+				Big:  bval,
+			}, nil
+		}
+		return token{
+			Type: tInt,
+			Int:  ival,
+		}, nil
+	}
+	return token{}, l.SyntaxError("")
+}
 
-	default:
-		if unicode.IsLetter(r) {
-			str := []rune{r}
-			for {
-				r, _, err = l.ReadRune()
-				if err != nil {
-					if err != io.EOF {
-						return nil, err
-					}
-					break
-				}
-				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
-					l.UnreadRune()
-					break
+// identifier lexes an identifier. It returns an empty string if the
+// input does not continue with an identifier.
+func (l *lexer) identifier() string {
+	if l.pos >= len(l.input) {
+		return ""
+	}
+	r, size := l.peekRune()
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+	start := l.pos
+	l.pos += size
+	for l.pos < len(l.input) {
+		r, size = l.peekRune()
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		l.pos += size
+	}
+	return l.input[start:l.pos]
+}
+
+// quoted lexes a quoted string. The string is sliced from the input
+// unless it contains escape sequences.
+func (l *lexer) quoted() (token, error) {
+	start := l.pos + 1
+	var escaped bool
+	for i := start; i < len(l.input); i++ {
+		switch l.input[i] {
+		case '\\':
+			escaped = true
+			i++
+
+		case '"':
+			l.pos = i + 1
+			val := l.input[start:i]
+			if escaped {
+				var ok bool
+				val, ok = unescape(val)
+				if !ok {
+					return token{}, l.SyntaxError("valid escape sequence")
 				}
-				str = append(str, r)
 			}
-			return &token{
+			return token{
 				Type:   tString,
-				StrVal: string(str),
+				StrVal: val,
+				Quoted: true,
 			}, nil
 		}
-		if unicode.IsDigit(r) {
-			number := []rune{r}
-			for {
-				r, _, err = l.ReadRune()
-				if err != nil {
-					if err != io.EOF {
-						return nil, err
-					}
-					break
-				}
-				if !unicode.IsDigit(r) {
-					l.UnreadRune()
-					break
-				}
-				number = append(number, r)
+	}
+	l.pos = len(l.input)
+	return token{}, l.SyntaxError("closing '\"'")
+}
+
+// literal lexes an SQL string literal. The literal is enclosed in
+// single quotes and the quotes inside the literal are doubled.
+func (l *lexer) literal() (token, error) {
+	var sb strings.Builder
+	for i := l.pos + 1; i < len(l.input); i++ {
+		if l.input[i] != '\'' {
+			sb.WriteByte(l.input[i])
+			continue
+		}
+		if i+1 < len(l.input) && l.input[i+1] == '\'' {
+			sb.WriteByte('\'')
+			i++
+			continue
+		}
+		l.pos = i + 1
+		return token{
+			Type:   tLiteral,
+			StrVal: sb.String(),
+		}, nil
+	}
+	l.pos = len(l.input)
+	return token{}, l.SyntaxError("closing \"'\"")
+}
+
+// unescape decodes the JSON escape sequences of the string s.
+func unescape(s string) (string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch != '\\' {
+			sb.WriteByte(ch)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", false
+		}
+		switch s[i] {
+		case '"', '\\', '/':
+			sb.WriteByte(s[i])
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'u':
+			if i+5 > len(s) {
+				return "", false
 			}
-			ival, err := strconv.Atoi(string(number))
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
 			if err != nil {
-				return nil, err
+				return "", false
 			}
-			return &token{
-				Type: tInt,
-				Int:  ival,
-			}, nil
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			return "", false
 		}
+	}
+	return sb.String(), true
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
 
-		l.UnreadRune()
-		return nil, l.SyntaxError()
+func (l *lexer) peekRune() (rune, int) {
+	ch := l.input[l.pos]
+	if ch < utf8.RuneSelf {
+		return rune(ch), 1
 	}
+	return utf8.DecodeRuneInString(l.input[l.pos:])
 }
 
-func (l *lexer) Unget(t *token) {
-	l.unget = t
+// single returns a single character token.
+func (l *lexer) single(tt tokenType) (token, error) {
+	l.pos++
+	return token{
+		Type: tt,
+	}, nil
 }
 
-func (l *lexer) ReadRune() (rune, int, error) {
-	r, s, err := l.in.ReadRune()
-	l.lastSize = s
-	l.pos += s
-	return r, s, err
+// next tests if the character after the current character is ch. If
+// it is, the function consumes both characters.
+func (l *lexer) next(ch byte) bool {
+	if l.pos+1 < len(l.input) && l.input[l.pos+1] == ch {
+		l.pos += 2
+		return true
+	}
+	return false
 }
 
-func (l *lexer) UnreadRune() error {
-	err := l.in.UnreadRune()
-	if err != nil {
-		return err
+// Nest enters a nested expression. It returns an error if the nesting
+// exceeds the maximum query depth.
+func (l *lexer) Nest() error {
+	l.nesting++
+	if l.maxNest > 0 && l.nesting > l.maxNest {
+		return fmt.Errorf("jsonq: query nested too deep, maximum is %d",
+			l.maxNest)
 	}
-	l.pos -= l.lastSize
 	return nil
 }
 
-func (l *lexer) SyntaxError() error {
-	if l.pos == 0 {
-		return fmt.Errorf("syntax error at the beginning of query '%s'",
-			l.input)
+// Defined tests if the variable name is bound by an enclosing let
+// binding.
+func (l *lexer) Defined(name string) bool {
+	for _, v := range l.vars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Unnest leaves a nested expression.
+func (l *lexer) Unnest() {
+	l.nesting--
+}
+
+func (l *lexer) Unget(t token) {
+	l.unget = t
+	l.hasUnget = true
+}
+
+// Expect gets the next token. If the input is at its end, Expect
+// returns a syntax error with the expected hint.
+func (l *lexer) Expect(expected string) (token, error) {
+	t, err := l.Get()
+	if err == io.EOF {
+		return t, l.SyntaxError(expected)
+	}
+	return t, err
+}
+
+// SyntaxError returns a syntax error for the most recent token. The
+// expected argument describes the expected input. It can be empty if
+// the expected input is not known.
+func (l *lexer) SyntaxError(expected string) error {
+	tok := l.input[l.start:l.pos]
+	if len(tok) == 0 && l.start < len(l.input) {
+		_, size := utf8.DecodeRuneInString(l.input[l.start:])
+		tok = l.input[l.start : l.start+size]
+	}
+	return &SyntaxError{
+		Query:    l.input,
+		Offset:   l.start,
+		Token:    tok,
+		Expected: expected,
+	}
+}
+
+// SyntaxError describes a query syntax error.
+type SyntaxError struct {
+	// Query is the query string.
+	Query string
+	// Offset is the byte offset of the offending token in the query.
+	Offset int
+	// Token is the offending token. It is empty if the query ended
+	// unexpectedly.
+	Token string
+	// Expected describes the expected input. It is empty if the
+	// expected input is not known.
+	Expected string
+}
+
+func (e *SyntaxError) Error() string {
+	var msg string
+	if len(e.Token) == 0 {
+		msg = fmt.Sprintf("jsonq: syntax error in '%s' at offset %d: unexpected end of query",
+			e.Query, e.Offset)
+	} else {
+		msg = fmt.Sprintf("jsonq: syntax error in '%s' at offset %d: unexpected '%s'",
+			e.Query, e.Offset, e.Token)
+	}
+	if len(e.Expected) > 0 {
+		msg += ", expected " + e.Expected
 	}
-	return fmt.Errorf("syntax error: '%s', looking at '%s'",
-		string([]byte(l.input)[:l.pos]),
-		string([]byte(l.input)[l.pos:]))
+	return msg
 }
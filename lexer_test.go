@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"io"
+	"testing"
+)
+
+const benchQuery = `issue.changelog.items[fieldId=="assignee" && priority>=10][0].toString`
+
+func TestLexer(t *testing.T) {
+	lexer := newLexer(`a.b_1 [ "x y"!=12|| c<=d ]?()|&&`)
+	expected := []token{
+		{Type: tString, StrVal: "a"},
+		{Type: tDot},
+		{Type: tString, StrVal: "b_1"},
+		{Type: tLBracket},
+		{Type: tString, StrVal: "x y", Quoted: true},
+		{Type: tNeq},
+		{Type: tInt, Int: 12},
+		{Type: tOr},
+		{Type: tString, StrVal: "c"},
+		{Type: tLe},
+		{Type: tString, StrVal: "d"},
+		{Type: tRBracket},
+		{Type: tQuestionMark},
+		{Type: tLParen},
+		{Type: tRParen},
+		{Type: tPipe},
+		{Type: tAnd},
+	}
+	for _, e := range expected {
+		tok, err := lexer.Get()
+		if err != nil {
+			t.Fatalf("Get failed: %s", err)
+		}
+		if tok != e {
+			t.Errorf("Get: got %v, expected %v", tok, e)
+		}
+	}
+	_, err := lexer.Get()
+	if err != io.EOF {
+		t.Errorf("Get: expected EOF, got %v", err)
+	}
+
+	lexer = newLexer(`"a\"b\\c\n\u00e4\/"`)
+	tok, err := lexer.Get()
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if tok.StrVal != "a\"b\\c\nä/" {
+		t.Errorf("Get: got %q", tok.StrVal)
+	}
+
+	for _, input := range []string{"$", "$1", "a!b", "&|", "#", `"\x"`, `"\u12"`,
+		`"\"`} {
+		lexer = newLexer(input)
+		var err error
+		for err == nil {
+			_, err = lexer.Get()
+		}
+		if err == io.EOF {
+			t.Errorf("lexer accepted invalid input %q", input)
+		}
+	}
+}
+
+func TestLexerAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		lexer := lexer{
+			input: benchQuery,
+		}
+		for {
+			_, err := lexer.Get()
+			if err != nil {
+				break
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("lexer allocated %v times per query", allocs)
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lexer := lexer{
+			input: benchQuery,
+		}
+		for {
+			_, err := lexer.Get()
+			if err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := parse(benchQuery)
+		if err != nil {
+			b.Fatalf("parse failed: %s", err)
+		}
+	}
+}
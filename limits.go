@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// DefaultMaxQueryLength specifies the default maximum length of query
+// strings in bytes.
+const DefaultMaxQueryLength = 64 * 1024
+
+// DefaultMaxQueryDepth specifies the default maximum depth of
+// queries. The depth is the number of path segments plus the nesting
+// depth of the deepest filter expression.
+const DefaultMaxQueryDepth = 1024
+
+// DefaultMaxQueryTokens specifies the default maximum number of
+// tokens in queries.
+const DefaultMaxQueryTokens = 8 * 1024
+
+// DefaultMaxQueryComplexity specifies the default maximum complexity
+// of queries. The complexity is the product of the number of path
+// segments, the number of filters plus one, and the number of
+// function calls plus one.
+const DefaultMaxQueryComplexity = 1 << 20
+
+var (
+	maxQueryLength     int32 = DefaultMaxQueryLength
+	maxQueryDepth      int32 = DefaultMaxQueryDepth
+	maxQueryTokens     int32 = DefaultMaxQueryTokens
+	maxQueryComplexity int32 = DefaultMaxQueryComplexity
+)
+
+// SetMaxQueryLength sets the maximum length of query strings that
+// Compile and CompileJQ accept. The length 0 removes the limit. The
+// limit protects services that compile user-supplied queries.
+func SetMaxQueryLength(length int) {
+	atomic.StoreInt32(&maxQueryLength, int32(length))
+}
+
+// SetMaxQueryDepth sets the maximum depth of queries that Compile and
+// CompileJQ accept. The depth 0 removes the limit. Note that the
+// queries in the query cache are not re-checked against the new
+// limit.
+func SetMaxQueryDepth(depth int) {
+	atomic.StoreInt32(&maxQueryDepth, int32(depth))
+}
+
+// SetMaxQueryTokens sets the maximum number of tokens in queries that
+// Compile and CompileJQ accept. The count 0 removes the limit.
+func SetMaxQueryTokens(count int) {
+	atomic.StoreInt32(&maxQueryTokens, int32(count))
+}
+
+// SetMaxQueryComplexity sets the maximum complexity of queries that
+// Compile accepts. The queries exceeding the complexity fail with an
+// error matching ErrQueryTooComplex with errors.Is. The complexity 0
+// removes the limit. Like with SetMaxQueryDepth, the queries in the
+// query cache are not re-checked against the new limit.
+func SetMaxQueryComplexity(complexity int) {
+	atomic.StoreInt32(&maxQueryComplexity, int32(complexity))
+}
+
+// checkLength checks the query string q against the maximum query
+// length.
+func checkLength(q string) error {
+	max := int(atomic.LoadInt32(&maxQueryLength))
+	if max > 0 && len(q) > max {
+		return fmt.Errorf("jsonq: query too long: %d bytes, maximum is %d",
+			len(q), max)
+	}
+	return nil
+}
+
+// checkDepth checks the query against the maximum query depth.
+func (q *query) checkDepth() error {
+	return checkDepth(q.depth())
+}
+
+// checkDepth checks the query depth against the maximum query depth.
+func checkDepth(depth int) error {
+	max := int(atomic.LoadInt32(&maxQueryDepth))
+	if max <= 0 {
+		return nil
+	}
+	if depth > max {
+		return fmt.Errorf("jsonq: query too deep: depth %d, maximum is %d",
+			depth, max)
+	}
+	return nil
+}
+
+// checkComplexity checks the query complexity against the maximum
+// query complexity.
+func checkComplexity(complexity int) error {
+	max := int(atomic.LoadInt32(&maxQueryComplexity))
+	if max <= 0 || complexity <= max {
+		return nil
+	}
+	return &complexityError{
+		complexity: complexity,
+		max:        max,
+	}
+}
+
+// depth computes the query depth.
+func (q *query) depth() int {
+	var depth, filterDepth int
+	for s := q; s != nil; s = s.left {
+		depth++
+		for _, f := range s.filters {
+			d := exprDepth(f)
+			if d > filterDepth {
+				filterDepth = d
+			}
+		}
+	}
+	return depth + filterDepth
+}
+
+// exprDepth computes the nesting depth of the filter expression
+// without recursion.
+func exprDepth(f filter) int {
+	type item struct {
+		f     filter
+		depth int
+	}
+	var max int
+	stack := []item{{f, 1}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if it.depth > max {
+			max = it.depth
+		}
+		if l, ok := it.f.(*logical); ok {
+			stack = append(stack,
+				item{l.Left, it.depth + 1},
+				item{l.Right, it.depth + 1})
+		}
+	}
+	return max
+}
+
+// checkResults checks the number of selected values n against the
+// maximum number of results.
+func (e *env) checkResults(n int) error {
+	return e.options().checkResults(n)
+}
+
+// checkResults checks the number of selected values n against the
+// maximum number of results.
+func (o *options) checkResults(n int) error {
+	if o == nil || o.maxResults <= 0 || n <= o.maxResults {
+		return nil
+	}
+	return &LimitError{
+		Limit: "results",
+		Max:   o.maxResults,
+	}
+}
+
+// checkDocument checks the document v against the maximum document
+// depth. The document is walked without recursion and the walk stops
+// at the first value exceeding the limit.
+func (o *options) checkDocument(v interface{}) error {
+	if o == nil || o.maxDoc <= 0 {
+		return nil
+	}
+	type item struct {
+		v     interface{}
+		depth int
+	}
+	stack := []item{{v, 0}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		var children []interface{}
+		switch val := it.v.(type) {
+		case nil, bool, string, float64, json.Number:
+			continue
+
+		case map[string]interface{}:
+			for _, child := range val {
+				children = append(children, child)
+			}
+
+		case []interface{}:
+			children = val
+
+		default:
+			arr, ok := arrayValue(val)
+			if ok {
+				children = arr
+			} else {
+				keys := objectKeys(val)
+				if keys == nil {
+					if _, _, ok := lookup(val, ""); !ok {
+						continue
+					}
+				}
+				for _, key := range keys {
+					child, _, _ := lookup(val, key)
+					children = append(children, child)
+				}
+			}
+		}
+		depth := it.depth + 1
+		if depth > o.maxDoc {
+			return &LimitError{
+				Limit: "document depth",
+				Max:   o.maxDoc,
+			}
+		}
+		for _, child := range children {
+			stack = append(stack, item{child, depth})
+		}
+	}
+	return nil
+}
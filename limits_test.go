@@ -0,0 +1,266 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryLimits(t *testing.T) {
+	defer SetMaxQueryLength(DefaultMaxQueryLength)
+	defer SetMaxQueryDepth(DefaultMaxQueryDepth)
+	defer SetMaxQueryTokens(DefaultMaxQueryTokens)
+
+	const depth = 100000
+
+	var v interface{} = "leaf"
+	for i := 0; i < depth; i++ {
+		v = map[string]interface{}{
+			"a": v,
+		}
+	}
+	q := strings.Repeat("a.", depth-1) + "a"
+
+	_, err := Compile(q)
+	if err == nil {
+		t.Errorf("Compile accepted too long query")
+	}
+	SetMaxQueryLength(0)
+	_, err = Compile(q)
+	if err == nil {
+		t.Errorf("Compile accepted too deep query")
+	}
+	_, err = CompileJQ("." + q)
+	if err == nil {
+		t.Errorf("CompileJQ accepted too deep query")
+	}
+	_, err = Compile("a[b==1" + strings.Repeat(" || b==1", depth) + "]")
+	if err == nil {
+		t.Errorf("Compile accepted too deep filter")
+	}
+
+	_, err = Compile("a[" + strings.Repeat("(", 2000) + "b==1" +
+		strings.Repeat(")", 2000) + "]")
+	if err == nil {
+		t.Errorf("Compile accepted too deep nesting")
+	}
+
+	SetMaxQueryDepth(0)
+	_, err = Compile(q)
+	if err == nil {
+		t.Errorf("Compile accepted too many tokens")
+	}
+	SetMaxQueryTokens(0)
+	query, err := Compile(q)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	str, err := query.GetString(v)
+	if err != nil {
+		t.Fatalf("GetString failed: %s", err)
+	}
+	if str != "leaf" {
+		t.Errorf("GetString: got %s, expected leaf", str)
+	}
+	it := query.Iter(v)
+	leaf, ok := it.Next()
+	if !ok || leaf != "leaf" {
+		t.Errorf("Iter: got %v, expected leaf", leaf)
+	}
+}
+
+func TestEvalLimits(t *testing.T) {
+	v := unmarshal(t, `{
+    "items": [
+        {"id": 1, "tags": ["a", "b"]},
+        {"id": 2, "tags": ["c"]},
+        {"id": 3, "tags": []}
+    ]
+}`)
+	var limitErr *LimitError
+
+	n, err := Ctx(v, WithMaxResults(3)).Select("items[]").Count()
+	if err != nil || n != 3 {
+		t.Errorf("Select failed: %v, count %d", err, n)
+	}
+	_, err = Ctx(v, WithMaxResults(2)).Select("items[]").Get()
+	if !errors.As(err, &limitErr) || limitErr.Limit != "results" {
+		t.Errorf("Select accepted too many results: %v", err)
+	}
+	_, err = Get(v, "items[].tags[]", WithMaxResults(2))
+	if !errors.As(err, &limitErr) {
+		t.Errorf("Get accepted too many results: %v", err)
+	}
+	_, err = Get(v, "items[id >= 2]", WithMaxResults(2))
+	if err != nil {
+		t.Errorf("Get failed: %s", err)
+	}
+	_, err = Get(v, "items", WithMaxResults(2))
+	if err != nil {
+		t.Errorf("Get limited non-selecting query: %s", err)
+	}
+	q, err := Compile("items[].id", WithMaxResults(1))
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	_, err = q.Eval(v)
+	if !errors.As(err, &limitErr) {
+		t.Errorf("Eval accepted too many results: %v", err)
+	}
+
+	_, err = Ctx(v, WithMaxDocumentDepth(4)).Select("items[]").Get()
+	if err != nil {
+		t.Errorf("Select failed: %s", err)
+	}
+	_, err = Ctx(v, WithMaxDocumentDepth(3)).Select("items[]").Get()
+	if !errors.As(err, &limitErr) || limitErr.Limit != "document depth" {
+		t.Errorf("Ctx accepted too deep document: %v", err)
+	}
+	_, err = Ctx(`[[[1]]]`, WithMaxDocumentDepth(2)).Get()
+	if !errors.As(err, &limitErr) {
+		t.Errorf("Ctx accepted too deep JSON data: %v", err)
+	}
+	_, err = FromBytes([]byte(`[[[1]]]`), WithMaxDocumentDepth(2))
+	if !errors.As(err, &limitErr) {
+		t.Errorf("FromBytes accepted too deep JSON data: %v", err)
+	}
+	ctx, err := FromReader(strings.NewReader(`[[[1]]]`),
+		WithMaxDocumentDepth(3))
+	if err != nil {
+		t.Fatalf("FromReader failed: %s", err)
+	}
+	_, err = ctx.Get()
+	if err != nil {
+		t.Errorf("Get failed: %s", err)
+	}
+	_, err = FromReader(strings.NewReader(`[[[1]]]`),
+		WithMaxDocumentDepth(2))
+	if !errors.As(err, &limitErr) {
+		t.Errorf("FromReader accepted too deep JSON data: %v", err)
+	}
+
+	// The Get functions and compiled queries do not walk the document.
+	_, err = Get(v, "items[0].tags[0]", WithMaxDocumentDepth(1))
+	if err != nil {
+		t.Errorf("Get failed: %v", err)
+	}
+	q, err = Compile("items", WithMaxDocumentDepth(2))
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	_, err = q.Eval(map[string]interface{}{
+		"items": []int{1, 2},
+	})
+	if err != nil {
+		t.Errorf("Eval failed: %s", err)
+	}
+}
+
+func TestContextResultLimits(t *testing.T) {
+	v := unmarshal(t, `{
+    "items": [
+        {"id": 1, "tags": ["a", "b"]},
+        {"id": 2, "tags": ["c"]},
+        {"id": 3, "tags": []}
+    ],
+    "pairs": [{"k": 1}, {"k": 1}]
+}`)
+	var limitErr *LimitError
+	ctx := Ctx(v, WithMaxResults(2))
+	items := ctx.Select("items[id <= 2]")
+
+	tests := []struct {
+		name string
+		ctx  *Context
+	}{
+		{"SelectAny", ctx.SelectAny("items[0].tags[]", "items[1].tags[]")},
+		{"SelectOr", items.SelectOr("missing[]", "tags[]")},
+		{"Join", ctx.Select("pairs[]").Join(Ctx(v).Select("pairs[]"),
+			"k", "k")},
+		{"Union", items.Union(Ctx(v).Select("items[id >= 2]"), "id")},
+	}
+	for _, test := range tests {
+		_, err := test.ctx.Get()
+		if !errors.As(err, &limitErr) || limitErr.Limit != "results" {
+			t.Errorf("%s accepted too many results: %v", test.name, err)
+		}
+	}
+	n, err := items.SelectGrouped("tags[]").Count()
+	if err != nil || n != 2 {
+		t.Errorf("SelectGrouped failed: %v, count %d", err, n)
+	}
+}
+
+func TestQueryComplexity(t *testing.T) {
+	defer SetMaxQueryComplexity(DefaultMaxQueryComplexity)
+
+	// 4 segments, including the call argument, 2 filters, and 1 call:
+	// 4 * 3 * 2.
+	q := `items[].tags[tostring(id) == "1"].name`
+	SetMaxQueryComplexity(24)
+	_, err := Compile(q)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	SetMaxQueryComplexity(23)
+	_, err = Compile(q)
+	if !errors.Is(err, ErrQueryTooComplex) {
+		t.Errorf("Compile accepted too complex query: %v", err)
+	}
+	err = Validate(q)
+	if !errors.Is(err, ErrQueryTooComplex) {
+		t.Errorf("Validate accepted too complex query: %v", err)
+	}
+	SetMaxQueryComplexity(0)
+	_, err = Compile(q)
+	if err != nil {
+		t.Errorf("Compile failed without limit: %s", err)
+	}
+}
+
+func TestEvalTimeout(t *testing.T) {
+	items := make([]interface{}, 10000)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"name": fmt.Sprintf("item-%d", i),
+		}
+	}
+	v := map[string]interface{}{
+		"items": items,
+	}
+	q := `items[match(name, "^item-9+$")]`
+
+	_, err := Ctx(v, WithTimeout(time.Nanosecond)).Select(q).Get()
+	if err != ErrEvalTimeout {
+		t.Errorf("Select did not time out: %v", err)
+	}
+	_, err = Get(v, q, WithTimeout(time.Nanosecond))
+	if err != ErrEvalTimeout {
+		t.Errorf("Get did not time out: %v", err)
+	}
+	query, err := Compile(q, WithTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	_, err = query.EvalContext(context.Background(), v)
+	if err != ErrEvalTimeout {
+		t.Errorf("EvalContext did not time out: %v", err)
+	}
+
+	n, err := Ctx(v, WithTimeout(time.Minute)).Select(q).Count()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	if n != 4 {
+		t.Errorf("unexpected number of matches: %d", n)
+	}
+}
@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MergePatch applies the JSON merge patch to the value v according to
+// RFC 7386. The patch object's members replace the corresponding
+// members of v and the null members remove them. The function does
+// not modify its arguments but the result can share values with
+// them.
+func MergePatch(v interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target, ok := v.(map[string]interface{})
+	if !ok {
+		target = nil
+	}
+	result := make(map[string]interface{}, len(target))
+	for key, val := range target {
+		result[key] = val
+	}
+	for key, val := range p {
+		if val == nil {
+			delete(result, key)
+		} else {
+			result[key] = MergePatch(result[key], val)
+		}
+	}
+	return result
+}
+
+// Merge deeply merges the value b into the value a. The objects are
+// merged recursively and for all other values, including arrays and
+// nulls, the value from b replaces the value from a. The function does
+// not modify its arguments but the result can share values with
+// them.
+func Merge(a, b interface{}) interface{} {
+	bm, ok := b.(map[string]interface{})
+	if !ok {
+		return b
+	}
+	am, ok := a.(map[string]interface{})
+	if !ok {
+		return b
+	}
+	result := make(map[string]interface{}, len(am))
+	for key, val := range am {
+		result[key] = val
+	}
+	for key, val := range bm {
+		old, ok := result[key]
+		if ok {
+			result[key] = Merge(old, val)
+		} else {
+			result[key] = val
+		}
+	}
+	return result
+}
+
+// Load reads a JSON document from each reader and merges the
+// documents in order with Merge so that the later documents override
+// the earlier ones. It returns a context holding the merged document.
+// This implements layered configurations, such as defaults followed
+// by environment-specific overrides.
+func Load(readers ...io.Reader) (*Context, error) {
+	var result interface{}
+	for idx, r := range readers {
+		var doc interface{}
+		err := json.NewDecoder(r).Decode(&doc)
+		if err != nil {
+			return nil, fmt.Errorf("jsonq: document %d: %s", idx, err)
+		}
+		result = Merge(result, doc)
+	}
+	return Ctx(result), nil
+}
+
+// LoadFiles reads the JSON files and merges them like Load.
+func LoadFiles(files ...string) (*Context, error) {
+	var result interface{}
+	for _, file := range files {
+		doc, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		result = Merge(result, doc)
+	}
+	return Ctx(result), nil
+}
+
+func loadFile(file string) (interface{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc interface{}
+	err = json.NewDecoder(f).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("jsonq: %s: %s", file, err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func unmarshal(t *testing.T, data string) interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(data), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	return v
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+	return string(data)
+}
+
+// Test cases from RFC 7386 Appendix A.
+var mergePatchTests = []struct {
+	target string
+	patch  string
+	result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, test := range mergePatchTests {
+		target := unmarshal(t, test.target)
+		result := marshal(t, MergePatch(target, unmarshal(t, test.patch)))
+		if result != test.result {
+			t.Errorf("MergePatch(%s, %s): got %s, expected %s",
+				test.target, test.patch, result, test.result)
+		}
+		if marshal(t, target) != test.target {
+			t.Errorf("MergePatch modified target %s", test.target)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defaults := unmarshal(t, `{"server":{"host":"localhost","port":80},"debug":true}`)
+	overrides := unmarshal(t, `{"server":{"port":8080,"tls":null},"debug":false}`)
+
+	result := marshal(t, Merge(defaults, overrides))
+	expected := `{"debug":false,"server":{"host":"localhost","port":8080,"tls":null}}`
+	if result != expected {
+		t.Errorf("Merge: got %s, expected %s", result, expected)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx, err := Load(
+		strings.NewReader(`{"server":{"host":"localhost","port":80},"debug":true}`),
+		strings.NewReader(`{"server":{"port":8080}}`),
+		strings.NewReader(`{"debug":false}`))
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	result, err := ctx.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	expected := `{"debug":false,"server":{"host":"localhost","port":8080}}`
+	if string(result) != expected {
+		t.Errorf("Load: got %s, expected %s", result, expected)
+	}
+
+	_, err = Load(strings.NewReader(`{}`), strings.NewReader(`{`))
+	if err == nil {
+		t.Errorf("Load accepted invalid document")
+	}
+
+	dir, err := ioutil.TempDir("", "jsonq")
+	if err != nil {
+		t.Fatalf("TempDir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaults := filepath.Join(dir, "defaults.json")
+	production := filepath.Join(dir, "production.json")
+	err = ioutil.WriteFile(defaults, []byte(`{"server":{"port":80}}`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	err = ioutil.WriteFile(production, []byte(`{"server":{"port":443}}`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	ctx, err = LoadFiles(defaults, production)
+	if err != nil {
+		t.Fatalf("LoadFiles failed: %s", err)
+	}
+	ports, err := ctx.Select("server.port").Ints()
+	if err != nil {
+		t.Fatalf("Ints failed: %s", err)
+	}
+	if len(ports) != 1 || ports[0] != 443 {
+		t.Errorf("LoadFiles: got ports %v, expected [443]", ports)
+	}
+
+	_, err = LoadFiles(defaults, filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Errorf("LoadFiles accepted missing file")
+	}
+}
@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives instrumentation callbacks from the query
+// compilation and evaluation. The callbacks are called synchronously
+// from the compiling and evaluating goroutines so they must be safe
+// for concurrent use and fast.
+type Metrics interface {
+	// QueryParsed is called when a query string is parsed.
+	QueryParsed()
+	// CacheHit is called when a query is found from a query cache.
+	CacheHit()
+	// CacheMiss is called when a query is not found from a query
+	// cache and it must be parsed.
+	CacheMiss()
+	// EvalDuration is called with the duration of each query
+	// evaluation.
+	EvalDuration(d time.Duration)
+	// ElementsFiltered is called after each query evaluation with
+	// the number of elements the query filters evaluated.
+	ElementsFiltered(n int)
+}
+
+type metricsHolder struct {
+	m Metrics
+}
+
+var metrics atomic.Value
+
+// SetMetrics sets the metrics receiving the instrumentation
+// callbacks. The nil metrics disables the instrumentation. The
+// query evaluations are instrumented with Eval and the functions
+// built on it, but not with the lazy Iter.
+func SetMetrics(m Metrics) {
+	metrics.Store(metricsHolder{m})
+}
+
+// currentMetrics returns the current metrics or nil if the metrics
+// are not set.
+func currentMetrics() Metrics {
+	h, ok := metrics.Load().(metricsHolder)
+	if !ok {
+		return nil
+	}
+	return h.m
+}
+
+// measured tests if the evaluation is already measured. The
+// evaluations of the filter operands are measured as part of the
+// enclosing query evaluation.
+func (e *env) measured() bool {
+	return e != nil && e.metrics
+}
+
+// measure evaluates the query and reports the evaluation metrics.
+func (q *Query) measure(m Metrics, e *env, value interface{}) (
+	interface{}, error) {
+
+	me := new(env)
+	if e != nil {
+		*me = *e
+	}
+	me.metrics = true
+	me.filtered = 0
+
+	start := time.Now()
+	v, err := q.evalValue(me, value)
+	m.EvalDuration(time.Since(start))
+	m.ElementsFiltered(me.filtered)
+
+	return v, err
+}
@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+	"time"
+)
+
+type countingMetrics struct {
+	parsed   int
+	hits     int
+	misses   int
+	evals    int
+	filtered int
+}
+
+func (m *countingMetrics) QueryParsed() {
+	m.parsed++
+}
+
+func (m *countingMetrics) CacheHit() {
+	m.hits++
+}
+
+func (m *countingMetrics) CacheMiss() {
+	m.misses++
+}
+
+func (m *countingMetrics) EvalDuration(d time.Duration) {
+	m.evals++
+}
+
+func (m *countingMetrics) ElementsFiltered(n int) {
+	m.filtered += n
+}
+
+func TestMetrics(t *testing.T) {
+	v := parseAssign(t)
+
+	m := new(countingMetrics)
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	q := `issue.changelog.items[fieldId=="assignee" && priority<100].toString`
+	cache := WithQueryCache(8)
+	for i := 0; i < 2; i++ {
+		_, err := Get(v, q, cache)
+		if err != nil {
+			t.Fatalf("Get failed: %s", err)
+		}
+	}
+	expected := countingMetrics{
+		parsed:   3,
+		hits:     9,
+		misses:   3,
+		evals:    2,
+		filtered: 6,
+	}
+	if *m != expected {
+		t.Errorf("got metrics %+v, expected %+v", *m, expected)
+	}
+
+	SetMetrics(nil)
+	_, err := Get(v, "issue.key")
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if m.evals != 2 {
+		t.Errorf("metrics not disabled")
+	}
+}
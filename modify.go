@@ -0,0 +1,682 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Set sets the value pointed by the query q to newVal. If the query
+// ends with filters, the value is set to all array elements matching
+// the filters. If the last key of the query does not exist, it is
+// added to its parent object. If the filters do not match any
+// elements, Set returns an error matching ErrNotFound. The value can
+// be modified only inside JSON objects and arrays.
+func Set(value interface{}, q string, newVal interface{}) error {
+	query, err := cachedCompile(q)
+	if err != nil {
+		return err
+	}
+	return query.Set(value, newVal)
+}
+
+// Set sets the value pointed by the query to newVal. See the Set
+// function for details.
+func (q *Query) Set(value interface{}, newVal interface{}) error {
+	path, err := q.pathQuery()
+	if err != nil {
+		return err
+	}
+	locations, err := path.locate(value, true)
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return &noMatch{query: q.src}
+	}
+	for _, loc := range locations {
+		loc.Set(newVal)
+	}
+	return nil
+}
+
+// SetCreate sets the value pointed by the query q to newVal like Set
+// but it also creates all missing intermediate objects and arrays
+// along the path. The index filters, for example, items[2], create
+// missing arrays and extend short arrays with null values so that the
+// indexed elements can be set. The values are not created after path
+// segments with other filters.
+func SetCreate(value interface{}, q string, newVal interface{}) error {
+	query, err := cachedCompile(q)
+	if err != nil {
+		return err
+	}
+	return query.SetCreate(value, newVal)
+}
+
+// SetCreate sets the value pointed by the query to newVal, creating
+// missing intermediate values. See the SetCreate function for
+// details.
+func (q *Query) SetCreate(value interface{}, newVal interface{}) error {
+	path, err := q.pathQuery()
+	if err != nil {
+		return err
+	}
+	if !path.left.creatable() {
+		return q.Set(value, newVal)
+	}
+	parent, err := path.createParent(value)
+	if err != nil {
+		return err
+	}
+	if len(path.filters) == 0 {
+		parent[path.key] = newVal
+		modified()
+		return nil
+	}
+	index, ok := path.indexFilter()
+	if !ok || index < 0 {
+		return q.Set(value, newVal)
+	}
+	arr, err := path.createArray(parent, index)
+	if err != nil {
+		return err
+	}
+	arr[index] = newVal
+	modified()
+
+	return nil
+}
+
+// Set sets the value pointed by the query q to newVal in all elements
+// of the current selection.
+func (ctx *Context) Set(q string, newVal interface{}) error {
+	if ctx.err != nil {
+		return ctx.err
+	}
+	query, err := ctx.opts.compile(q)
+	if err != nil {
+		return err
+	}
+	for _, sel := range ctx.selection {
+		err = query.Set(sel, newVal)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update applies the function f to all values pointed by the query q
+// and replaces the values with the function results. Updating a
+// missing optional element is not an error.
+func Update(value interface{}, q string,
+	f func(old interface{}) (interface{}, error)) error {
+
+	query, err := cachedCompile(q)
+	if err != nil {
+		return err
+	}
+	return query.Update(value, f)
+}
+
+// Update applies the function f to all values pointed by the
+// query. See the Update function for details.
+func (q *Query) Update(value interface{},
+	f func(old interface{}) (interface{}, error)) error {
+
+	path, err := q.pathQuery()
+	if err != nil {
+		return err
+	}
+	locations, err := path.locate(value, false)
+	if err != nil {
+		if err == ErrorOptionalMissing {
+			return nil
+		}
+		return err
+	}
+	for _, loc := range locations {
+		v, err := f(loc.Get())
+		if err != nil {
+			return err
+		}
+		loc.Set(v)
+	}
+	return nil
+}
+
+// Update applies the function f to all values pointed by the query q
+// in all elements of the current selection.
+func (ctx *Context) Update(q string,
+	f func(old interface{}) (interface{}, error)) error {
+
+	if ctx.err != nil {
+		return ctx.err
+	}
+	query, err := ctx.opts.compile(q)
+	if err != nil {
+		return err
+	}
+	for _, sel := range ctx.selection {
+		err = query.Update(sel, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAll sets the value pointed by the query subPath to val in all
+// elements of the current selection, like Set, but returns the
+// context for chaining. The selection is not changed and any error is
+// stored in the returned context.
+func (ctx *Context) SetAll(subPath string, val interface{}) *Context {
+	err := ctx.Set(subPath, val)
+	if err != nil {
+		return ctx.fail(err)
+	}
+	return ctx
+}
+
+// Delete removes the values pointed by the query q. If the query ends
+// with filters, the matching array elements are removed from the
+// array. Deleting a missing optional element is not an error.
+func Delete(value interface{}, q string) error {
+	query, err := cachedCompile(q)
+	if err != nil {
+		return err
+	}
+	return query.Delete(value)
+}
+
+// Delete removes the values pointed by the query. See the Delete
+// function for details.
+func (q *Query) Delete(value interface{}) error {
+	path, err := q.pathQuery()
+	if err != nil {
+		return err
+	}
+	locations, err := path.locate(value, false)
+	if err != nil {
+		if err == ErrorOptionalMissing {
+			return nil
+		}
+		return err
+	}
+	deleteLocations(locations)
+	return nil
+}
+
+// Delete removes the values pointed by the query q from all elements
+// of the current selection.
+func (ctx *Context) Delete(q string) error {
+	if ctx.err != nil {
+		return ctx.err
+	}
+	query, err := ctx.opts.compile(q)
+	if err != nil {
+		return err
+	}
+	for _, sel := range ctx.selection {
+		err = query.Delete(sel)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertBefore inserts the item into an array before the first
+// element matched by the query q. The query must end with filters
+// selecting elements of an array, for example,
+// items[fieldId=="assignee"].
+func InsertBefore(value interface{}, q string, item interface{}) error {
+	return insert(value, q, item, 0)
+}
+
+// InsertAfter inserts the item into an array after the first element
+// matched by the query q. See InsertBefore for details about the
+// query.
+func InsertAfter(value interface{}, q string, item interface{}) error {
+	return insert(value, q, item, 1)
+}
+
+func insert(value interface{}, q string, item interface{}, offset int) error {
+	query, err := cachedCompile(q)
+	if err != nil {
+		return err
+	}
+	path, err := query.pathQuery()
+	if err != nil {
+		return err
+	}
+	if len(path.filters) == 0 {
+		return fmt.Errorf("jsonq: query '%s' does not select array elements",
+			query)
+	}
+	locations, err := path.locate(value, false)
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return &noMatch{query: query.src}
+	}
+	loc := locations[0]
+	if loc.index < 0 {
+		return fmt.Errorf("jsonq: query '%s' does not select array elements",
+			query)
+	}
+	arr := loc.object[loc.key].([]interface{})
+	pos := loc.index + offset
+
+	result := make([]interface{}, 0, len(arr)+1)
+	result = append(result, arr[:pos]...)
+	result = append(result, item)
+	result = append(result, arr[pos:]...)
+	loc.object[loc.key] = result
+	modified()
+
+	return nil
+}
+
+func deleteLocations(locations []location) {
+	type array struct {
+		object  map[string]interface{}
+		key     string
+		deleted map[int]bool
+	}
+	var arrays []*array
+
+	modified()
+	for _, loc := range locations {
+		if loc.index < 0 {
+			delete(loc.object, loc.key)
+			continue
+		}
+		var arr *array
+		for _, a := range arrays {
+			if a.key == loc.key && sameObject(a.object, loc.object) {
+				arr = a
+				break
+			}
+		}
+		if arr == nil {
+			arr = &array{
+				object:  loc.object,
+				key:     loc.key,
+				deleted: make(map[int]bool),
+			}
+			arrays = append(arrays, arr)
+		}
+		arr.deleted[loc.index] = true
+	}
+	for _, arr := range arrays {
+		result := []interface{}{}
+		for idx, item := range arr.object[arr.key].([]interface{}) {
+			if !arr.deleted[idx] {
+				result = append(result, item)
+			}
+		}
+		arr.object[arr.key] = result
+	}
+}
+
+func sameObject(a, b map[string]interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// SetCopy is a non-mutating version of Set. It returns a copy of the
+// value with the values pointed by the query q set to newVal. The
+// copy shares all unmodified values with the original value: only the
+// objects and arrays along the modified path are copied.
+func SetCopy(value interface{}, q string, newVal interface{}) (
+	interface{}, error) {
+
+	query, err := cachedCompile(q)
+	if err != nil {
+		return nil, err
+	}
+	path, err := query.pathQuery()
+	if err != nil {
+		return nil, err
+	}
+	result, err := path.copyPath(value)
+	if err != nil {
+		return nil, err
+	}
+	err = query.Set(result, newVal)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteCopy is a non-mutating version of Delete. It returns a copy
+// of the value with the values pointed by the query q removed. See
+// SetCopy for details about the copy.
+func DeleteCopy(value interface{}, q string) (interface{}, error) {
+	query, err := cachedCompile(q)
+	if err != nil {
+		return nil, err
+	}
+	path, err := query.pathQuery()
+	if err != nil {
+		return nil, err
+	}
+	result, err := path.copyPath(value)
+	if err != nil {
+		return nil, err
+	}
+	err = query.Delete(result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateCopy is a non-mutating version of Update. It returns a copy
+// of the value with the values pointed by the query q replaced with
+// the results of the function f. See SetCopy for details about the
+// copy.
+func UpdateCopy(value interface{}, q string,
+	f func(old interface{}) (interface{}, error)) (interface{}, error) {
+
+	query, err := cachedCompile(q)
+	if err != nil {
+		return nil, err
+	}
+	path, err := query.pathQuery()
+	if err != nil {
+		return nil, err
+	}
+	result, err := path.copyPath(value)
+	if err != nil {
+		return nil, err
+	}
+	err = query.Update(result, f)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// copyPath returns a copy of the value v where the objects and
+// arrays along the query path are copied. The copying stops at the
+// first missing or non-object value and the modifying operations
+// report the error.
+func (q *query) copyPath(v interface{}) (interface{}, error) {
+	segments := q.segments()
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jsonq: query '%s' can't modify %T", q, v)
+	}
+	return copySegments(root, segments), nil
+}
+
+func copySegments(m map[string]interface{},
+	segments []*query) map[string]interface{} {
+
+	result := copyObject(m)
+	s := segments[0]
+	rest := segments[1:]
+
+	switch child := result[s.key].(type) {
+	case []interface{}:
+		if len(rest) > 0 && len(s.filters) == 0 {
+			break
+		}
+		arr := make([]interface{}, len(child))
+		copy(arr, child)
+		if len(rest) > 0 {
+			for idx, item := range arr {
+				obj, ok := item.(map[string]interface{})
+				if ok {
+					arr[idx] = copySegments(obj, rest)
+				}
+			}
+		}
+		result[s.key] = arr
+
+	case map[string]interface{}:
+		if f := s.keyFilter(); f != nil {
+			obj := copyObject(child)
+			if len(rest) > 0 {
+				for _, key := range f.keys(obj) {
+					m, ok := obj[key].(map[string]interface{})
+					if ok {
+						obj[key] = copySegments(m, rest)
+					}
+				}
+			}
+			result[s.key] = obj
+		} else if len(rest) > 0 {
+			result[s.key] = copySegments(child, rest)
+		}
+	}
+	return result
+}
+
+func copyObject(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// location identifies a value inside a JSON object: either the value
+// of the key in the object, or an element of the key's array value.
+type location struct {
+	object map[string]interface{}
+	key    string
+	index  int
+}
+
+// Get returns the value at the location.
+func (l location) Get() interface{} {
+	if l.index < 0 {
+		return l.object[l.key]
+	}
+	return l.object[l.key].([]interface{})[l.index]
+}
+
+// Set sets the value at the location.
+func (l location) Set(v interface{}) {
+	modified()
+	if l.index < 0 {
+		l.object[l.key] = v
+	} else {
+		l.object[l.key].([]interface{})[l.index] = v
+	}
+}
+
+// creatable tests if SetCreate can create the values of the query
+// segments. The segments can have only non-negative index filters.
+func (q *query) creatable() bool {
+	for ; q != nil; q = q.left {
+		if len(q.filters) == 0 {
+			continue
+		}
+		index, ok := q.indexFilter()
+		if !ok || index < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// createParent returns the parent object of the query's last key,
+// creating all missing intermediate objects and arrays.
+func (q *query) createParent(v interface{}) (map[string]interface{}, error) {
+	if q.left == nil {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("jsonq: query '%s' can't modify %T", q, v)
+		}
+		return m, nil
+	}
+	parent, err := q.left.createParent(v)
+	if err != nil {
+		return nil, err
+	}
+	var child interface{}
+	if index, ok := q.left.indexFilter(); ok {
+		arr, err := q.left.createArray(parent, index)
+		if err != nil {
+			return nil, err
+		}
+		if arr[index] == nil {
+			arr[index] = make(map[string]interface{})
+		}
+		child = arr[index]
+	} else {
+		var ok bool
+		child, ok = parent[q.left.key]
+		if !ok {
+			child = make(map[string]interface{})
+			parent[q.left.key] = child
+		}
+	}
+	m, ok := child.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jsonq: query '%s' can't modify %T", q, child)
+	}
+	return m, nil
+}
+
+// createArray returns the array value of the query's key in the
+// parent object, creating a missing array and extending a short array
+// with null values so that it has an element at the index.
+func (q *query) createArray(parent map[string]interface{}, index int) (
+	[]interface{}, error) {
+
+	var arr []interface{}
+	child, ok := parent[q.key]
+	if ok {
+		arr, ok = child.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("jsonq: query '%s' can't index %T", q,
+				child)
+		}
+	}
+	for len(arr) <= index {
+		arr = append(arr, nil)
+	}
+	parent[q.key] = arr
+	return arr, nil
+}
+
+// indexFilter tests if the query's only filter is an index filter and
+// returns the filter's index.
+func (q *query) indexFilter() (int, bool) {
+	if len(q.filters) != 1 {
+		return 0, false
+	}
+	c, ok := q.filters[0].(*comparative)
+	if !ok || c.Op != tInt {
+		return 0, false
+	}
+	return c.Left.IntVal, true
+}
+
+// locate finds the locations of the values matched by the query. If
+// the create argument is true, a missing last key is located into its
+// parent object.
+func (q *query) locate(v interface{}, create bool) ([]location, error) {
+	if q.left == nil {
+		return q.locateSegment(v, create)
+	}
+	v, err := q.left.Eval(v)
+	if err != nil {
+		return nil, err
+	}
+	if !q.left.selects() {
+		return q.locateSegment(v, create)
+	}
+	var result []location
+	for _, item := range v.([]interface{}) {
+		locations, err := q.locateSegment(item, create)
+		if err == ErrorOptionalMissing {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, locations...)
+	}
+	return result, nil
+}
+
+// locateSegment finds the locations of the values matched by the
+// query's key and filters in the value v.
+func (q *query) locateSegment(v interface{}, create bool) ([]location, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jsonq: query '%s' can't modify %T", q, v)
+	}
+	child, ok := m[q.key]
+	if !ok {
+		if create && len(q.filters) == 0 {
+			return []location{{
+				object: m,
+				key:    q.key,
+				index:  -1,
+			}}, nil
+		}
+		if q.optional {
+			return nil, ErrorOptionalMissing
+		}
+		return nil, q.notFoundError(m)
+	}
+	if len(q.filters) == 0 {
+		return []location{{
+			object: m,
+			key:    q.key,
+			index:  -1,
+		}}, nil
+	}
+	if f := q.keyFilter(); f != nil {
+		obj, ok := child.(map[string]interface{})
+		if !ok || len(q.filters) > 1 {
+			return nil, fmt.Errorf("jsonq: query '%s' can't modify %T", q,
+				child)
+		}
+		var result []location
+		for _, key := range f.keys(obj) {
+			result = append(result, location{
+				object: obj,
+				key:    key,
+				index:  -1,
+			})
+		}
+		return result, nil
+	}
+
+	arr, isArray := child.([]interface{})
+	if !isArray {
+		arr = []interface{}{child}
+	}
+	indices, err := q.filterIndices(nil, arr, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result []location
+	for _, idx := range indices {
+		loc := location{
+			object: m,
+			key:    q.key,
+			index:  idx,
+		}
+		if !isArray {
+			loc.index = -1
+		}
+		result = append(result, loc)
+	}
+	return result, nil
+}
@@ -0,0 +1,426 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseAssign(t *testing.T) interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(assign), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	return v
+}
+
+func TestSet(t *testing.T) {
+	v := parseAssign(t)
+
+	err := Set(v, "issue.key", "OP-2")
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	key, err := GetString(v, "issue.key")
+	if err != nil {
+		t.Fatalf("GetString failed: %s", err)
+	}
+	if key != "OP-2" {
+		t.Errorf("Set: got %s, expected OP-2", key)
+	}
+
+	err = Set(v, "issue.fields.project.id", 1.0)
+	if err != nil {
+		t.Fatalf("Set new key failed: %s", err)
+	}
+	id, err := GetInt(v, "issue.fields.project.id")
+	if err != nil {
+		t.Fatalf("GetInt failed: %s", err)
+	}
+	if id != 1 {
+		t.Errorf("Set: got %v, expected 1", id)
+	}
+
+	err = Set(v, `issue.changelog.items[fieldId=="assignee"][1]`,
+		map[string]interface{}{
+			"fieldId":  "assignee",
+			"toString": "Bill Lumbergh",
+		})
+	if err != nil {
+		t.Fatalf("Set filtered failed: %s", err)
+	}
+	to, err := Ctx(v).Select("issue.changelog.items").Select("toString").
+		Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	if to[1] != "Veijo Linux" || to[2] != "Bill Lumbergh" {
+		t.Errorf("Set filtered: got %v", to)
+	}
+
+	err = Set(v, "issue.missing.key", "value")
+	if err == nil {
+		t.Errorf("Set succeeded with missing intermediate element")
+	}
+	err = Set(v, "issue.key.value", "value")
+	if err == nil {
+		t.Errorf("Set succeeded into string value")
+	}
+	err = Set(v, "issue.changelog.items[5]", "value")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Set out of range index: expected ErrNotFound, got %v", err)
+	}
+	err = Set(v, `issue.changelog.items[fieldId=="none"].toString`, "value")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Set unmatched filter: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestContextSet(t *testing.T) {
+	v := parseAssign(t)
+
+	err := Ctx(v).Select(`issue.changelog.items[fieldId=="assignee"]`).
+		Set("reviewed", true)
+	if err != nil {
+		t.Fatalf("Context.Set failed: %s", err)
+	}
+	count, err := Ctx(v).Select(`issue.changelog.items`).
+		Filter(func(v interface{}) (bool, error) {
+			_, err := Get(v, "reviewed")
+			return err == nil, nil
+		}).Count()
+	if err != nil {
+		t.Fatalf("Count failed: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("Context.Set: got %v reviewed items, expected 2", count)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	v := parseAssign(t)
+
+	err := Delete(v, "issue.fields.project")
+	if err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	data, err := GetJSON(v, "issue.fields")
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	if string(data) != "{}" {
+		t.Errorf("Delete: got %s, expected {}", data)
+	}
+
+	err = Delete(v, `issue.changelog.items[fieldId=="assignee"]`)
+	if err != nil {
+		t.Fatalf("Delete filtered failed: %s", err)
+	}
+	to, err := Ctx(v).Select("issue.changelog.items").Select("toString").
+		Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	if len(to) != 1 || to[0] != "development" {
+		t.Errorf("Delete filtered: got %v", to)
+	}
+
+	err = Ctx(v).Select("issue").Delete("?missing")
+	if err != nil {
+		t.Errorf("Delete of optional element failed: %s", err)
+	}
+	err = Delete(v, "issue.missing")
+	if err == nil {
+		t.Errorf("Delete of missing element succeeded")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	v := parseAssign(t)
+
+	redact := func(old interface{}) (interface{}, error) {
+		str, ok := old.(string)
+		if !ok {
+			return old, nil
+		}
+		return strings.Repeat("*", len(str)), nil
+	}
+	err := Update(v, `issue.changelog.items[fieldId=="assignee"]`,
+		func(old interface{}) (interface{}, error) {
+			return old, Update(old, "?fromString", redact)
+		})
+	if err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+	from, err := Ctx(v).Select("issue.changelog.items").Select("fromString").
+		Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	if from[0] != "backlog" || from[1] != "" || from[2] != "***********" {
+		t.Errorf("Update: got %v", from)
+	}
+
+	err = Update(v, "issue.count", func(old interface{}) (interface{}, error) {
+		return old.(float64) + 1, nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %s", err)
+	}
+	count, err := GetInt(v, "issue.count")
+	if err != nil {
+		t.Fatalf("GetInt failed: %s", err)
+	}
+	if count != 43 {
+		t.Errorf("Update: got %v, expected 43", count)
+	}
+
+	fail := errors.New("fail")
+	err = Update(v, "issue.key", func(old interface{}) (interface{}, error) {
+		return nil, fail
+	})
+	if err != fail {
+		t.Errorf("Update did not return function error: %v", err)
+	}
+}
+
+func TestSetCreate(t *testing.T) {
+	v := make(map[string]interface{})
+
+	err := SetCreate(v, "issue.fields.project.name", "Operations")
+	if err != nil {
+		t.Fatalf("SetCreate failed: %s", err)
+	}
+	err = SetCreate(v, "issue.labels[1]", "ops")
+	if err != nil {
+		t.Fatalf("SetCreate array failed: %s", err)
+	}
+	err = SetCreate(v, "issue.labels[0]", "dev")
+	if err != nil {
+		t.Fatalf("SetCreate array failed: %s", err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+	expected := `{"issue":{"fields":{"project":{"name":"Operations"}},"labels":["dev","ops"]}}`
+	if string(data) != expected {
+		t.Errorf("SetCreate: got %s, expected %s", data, expected)
+	}
+
+	err = SetCreate(v, "issue.fields.project.name.first", "Operations")
+	if err == nil {
+		t.Errorf("SetCreate succeeded into string value")
+	}
+
+	v = make(map[string]interface{})
+	err = SetCreate(v, "a.b[1].c", 1)
+	if err != nil {
+		t.Fatalf("SetCreate nested array failed: %s", err)
+	}
+	err = SetCreate(v, "a.b[0].d[1]", 2)
+	if err != nil {
+		t.Fatalf("SetCreate nested array failed: %s", err)
+	}
+	err = SetCreate(v, "a.b[1].e", 3)
+	if err != nil {
+		t.Fatalf("SetCreate nested array failed: %s", err)
+	}
+	data, err = json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+	expected = `{"a":{"b":[{"d":[null,2]},{"c":1,"e":3}]}}`
+	if string(data) != expected {
+		t.Errorf("SetCreate: got %s, expected %s", data, expected)
+	}
+	err = SetCreate(v, "a.b[0].d[0].x", 4)
+	if err != nil {
+		t.Fatalf("SetCreate nested array failed: %s", err)
+	}
+	data, err = json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %s", err)
+	}
+	expected = `{"a":{"b":[{"d":[{"x":4},2]},{"c":1,"e":3}]}}`
+	if string(data) != expected {
+		t.Errorf("SetCreate: got %s, expected %s", data, expected)
+	}
+	err = SetCreate(v, "a.b[1].c[0]", 5)
+	if err == nil {
+		t.Errorf("SetCreate succeeded indexing number value")
+	}
+}
+
+func TestInsert(t *testing.T) {
+	v := parseAssign(t)
+
+	err := InsertBefore(v, `issue.changelog.items[fieldId=="assignee"]`,
+		map[string]interface{}{
+			"fieldId":  "comment",
+			"toString": "before",
+		})
+	if err != nil {
+		t.Fatalf("InsertBefore failed: %s", err)
+	}
+	err = InsertAfter(v, `issue.changelog.items[fieldId=="assignee"]`,
+		map[string]interface{}{
+			"fieldId":  "comment",
+			"toString": "after",
+		})
+	if err != nil {
+		t.Fatalf("InsertAfter failed: %s", err)
+	}
+	to, err := Ctx(v).Select("issue.changelog.items").Select("toString").
+		Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	expected := []string{
+		"development", "before", "Veijo Linux", "after", "Milton Waddams",
+	}
+	if strings.Join(to, ",") != strings.Join(expected, ",") {
+		t.Errorf("Insert: got %v, expected %v", to, expected)
+	}
+
+	err = InsertAfter(v, `issue.changelog.items[fieldId=="none"]`, 1.0)
+	if err == nil {
+		t.Errorf("InsertAfter succeeded without matching elements")
+	}
+	err = InsertBefore(v, `issue.changelog.items`, 1.0)
+	if err == nil {
+		t.Errorf("InsertBefore succeeded without filters")
+	}
+	err = InsertBefore(v, `issue.key[0]`, 1.0)
+	if err == nil {
+		t.Errorf("InsertBefore succeeded into non-array value")
+	}
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	v := parseAssign(t)
+	orig := marshal(t, v)
+
+	w, err := SetCopy(v, `issue.changelog.items[fieldId=="assignee"][0]`, "x")
+	if err != nil {
+		t.Fatalf("SetCopy failed: %s", err)
+	}
+	w, err = DeleteCopy(w, "issue.fields.project")
+	if err != nil {
+		t.Fatalf("DeleteCopy failed: %s", err)
+	}
+	w, err = UpdateCopy(w, "issue.count",
+		func(old interface{}) (interface{}, error) {
+			return old.(float64) * 2, nil
+		})
+	if err != nil {
+		t.Fatalf("UpdateCopy failed: %s", err)
+	}
+	if marshal(t, v) != orig {
+		t.Errorf("copy-on-write modified original value")
+	}
+	ops, err := Diff(v, w)
+	if err != nil {
+		t.Fatalf("Diff failed: %s", err)
+	}
+	expected := `[{"op":"replace","path":"/issue/changelog/items/1","value":"x"},{"op":"replace","path":"/issue/count","value":84},{"op":"remove","path":"/issue/fields/project"}]`
+	if marshal(t, ops) != expected {
+		t.Errorf("copy-on-write: got %s, expected %s", marshal(t, ops),
+			expected)
+	}
+
+	// Unmodified values are shared.
+	a, _ := Get(v, "issue.changelog.items")
+	b, _ := Get(w, "issue.changelog.items")
+	if reflect.ValueOf(a.([]interface{})[2]).Pointer() !=
+		reflect.ValueOf(b.([]interface{})[2]).Pointer() {
+		t.Errorf("copy-on-write did not share values")
+	}
+	_, err = SetCopy(v, "issue.missing.key", 1.0)
+	if err == nil {
+		t.Errorf("SetCopy succeeded with missing intermediate element")
+	}
+}
+
+func TestCopyOnWriteKeyFilter(t *testing.T) {
+	v := unmarshal(t, `{
+  "issue": {
+    "fields": {
+      "customfield_10": {"value": "a"},
+      "customfield_11": {"value": "b"},
+      "summary": "text"
+    }
+  }
+}`)
+	orig := marshal(t, v)
+
+	w, err := SetCopy(v, `issue.fields[key=~"^customfield_"]`, "X")
+	if err != nil {
+		t.Fatalf("SetCopy failed: %s", err)
+	}
+	expected := `{"issue":{"fields":{"customfield_10":"X","customfield_11":"X","summary":"text"}}}`
+	if marshal(t, w) != expected {
+		t.Errorf("SetCopy: got %s, expected %s", marshal(t, w), expected)
+	}
+	w, err = SetCopy(v, `issue.fields[key=~"^customfield_"].value`, "Y")
+	if err != nil {
+		t.Fatalf("SetCopy failed: %s", err)
+	}
+	expected = `{"issue":{"fields":{"customfield_10":{"value":"Y"},"customfield_11":{"value":"Y"},"summary":"text"}}}`
+	if marshal(t, w) != expected {
+		t.Errorf("SetCopy: got %s, expected %s", marshal(t, w), expected)
+	}
+	w, err = DeleteCopy(v, `issue.fields[key=~"^customfield_"]`)
+	if err != nil {
+		t.Fatalf("DeleteCopy failed: %s", err)
+	}
+	expected = `{"issue":{"fields":{"summary":"text"}}}`
+	if marshal(t, w) != expected {
+		t.Errorf("DeleteCopy: got %s, expected %s", marshal(t, w), expected)
+	}
+	if marshal(t, v) != orig {
+		t.Errorf("copy-on-write modified original value: %s",
+			marshal(t, v))
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	v := parseAssign(t)
+
+	reviewed, err := Ctx(v).
+		Select(`issue.changelog.items[fieldId=="assignee"]`).
+		SetAll("reviewed", true).
+		SetAll("reviewer", "Bill Lumbergh").
+		Select("reviewed").
+		Bools()
+	if err != nil {
+		t.Fatalf("SetAll failed: %s", err)
+	}
+	if len(reviewed) != 2 || !reviewed[0] || !reviewed[1] {
+		t.Errorf("SetAll: got %v", reviewed)
+	}
+	reviewers, err := Ctx(v).
+		Select(`issue.changelog.items[fieldId=="assignee"]`).
+		Select("reviewer").
+		Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	if len(reviewers) != 2 || reviewers[1] != "Bill Lumbergh" {
+		t.Errorf("SetAll: got %v", reviewers)
+	}
+
+	_, err = Ctx(v).Select("issue.key").SetAll("reviewed", true).Get()
+	if err == nil {
+		t.Errorf("SetAll succeeded into string value")
+	}
+}
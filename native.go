@@ -0,0 +1,235 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// lookup gets the value of the key from the object value v. The
+// object can be a JSON object or a native Go map with string keys or
+// a Go struct. The struct fields are matched by their json tag names,
+// or by field names for fields without json tags. The found return
+// value tells if the key was found and the ok return value tells if
+// the value v is an object.
+func lookup(v interface{}, key string) (child interface{}, found, ok bool) {
+	m, ok := v.(map[string]interface{})
+	if ok {
+		child, found = m[key]
+		return child, found, true
+	}
+
+	rv := indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false, false
+		}
+		val := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !val.IsValid() {
+			return nil, false, true
+		}
+		return val.Interface(), true, true
+
+	case reflect.Struct:
+		index, found := structFields(rv.Type())[key]
+		if !found {
+			return nil, false, true
+		}
+		field, ok := fieldByIndex(rv, index)
+		if !ok {
+			return nil, false, true
+		}
+		return field.Interface(), true, true
+
+	default:
+		return nil, false, false
+	}
+}
+
+// objectKeys returns the sorted keys of the object value v. The
+// object can be a JSON object, a native Go map with string keys, or
+// a Go struct.
+func objectKeys(v interface{}) []string {
+	var keys []string
+	m, ok := v.(map[string]interface{})
+	if ok {
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	rv := indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+
+	case reflect.Struct:
+		for key := range structFields(rv.Type()) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// arrayValue returns the elements of the array value v. The array can
+// be a JSON array or a native Go slice or array.
+func arrayValue(v interface{}) ([]interface{}, bool) {
+	arr, ok := v.([]interface{})
+	if ok {
+		return arr, true
+	}
+	rv := indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as strings in JSON.
+			return nil, false
+		}
+		result := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			result[i] = rv.Index(i).Interface()
+		}
+		return result, true
+
+	default:
+		return nil, false
+	}
+}
+
+// normalize converts native Go scalar values into their JSON value
+// counterparts: numbers to float64, and string and boolean types to
+// string and bool. Other values are returned as-is.
+func normalize(v interface{}) interface{} {
+	switch v.(type) {
+	case nil, string, float64, bool, json.Number,
+		map[string]interface{}, []interface{}:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return float64(rv.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+
+	case reflect.String:
+		return rv.String()
+
+	case reflect.Bool:
+		return rv.Bool()
+
+	default:
+		return v
+	}
+}
+
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// fieldByIndex gets the nested struct field by its index. The
+// function returns false if the field is inside a nil embedded
+// struct pointer.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 {
+			rv = indirect(rv)
+			if !rv.IsValid() {
+				return rv, false
+			}
+		}
+		rv = rv.Field(idx)
+	}
+	return rv, true
+}
+
+var fieldCache sync.Map
+
+// structFields returns the JSON names and field indices of the
+// struct type's fields.
+func structFields(t reflect.Type) map[string][]int {
+	cached, ok := fieldCache.Load(t)
+	if ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	collectFields(t, nil, fields)
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		idx := strings.IndexByte(tag, ',')
+		if idx >= 0 {
+			name = tag[:idx]
+		}
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		if f.Anonymous && len(name) == 0 {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, fieldIndex, fields)
+				continue
+			}
+		}
+		if len(f.PkgPath) != 0 {
+			// Unexported field.
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		_, ok := fields[name]
+		if ok && len(fields[name]) <= len(fieldIndex) {
+			// Outer fields shadow embedded fields.
+			continue
+		}
+		fields[name] = fieldIndex
+	}
+}
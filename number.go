@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// number is a JSON number that holds integers as int64 values so that
+// large integers compare precisely. The numbers that do not fit into
+// int64 or float64 without losing precision are held as big.Float
+// values.
+type number struct {
+	isInt bool
+	i     int64
+	f     float64
+	big   *big.Float
+	key   string
+}
+
+// bigPrec specifies the precision of the big.Float values parsed from
+// decimal numbers.
+const bigPrec = 256
+
+func bigNumber(f *big.Float) number {
+	return number{
+		big: f,
+	}
+}
+
+func intNumber(i int64) number {
+	return number{
+		isInt: true,
+		i:     i,
+	}
+}
+
+// toNumber converts the JSON number value v to number. The
+// json.Number values are converted to int64 values if they are
+// integers within the int64 range.
+func toNumber(v interface{}) (number, bool) {
+	switch val := v.(type) {
+	case float64:
+		return number{
+			f: val,
+		}, true
+
+	case json.Number:
+		i, err := val.Int64()
+		if err == nil {
+			return intNumber(i), true
+		}
+		bi, ok := new(big.Int).SetString(string(val), 10)
+		if ok {
+			return bigNumber(new(big.Float).SetInt(bi)), true
+		}
+		bf, ok := new(big.Float).SetPrec(bigPrec).SetString(string(val))
+		if !ok {
+			return number{}, false
+		}
+		return bigNumber(bf), true
+
+	case *big.Int:
+		if val == nil {
+			return number{}, false
+		}
+		return bigNumber(new(big.Float).SetInt(val)), true
+
+	case big.Int:
+		return bigNumber(new(big.Float).SetInt(&val)), true
+
+	case *big.Float:
+		if val == nil {
+			return number{}, false
+		}
+		return bigNumber(val), true
+
+	case big.Float:
+		return bigNumber(&val), true
+
+	default:
+		return number{}, false
+	}
+}
+
+// bigFloat returns the number as a big.Float value.
+func (n number) bigFloat() *big.Float {
+	switch {
+	case n.big != nil:
+		return n.big
+
+	case n.isInt:
+		return new(big.Float).SetInt64(n.i)
+
+	default:
+		return new(big.Float).SetFloat64(n.f)
+	}
+}
+
+// exactNumber converts the value v to number. With lenient types,
+// the strings holding numbers are converted as well.
+func (o *options) exactNumber(v interface{}) (number, bool) {
+	n, ok := toNumber(v)
+	if ok || o.strict() != Lenient {
+		return n, ok
+	}
+	f, ok, err := o.numberValue(v)
+	if !ok || err != nil {
+		return number{}, false
+	}
+	return number{
+		f: f,
+	}, true
+}
+
+// integral tests if the number is an integer.
+func (n number) integral() bool {
+	switch {
+	case n.isInt:
+		return true
+
+	case n.big != nil:
+		return n.big.IsInt()
+
+	default:
+		return n.f == math.Trunc(n.f) && !math.IsInf(n.f, 0)
+	}
+}
+
+// canonical returns the canonical representation of the number:
+// the integral values within the int64 range are represented as
+// integers. The equal numbers have equal canonical representations.
+func (n number) canonical() number {
+	if n.isInt {
+		return n
+	}
+	if n.big != nil {
+		if n.big.IsInt() {
+			i, acc := n.big.Int64()
+			if acc == big.Exact {
+				return intNumber(i)
+			}
+		}
+		f, acc := n.big.Float64()
+		if acc != big.Exact {
+			return number{
+				key: n.big.Text('p', 0),
+			}
+		}
+		n = number{
+			f: f,
+		}
+	}
+	t := math.Trunc(n.f)
+	if t == n.f && t >= math.MinInt64 && t < math.MaxInt64 {
+		return intNumber(int64(t))
+	}
+	return n
+}
+
+// cmp compares the numbers and returns -1, 0, or 1 if n is less
+// than, equal to, or greater than o.
+func (n number) cmp(o number) int {
+	switch {
+	case n.big != nil || o.big != nil:
+		return n.bigFloat().Cmp(o.bigFloat())
+
+	case n.isInt && o.isInt:
+		return compareInts(n.i, o.i)
+
+	case n.isInt:
+		return -compareIntFloat(o.f, n.i)
+
+	case o.isInt:
+		return compareIntFloat(n.f, o.i)
+
+	default:
+		switch {
+		case n.f < o.f:
+			return -1
+
+		case n.f > o.f:
+			return 1
+
+		default:
+			return 0
+		}
+	}
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+
+	case a > b:
+		return 1
+
+	default:
+		return 0
+	}
+}
+
+// compareIntFloat compares the float f to the integer i without
+// converting i to float64, which would lose precision for large
+// integers.
+func compareIntFloat(f float64, i int64) int {
+	if f >= math.MaxInt64 {
+		return 1
+	}
+	if f < math.MinInt64 {
+		return -1
+	}
+	t := math.Trunc(f)
+	cmp := compareInts(int64(t), i)
+	if cmp != 0 {
+		return cmp
+	}
+	switch {
+	case f > t:
+		return 1
+
+	case f < t:
+		return -1
+
+	default:
+		return 0
+	}
+}
+
+// bigFloatValue converts the JSON value v to a new big.Float. The
+// value can be a number or a string holding a decimal number.
+func bigFloatValue(v interface{}) (*big.Float, bool) {
+	str, ok := v.(string)
+	if ok {
+		v = json.Number(strings.TrimSpace(str))
+	}
+	n, ok := toNumber(v)
+	if !ok {
+		return nil, false
+	}
+	f := n.bigFloat()
+	return new(big.Float).SetPrec(f.Prec()).Set(f), true
+}
+
+// bigIntValue converts the JSON value v to a new big.Int. The value
+// can be an integral number or a string holding a decimal integer.
+func bigIntValue(v interface{}) (*big.Int, bool) {
+	f, ok := bigFloatValue(v)
+	if !ok || !f.IsInt() {
+		return nil, false
+	}
+	i, _ := f.Int(nil)
+	return i, true
+}
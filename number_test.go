@@ -0,0 +1,171 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestNumericComparisons(t *testing.T) {
+	data := []byte(`{"items": [
+  {"id": "a", "priority": 10},
+  {"id": "b", "priority": 10.5},
+  {"id": "c", "priority": 9.5},
+  {"id": "d", "priority": 9007199254740993}
+]}`)
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		q        string
+		expected string
+	}{
+		{`items[priority>10].id`, `["b","d"]`},
+		{`items[priority==10].id`, `"a"`},
+		{`items[priority<10].id`, `"c"`},
+		{`items[priority<=10].id`, `["a","c"]`},
+	}
+	for _, test := range tests {
+		result, err := Ctx(v).Select(test.q).MarshalJSON()
+		if err != nil {
+			t.Fatalf("%s: %s", test.q, err)
+		}
+		if string(result) != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.q, result, test.expected)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	ctx, err := FromDecoder(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ctx.Select(`items[priority>9007199254740992].id`).
+		MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `"d"` {
+		t.Errorf("UseNumber: got %s, expected \"d\"", result)
+	}
+}
+
+func TestNumberCmp(t *testing.T) {
+	tests := []struct {
+		a, b     number
+		expected int
+	}{
+		{intNumber(1), intNumber(2), -1},
+		{intNumber(1<<53 + 1), number{f: 1 << 53}, 1},
+		{number{f: 10.5}, intNumber(10), 1},
+		{number{f: -10.5}, intNumber(-10), -1},
+		{number{f: 1e300}, intNumber(1 << 62), 1},
+		{number{f: 3}, intNumber(3), 0},
+	}
+	for _, test := range tests {
+		cmp := test.a.cmp(test.b)
+		if cmp != test.expected {
+			t.Errorf("%v.cmp(%v)=%d, expected %d", test.a, test.b, cmp,
+				test.expected)
+		}
+		if -test.b.cmp(test.a) != test.expected {
+			t.Errorf("%v.cmp(%v) is not antisymmetric", test.b, test.a)
+		}
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(`{"transfers": [
+  {"id": "a", "amount": 123456789012345678901234567890},
+  {"id": "b", "amount": 123456789012345678901234567891},
+  {"id": "c", "amount": 5, "fee": "1000000000000000000000.5"}
+]}`)))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		q        string
+		expected string
+	}{
+		{`transfers[amount>123456789012345678901234567890].id`, `"b"`},
+		{`transfers[amount==123456789012345678901234567890].id`, `"a"`},
+		{`transfers[amount>100].id::string`, `["a","b"]`},
+		{`transfers[0].amount::int`, `123456789012345678901234567890`},
+	}
+	for _, test := range tests {
+		result, err := Ctx(v).Select(test.q).MarshalJSON()
+		if err != nil {
+			t.Fatalf("%s: %s", test.q, err)
+		}
+		if string(result) != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.q, result, test.expected)
+		}
+	}
+
+	items, err := Ctx(v).Select("transfers[]").Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := GetBigInt(items[1], "amount")
+	if err != nil || i.String() != "123456789012345678901234567891" {
+		t.Errorf("GetBigInt: got %v %v", i, err)
+	}
+	f, err := GetBigFloat(items[2], "fee")
+	if err != nil || f.Text('f', 1) != "1000000000000000000000.5" {
+		t.Errorf("GetBigFloat: got %v %v", f, err)
+	}
+	_, err = GetBigInt(items[2], "fee")
+	if err == nil {
+		t.Errorf("GetBigInt accepted fractional number")
+	}
+
+	var transfer struct {
+		ID     string     `jsonq:"id"`
+		Amount *big.Int   `jsonq:"amount"`
+		Float  *big.Float `jsonq:"amount"`
+	}
+	err = Ctx(v).Select("transfers[1]").Extract(&transfer)
+	if err != nil {
+		t.Fatalf("Extract failed: %s", err)
+	}
+	if transfer.Amount.String() != "123456789012345678901234567891" {
+		t.Errorf("Extract: got amount %s", transfer.Amount)
+	}
+
+	native := map[string]interface{}{
+		"balance": struct {
+			Amount *big.Int
+		}{
+			Amount: transfer.Amount,
+		},
+	}
+	_, err = Get(native, "balance[Amount>=123456789012345678901234567891]")
+	if err != nil {
+		t.Errorf("Get native big.Int failed: %s", err)
+	}
+
+	q, err := Compile("transfers[amount<=123456789012345678901234567890]")
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	if q.q.String() != "transfers[amount <= 123456789012345678901234567890]" {
+		t.Errorf("String: got %s", q.q)
+	}
+	_, err = Compile("transfers[123456789012345678901234567890]")
+	if err == nil {
+		t.Errorf("Compile accepted big array index")
+	}
+}
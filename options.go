@@ -0,0 +1,240 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option configures the compilation and evaluation of queries. The
+// options are accepted by Compile, Ctx, and the Get functions.
+type Option func(o *options)
+
+type options struct {
+	foldKeys   bool
+	strictness Strictness
+	maxDepth   int
+	cache      *lru
+	tracer     Tracer
+	comparator Comparator
+	missing    MissingPolicy
+	null       NullPolicy
+	jsonTags   bool
+	maxResults int
+	maxDoc     int
+	timeout    time.Duration
+	indices    []*FieldIndex
+}
+
+// WithCaseInsensitiveKeys matches the query keys to the object keys
+// case-insensitively when the object does not have an exact match
+// for the key. If several keys match, the lexically smallest one is
+// used.
+func WithCaseInsensitiveKeys() Option {
+	return func(o *options) {
+		o.foldKeys = true
+	}
+}
+
+// WithMaxDepth limits the depth of the queries to depth. The limit
+// applies in addition to the limit set with SetMaxQueryDepth. The
+// depth 0 removes the limit.
+func WithMaxDepth(depth int) Option {
+	return func(o *options) {
+		o.maxDepth = depth
+	}
+}
+
+// WithMaxResults limits the number of values that a query can
+// select to n. The limit applies to the intermediate selections of
+// the query segments and to the selections of contexts. Exceeding the
+// limit fails the evaluation with a *LimitError. The limit 0 removes
+// the limit.
+func WithMaxResults(n int) Option {
+	return func(o *options) {
+		o.maxResults = n
+	}
+}
+
+// WithTimeout limits the duration of each evaluation to d. The
+// evaluation of Ctx contexts is timed separately for each operation.
+// The evaluation exceeding the timeout fails with ErrEvalTimeout. The
+// timeout is independent of the contexts given to the Context
+// functions, such as SelectContext. The duration 0 removes the
+// timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithMaxDocumentDepth limits the nesting depth of the documents
+// that the queries are evaluated against to depth. The top-level
+// object or array has depth 1. The documents are checked once when
+// they enter a context with Ctx, FromBytes, FromReader, or
+// FromDecoder, so the queries of the context do not walk the document
+// again. Exceeding the limit fails with a *LimitError. The depth 0
+// removes the limit. The option does not apply to the Get functions
+// and to the compiled queries, which evaluate against documents that
+// are already in memory.
+func WithMaxDocumentDepth(depth int) Option {
+	return func(o *options) {
+		o.maxDoc = depth
+	}
+}
+
+// WithLenientTypes converts the selected values to the requested
+// types when possible: numbers and booleans are accepted as strings,
+// and strings holding numbers or booleans are accepted as numbers and
+// booleans. The conversions also apply to the filter comparisons.
+// WithLenientTypes is equivalent to WithStrictness(Lenient).
+func WithLenientTypes() Option {
+	return WithStrictness(Lenient)
+}
+
+// WithJSONTags makes Extract fall back to the json struct tags. The
+// fields that do not have a jsonq tag but have a json tag are
+// extracted from the optional key named by the json tag, relative to
+// the selection. For example, the field:
+//
+//	Summary string `json:"summary,omitempty"`
+//
+// is extracted with the query "?summary". The fields with the json
+// tag "-" and the fields of unsupported types are ignored.
+func WithJSONTags() Option {
+	return func(o *options) {
+		o.jsonTags = true
+	}
+}
+
+// WithQueryCache compiles the queries using a private query cache
+// holding at most size parsed queries instead of the global query
+// cache. The cache is created when WithQueryCache is called, so the
+// returned option can be reused to share the cache between calls.
+// The size 0 disables caching.
+func WithQueryCache(size int) Option {
+	cache := newLRU(size)
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// newOptions applies the options. It returns nil if no options are
+// given so that the calls without options take the default code
+// paths.
+func newOptions(opts []Option) *options {
+	if len(opts) == 0 {
+		return nil
+	}
+	o := new(options)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// compile compiles the query q with the options' query cache and
+// checks it against the options' depth limit.
+func (o *options) compile(q string) (*Query, error) {
+	if o == nil {
+		return cachedCompile(q)
+	}
+	cache := queryCache
+	if o.cache != nil {
+		cache = o.cache
+	}
+	query, err := cache.compile(q)
+	if err != nil {
+		return nil, err
+	}
+	if o.maxDepth > 0 {
+		depth := query.depth()
+		if depth > o.maxDepth {
+			return nil, fmt.Errorf("jsonq: query too deep: depth %d, maximum is %d",
+				depth, o.maxDepth)
+		}
+	}
+	return query, nil
+}
+
+// useJSONTags tests if the extraction falls back to the json tags.
+func (o *options) useJSONTags() bool {
+	return o != nil && o.jsonTags
+}
+
+// env creates an evaluation environment for the options.
+func (o *options) env() *env {
+	if o == nil {
+		return nil
+	}
+	e := &env{
+		opts: o,
+	}
+	if o.timeout > 0 {
+		e.deadline = time.Now().Add(o.timeout)
+	}
+	return e
+}
+
+// stringValue converts the value v to string.
+func (o *options) stringValue(v interface{}) (string, bool) {
+	if v == nil && o.strict() == Strict {
+		return "", false
+	}
+	val, ok := stringValue(v)
+	if ok || o.strict() != Lenient {
+		return val, ok
+	}
+	switch val := v.(type) {
+	case bool:
+		return strconv.FormatBool(val), true
+
+	default:
+		f, ok, err := numberValue(v)
+		if !ok || err != nil {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	}
+}
+
+// numberValue converts the value v to float64.
+func (o *options) numberValue(v interface{}) (float64, bool, error) {
+	val, ok, err := numberValue(v)
+	if ok || err != nil || o.strict() != Lenient {
+		return val, ok, err
+	}
+	str, ok := v.(string)
+	if !ok {
+		return 0, false, nil
+	}
+	val, err = strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	return val, true, nil
+}
+
+// boolValue converts the value v to bool.
+func (o *options) boolValue(v interface{}) (bool, bool) {
+	val, ok := v.(bool)
+	if ok || o.strict() != Lenient {
+		return val, ok
+	}
+	str, ok := v.(string)
+	if !ok {
+		return false, false
+	}
+	val, err := strconv.ParseBool(strings.TrimSpace(str))
+	if err != nil {
+		return false, false
+	}
+	return val, true
+}
@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var optionsData = `{
+  "Issue": {
+    "Key": "OPS-1",
+    "count": "42",
+    "done": "true",
+    "items": [
+      {"FieldId": "assignee", "value": "10"},
+      {"FieldId": "status", "value": 20}
+    ]
+  }
+}`
+
+func parseOptionsData(t *testing.T) interface{} {
+	var v interface{}
+	err := json.Unmarshal([]byte(optionsData), &v)
+	if err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	return v
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	v := parseOptionsData(t)
+
+	_, err := GetString(v, "issue.key")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetString matched keys case-insensitively: %v", err)
+	}
+	key, err := GetString(v, "issue.key", WithCaseInsensitiveKeys())
+	if err != nil || key != "OPS-1" {
+		t.Errorf("GetString: got %v %v, expected OPS-1", key, err)
+	}
+
+	q, err := Compile(`issue.items[fieldid=="status"].VALUE`,
+		WithCaseInsensitiveKeys())
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	n, err := Ctx(v).SelectQ(q).Ints()
+	if err != nil || len(n) != 1 || n[0] != 20 {
+		t.Errorf("SelectQ: got %v %v, expected [20]", n, err)
+	}
+
+	ids, err := Ctx(v, WithCaseInsensitiveKeys()).
+		Select("issue").Select("items[].fieldID").Strings()
+	if err != nil || len(ids) != 2 || ids[0] != "assignee" {
+		t.Errorf("Select: got %v %v", ids, err)
+	}
+}
+
+func TestLenientTypes(t *testing.T) {
+	v := parseOptionsData(t)
+
+	_, err := GetInt(v, "Issue.count")
+	var typeErr *TypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("GetInt converted string: %v", err)
+	}
+	n, err := GetInt(v, "Issue.count", WithLenientTypes())
+	if err != nil || n != 42 {
+		t.Errorf("GetInt: got %v %v, expected 42", n, err)
+	}
+	b, err := GetBool(v, "Issue.done", WithLenientTypes())
+	if err != nil || !b {
+		t.Errorf("GetBool: got %v %v, expected true", b, err)
+	}
+	s, err := Ctx(v).Select("Issue.items[].value").Strings()
+	if err == nil {
+		t.Errorf("Strings converted number: %v", s)
+	}
+	s, err = Ctx(v, WithLenientTypes()).Select("Issue.items[].value").
+		Strings()
+	if err != nil || len(s) != 2 || s[1] != "20" {
+		t.Errorf("Strings: got %v %v", s, err)
+	}
+
+	values, err := Ctx(v, WithLenientTypes()).
+		Select("Issue.items[value>=10].value").Ints()
+	if err != nil || len(values) != 2 || values[0] != 10 {
+		t.Errorf("Ints: got %v %v", values, err)
+	}
+}
+
+func TestOptionsMaxDepth(t *testing.T) {
+	v := parseOptionsData(t)
+
+	_, err := Get(v, "Issue.items[0].value", WithMaxDepth(4))
+	if err != nil {
+		t.Errorf("Get failed: %s", err)
+	}
+	_, err = Get(v, "Issue.items[0].value", WithMaxDepth(3))
+	if err == nil {
+		t.Errorf("WithMaxDepth did not limit query depth")
+	}
+	_, err = Ctx(v, WithMaxDepth(1)).Select("Issue.Key").Get()
+	if err == nil {
+		t.Errorf("Ctx did not apply WithMaxDepth")
+	}
+}
+
+func TestOptionsQueryCache(t *testing.T) {
+	v := parseOptionsData(t)
+
+	cache := WithQueryCache(2)
+	for _, q := range []string{"Issue.Key", "Issue.count", "Issue.done"} {
+		_, err := GetString(v, q, cache)
+		if err != nil {
+			t.Fatalf("GetString(%s) failed: %s", q, err)
+		}
+	}
+	var o options
+	cache(&o)
+	if o.cache.Len() != 2 {
+		t.Errorf("query cache has %d entries, expected 2", o.cache.Len())
+	}
+}
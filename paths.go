@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Paths returns the paths of all leaf values in the document v in
+// jsonq syntax. The array elements are addressed with index filters,
+// for example, issue.changelog.items[1].fieldId. The object keys are
+// visited in sorted order and the array elements in their order.
+// Empty objects and arrays are leaves. The query syntax can't address
+// the elements of arrays nested directly in arrays, so the nested
+// arrays are leaves. The root array has no paths and Paths returns
+// nil for it.
+func Paths(v interface{}) []string {
+	var result []string
+	appendPaths("", v, false, &result)
+	return result
+}
+
+// appendPaths appends the paths of the leaf values of v to result. The
+// element argument tells if v is an array element.
+func appendPaths(prefix string, v interface{}, element bool,
+	result *[]string) {
+
+	v = normalize(v)
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			break
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path := QuoteKey(key)
+			if len(prefix) > 0 {
+				path = prefix + "." + path
+			}
+			appendPaths(path, val[key], false, result)
+		}
+		return
+
+	default:
+		arr, ok := arrayValue(v)
+		if !ok || len(arr) == 0 || element {
+			break
+		}
+		if len(prefix) == 0 {
+			return
+		}
+		for idx, item := range arr {
+			appendPaths(prefix+"["+strconv.Itoa(idx)+"]", item, true, result)
+		}
+		return
+	}
+	if len(prefix) > 0 {
+		*result = append(*result, prefix)
+	}
+}
+
+// Locate returns the paths of the values that the query q matches in
+// the value v. The paths are in the jsonq syntax and they address the
+// array elements with index filters so that they can be passed to
+// Set and Delete, for example, issue.changelog.items[1].toString.
+func Locate(v interface{}, q string) ([]string, error) {
+	query, err := cachedCompile(q)
+	if err != nil {
+		return nil, err
+	}
+	return query.Locate(v)
+}
+
+// Locate returns the paths of the values that the query matches in
+// the value. See the Locate function for details.
+func (q *Query) Locate(value interface{}) ([]string, error) {
+	path, err := q.pathQuery()
+	if err != nil {
+		return nil, err
+	}
+	var e *env
+	located, err := path.locatePaths(e.withOptions(q.opts), value)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(located))
+	for idx, l := range located {
+		result[idx] = l.path
+	}
+	return result, nil
+}
+
+// located is a matched value and its path.
+type located struct {
+	path  string
+	value interface{}
+}
+
+// locatePaths evaluates the query against the value v and returns the
+// matched values with their paths.
+func (q *query) locatePaths(e *env, v interface{}) ([]located, error) {
+	var buf [16]*query
+	current := []located{{
+		value: v,
+	}}
+	for _, s := range q.appendSegments(buf[:0]) {
+		var next []located
+		for _, l := range current {
+			err := e.check()
+			if err != nil {
+				return nil, err
+			}
+			next, err = s.appendLocated(e, next, l)
+			if err != nil && err != ErrorOptionalMissing {
+				return nil, err
+			}
+		}
+		current = next
+	}
+	if len(q.typ) > 0 {
+		for _, l := range current {
+			err := q.checkType(l.value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return current, nil
+}
+
+// appendLocated appends the values that the segment matches in the
+// located value l to dst.
+func (q *query) appendLocated(e *env, dst []located, l located) (
+	[]located, error) {
+
+	child, err := q.lookupChild(e, l.value)
+	if err != nil {
+		return dst, err
+	}
+	path := QuoteKey(q.key)
+	if len(l.path) > 0 {
+		path = l.path + "." + path
+	}
+	if len(q.filters) == 0 {
+		return append(dst, located{
+			path:  path,
+			value: child,
+		}), nil
+	}
+
+	var keys []string
+	items, isArray := arrayValue(child)
+	if f := q.keyFilter(); f != nil {
+		var m map[string]interface{}
+		m, keys, err = q.matchKeys(f, child)
+		if err != nil {
+			return dst, err
+		}
+		items = make([]interface{}, len(keys))
+		for idx, key := range keys {
+			items[idx] = m[key]
+		}
+	} else if !isArray {
+		items = []interface{}{child}
+	}
+	indices, err := q.filterIndices(e, items, nil)
+	if err != nil {
+		return dst, err
+	}
+	for _, idx := range indices {
+		itemPath := path
+		if keys != nil {
+			itemPath += "." + QuoteKey(keys[idx])
+		} else if isArray {
+			itemPath += "[" + strconv.Itoa(idx) + "]"
+		}
+		dst = append(dst, located{
+			path:  itemPath,
+			value: items[idx],
+		})
+	}
+	return dst, nil
+}
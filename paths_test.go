@@ -0,0 +1,168 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	v := unmarshal(t, `{
+  "name": "x",
+  "items": [
+    {"id": 1, "tags": ["a", "b"]},
+    {"id": 2, "tags": [], "a.b": {}}
+  ],
+  "matrix": [[1, 2], [3]],
+  "nested": [[{"x": 1}]],
+  "null": null
+}`)
+	expected := []struct {
+		path string
+		leaf string
+	}{
+		{`items[0].id`, `1`},
+		{`items[0].tags[0]`, `"a"`},
+		{`items[0].tags[1]`, `"b"`},
+		{`items[1]."a.b"`, `{}`},
+		{`items[1].id`, `2`},
+		{`items[1].tags`, `[]`},
+		{`matrix[0]`, `[1,2]`},
+		{`matrix[1]`, `[3]`},
+		{`name`, `"x"`},
+		{`nested[0]`, `[{"x":1}]`},
+		{`"null"`, `null`},
+	}
+	paths := Paths(v)
+	if len(paths) != len(expected) {
+		t.Fatalf("Paths: got %q, expected %v", paths, expected)
+	}
+	for idx, path := range paths {
+		if path != expected[idx].path {
+			t.Errorf("Paths: got %s, expected %s", path, expected[idx].path)
+			continue
+		}
+		q, err := Compile(path)
+		if err != nil {
+			t.Fatalf("Compile(%s) failed: %s", path, err)
+		}
+		leaf, err := q.Eval(v)
+		if err != nil {
+			t.Fatalf("Eval(%s) failed: %s", path, err)
+		}
+		if q.selects() {
+			arr := leaf.([]interface{})
+			if len(arr) != 1 {
+				t.Errorf("Eval(%s): got %v, expected one leaf", path, arr)
+				continue
+			}
+			leaf = arr[0]
+		}
+		if data := marshal(t, leaf); data != expected[idx].leaf {
+			t.Errorf("Eval(%s): got %s, expected %s", path, data,
+				expected[idx].leaf)
+		}
+	}
+
+	for _, doc := range []string{`[1, {"a": 2}, [3]]`, `[]`, `1`} {
+		paths := Paths(unmarshal(t, doc))
+		if paths != nil {
+			t.Errorf("Paths(%s): got %q, expected nil", doc, paths)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	v := unmarshal(t, assign)
+	paths, err := Locate(v, `issue.changelog.items[toString=="Veijo Linux"]`)
+	if err != nil {
+		t.Fatalf("Locate failed: %s", err)
+	}
+	if len(paths) != 1 || paths[0] != "issue.changelog.items[1]" {
+		t.Errorf("unexpected Locate result: %v", paths)
+	}
+
+	paths, err = Locate(v, `issue.changelog.items[].?fromString`)
+	if err != nil {
+		t.Fatalf("Locate failed: %s", err)
+	}
+	if len(paths) != 3 || paths[0] != "issue.changelog.items[0].fromString" ||
+		paths[2] != "issue.changelog.items[2].fromString" {
+		t.Errorf("unexpected optional Locate result: %v", paths)
+	}
+
+	paths, err = Locate(v, `issue.changelog.items[1][key=~"String$"]`)
+	if err == nil {
+		t.Errorf("Locate accepted key filter after index: %v", paths)
+	}
+
+	paths, err = Locate(v, `issue.changelog.items[fromString=="Veijo Linux"].toString`)
+	if err != nil {
+		t.Fatalf("Locate failed: %s", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("unexpected Locate result: %v", paths)
+	}
+	err = Set(v, paths[0], "Bill Lumbergh")
+	if err != nil {
+		t.Fatalf("Set(%s) failed: %s", paths[0], err)
+	}
+	to, err := Ctx(v).
+		Select(`issue.changelog.items[fieldId=="assignee"].toString`).
+		Strings()
+	if err != nil || len(to) != 2 || to[1] != "Bill Lumbergh" {
+		t.Errorf("unexpected value after Set: %v, %v", to, err)
+	}
+
+	paths, err = Ctx(v).
+		Select(`path(issue.changelog.items[fromString != null].fieldId)`).
+		Strings()
+	if err != nil {
+		t.Fatalf("path function failed: %s", err)
+	}
+	if len(paths) != 2 || paths[0] != "issue.changelog.items[0].fieldId" {
+		t.Errorf("unexpected path function result: %v", paths)
+	}
+
+	_, err = Locate(v, `"a" + b`)
+	if err == nil {
+		t.Errorf("Locate accepted expression")
+	}
+	out, err := Format(`path( a.b[c==1] )[0]`)
+	if err != nil {
+		t.Fatalf("Format failed: %s", err)
+	}
+	if out != `path(a.b[c == 1])[0]` {
+		t.Errorf("Format: got %s", out)
+	}
+	for _, q := range []string{`path(a`, `path(a b)`, `path("a" + b)`} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted invalid query %s", q)
+		}
+	}
+}
+
+func TestLocateKeys(t *testing.T) {
+	v := unmarshal(t, custom)
+	paths, err := Locate(v, `issues[].fields[key=~"^customfield_1"]`)
+	if err != nil {
+		t.Fatalf("Locate failed: %s", err)
+	}
+	expected := []string{
+		"issues[0].fields.customfield_10001",
+		"issues[0].fields.customfield_10002",
+		"issues[1].fields.customfield_10001",
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("unexpected Locate result: %v", paths)
+	}
+	for idx, path := range paths {
+		if path != expected[idx] {
+			t.Errorf("Locate: got %s, expected %s", path, expected[idx])
+		}
+	}
+}
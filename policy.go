@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MissingPolicy specifies how the filter comparisons treat elements
+// that do not have the compared field.
+type MissingPolicy int
+
+// The missing field policies.
+const (
+	// MissingDefault fails the filter if a comparison of the
+	// filter's top-level is missing its field. The comparisons
+	// inside logical expressions evaluate to false.
+	MissingDefault MissingPolicy = iota
+	// MissingError fails the filter if any comparison is missing
+	// its field.
+	MissingError
+	// MissingFalse evaluates the comparisons missing their fields to
+	// false.
+	MissingFalse
+	// MissingSkip skips the elements missing any compared field,
+	// regardless of the other operands of the filter expression.
+	MissingSkip
+)
+
+var missingPolicies = map[MissingPolicy]string{
+	MissingDefault: "default",
+	MissingError:   "error",
+	MissingFalse:   "false",
+	MissingSkip:    "skip",
+}
+
+func (p MissingPolicy) String() string {
+	name, ok := missingPolicies[p]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{MissingPolicy %d}", p)
+}
+
+// WithMissingFields sets the policy for the filter comparisons of
+// missing fields. The comparisons of optional fields, marked with
+// '?' as in [?priority>10], always evaluate to false for the
+// elements missing the field.
+func WithMissingFields(policy MissingPolicy) Option {
+	return func(o *options) {
+		o.missing = policy
+	}
+}
+
+// NullPolicy specifies how the filter comparisons treat fields whose
+// value is null. The comparisons against the null literal, as in
+// [assignee==null], test if the field is null under all policies.
+// Since the unquoted null is the null literal, a field named null
+// must be quoted or marked optional in the filters, as in
+// ["null"=="x"] or [?null=="x"].
+type NullPolicy int
+
+// The null policies.
+const (
+	// NullDefault compares null values as empty strings against
+	// string literals and fails the comparisons against number
+	// literals.
+	NullDefault NullPolicy = iota
+	// NullFalse evaluates all comparisons of null values against
+	// non-null literals to false.
+	NullFalse
+	// NullEqual treats null values as equal only to null: the
+	// comparisons != against non-null literals are true, and the
+	// other comparisons are false.
+	NullEqual
+	// NullError fails the comparisons of null values against
+	// non-null literals.
+	NullError
+)
+
+var nullPolicies = map[NullPolicy]string{
+	NullDefault: "default",
+	NullFalse:   "false",
+	NullEqual:   "equal",
+	NullError:   "error",
+}
+
+func (p NullPolicy) String() string {
+	name, ok := nullPolicies[p]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{NullPolicy %d}", p)
+}
+
+// WithNullValues sets the policy for the filter comparisons of null
+// values.
+func WithNullValues(policy NullPolicy) Option {
+	return func(o *options) {
+		o.null = policy
+	}
+}
+
+// nullPolicy returns the null policy of the evaluation.
+func (e *env) nullPolicy() NullPolicy {
+	o := e.options()
+	if o == nil {
+		return NullDefault
+	}
+	return o.null
+}
+
+// compareNull compares the field value v to the literal value when
+// either of them is null. The ok return value is false if the
+// comparison is not resolved and the values must be compared by their
+// types.
+func (ast *comparative) compareNull(e *env, v, literal interface{}) (
+	match, ok bool, err error) {
+
+	if literal == nil {
+		switch ast.Op {
+		case tEq:
+			return v == nil, true, nil
+
+		case tNeq:
+			return v != nil, true, nil
+
+		default:
+			return false, true, fmt.Errorf("jsonq: operator %s not supported for null",
+				ast.Op)
+		}
+	}
+	switch e.nullPolicy() {
+	case NullFalse:
+		return false, true, nil
+
+	case NullEqual:
+		return ast.Op == tNeq, true, nil
+
+	case NullError:
+		want := typeName(literal)
+		if want == "int" {
+			want = "number"
+		}
+		return false, true, ast.Left.typeError(want, v)
+
+	default:
+		return false, false, nil
+	}
+}
+
+// errSkipElement reports that the filtered element must be skipped.
+var errSkipElement = errors.New("jsonq: skip element")
+
+// missingPolicy returns the missing field policy of the evaluation.
+func (e *env) missingPolicy() MissingPolicy {
+	o := e.options()
+	if o == nil {
+		return MissingDefault
+	}
+	return o.missing
+}
+
+// missing resolves the result of the comparison whose field is
+// missing. The err argument is the field's not-found error.
+func (ast *comparative) missing(e *env, err error) (bool, error) {
+	if ast.Left.Optional {
+		return false, nil
+	}
+	switch e.missingPolicy() {
+	case MissingFalse:
+		return false, nil
+
+	case MissingSkip:
+		return false, errSkipElement
+
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"errors"
+	"testing"
+)
+
+var mixedItems = map[string]interface{}{
+	"items": []interface{}{
+		map[string]interface{}{
+			"id":       "a",
+			"priority": 20.0,
+		},
+		map[string]interface{}{
+			"id": "b",
+		},
+		map[string]interface{}{
+			"id":       "c",
+			"priority": 5.0,
+		},
+	},
+}
+
+func TestMissingFields(t *testing.T) {
+	tests := []struct {
+		q        string
+		policy   MissingPolicy
+		expected string
+		fail     bool
+	}{
+		{q: `items[priority>10].id`, fail: true},
+		{q: `items[?priority>10].id`, expected: `"a"`},
+		{q: `items[?priority<=10].id`, expected: `"c"`},
+		{q: `items[priority>10 || id=="b"].id`, expected: `["a","b"]`},
+		{
+			q:        `items[priority>10].id`,
+			policy:   MissingFalse,
+			expected: `"a"`,
+		},
+		{
+			q:        `items[priority>10 || id=="b"].id`,
+			policy:   MissingSkip,
+			expected: `"a"`,
+		},
+		{
+			q:      `items[priority>10 || id=="b"].id`,
+			policy: MissingError,
+			fail:   true,
+		},
+		{
+			q:        `items[?priority>10 || id=="b"].id`,
+			policy:   MissingError,
+			expected: `["a","b"]`,
+		},
+	}
+	for _, test := range tests {
+		result, err := Ctx(mixedItems, WithMissingFields(test.policy)).
+			Select(test.q).MarshalJSON()
+		if test.fail {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s (%s): expected ErrNotFound, got %v",
+					test.q, test.policy, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s (%s): %s", test.q, test.policy, err)
+			continue
+		}
+		if string(result) != test.expected {
+			t.Errorf("%s (%s): got %s, expected %s", test.q, test.policy,
+				result, test.expected)
+		}
+	}
+
+	q, err := Compile(`items[?priority > 10]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	if q.q.String() != `items[?priority > 10]` {
+		t.Errorf("String: got %s", q.q)
+	}
+	_, err = Compile(`items[priority == ?id]`)
+	if err == nil {
+		t.Errorf("Compile accepted optional literal")
+	}
+}
+
+var nullItems = map[string]interface{}{
+	"items": []interface{}{
+		map[string]interface{}{
+			"id":       "a",
+			"assignee": "joe",
+			"priority": 1.0,
+		},
+		map[string]interface{}{
+			"id":       "b",
+			"assignee": nil,
+			"priority": nil,
+		},
+	},
+}
+
+func TestNullValues(t *testing.T) {
+	tests := []struct {
+		q        string
+		policy   NullPolicy
+		expected string
+		fail     bool
+	}{
+		{q: `items[assignee==null].id`, expected: `"b"`},
+		{q: `items[assignee!=null].id`, expected: `"a"`},
+		{q: `items[assignee!=""].id`, expected: `"a"`},
+		{q: `items[priority<10].id`, fail: true},
+		{
+			q:        `items[assignee!=""].id`,
+			policy:   NullFalse,
+			expected: `"a"`,
+		},
+		{
+			q:        `items[priority<10].id`,
+			policy:   NullFalse,
+			expected: `"a"`,
+		},
+		{
+			q:        `items[assignee!="joe"].id`,
+			policy:   NullEqual,
+			expected: `"b"`,
+		},
+		{
+			q:        `items[assignee==""].id`,
+			policy:   NullEqual,
+			expected: `[]`,
+		},
+		{
+			q:        `items[priority==null].id`,
+			policy:   NullError,
+			expected: `"b"`,
+		},
+		{
+			q:      `items[assignee=="joe"].id`,
+			policy: NullError,
+			fail:   true,
+		},
+	}
+	for _, test := range tests {
+		result, err := Ctx(nullItems, WithNullValues(test.policy)).
+			Select(test.q).MarshalJSON()
+		if test.fail {
+			var typeErr *TypeError
+			if !errors.As(err, &typeErr) || typeErr.Got != "null" {
+				t.Errorf("%s (%s): expected TypeError, got %v",
+					test.q, test.policy, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s (%s): %s", test.q, test.policy, err)
+			continue
+		}
+		if string(result) != test.expected {
+			t.Errorf("%s (%s): got %s, expected %s", test.q, test.policy,
+				result, test.expected)
+		}
+	}
+
+	q, err := Compile(`items[assignee == null && id == "null"]`)
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	if q.q.String() != `items[assignee == null && id == "null"]` {
+		t.Errorf("String: got %s", q.q)
+	}
+	_, err = Compile(`items[null == 1]`)
+	if err == nil {
+		t.Errorf("Compile accepted null field")
+	}
+}
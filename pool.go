@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"sync"
+)
+
+// maxPooledCap limits the capacity of the pooled buffers so that
+// occasional huge evaluations do not pin large buffers in the pools.
+const maxPooledCap = 64 * 1024
+
+var valuesPool = sync.Pool{
+	New: func() interface{} {
+		return new([]interface{})
+	},
+}
+
+var indicesPool = sync.Pool{
+	New: func() interface{} {
+		return new([]int)
+	},
+}
+
+// getValues returns an empty value buffer from the pool.
+func getValues() *[]interface{} {
+	buf := valuesPool.Get().(*[]interface{})
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putValues clears the value buffer and returns it to the pool.
+func putValues(buf *[]interface{}) {
+	if cap(*buf) > maxPooledCap {
+		return
+	}
+	values := *buf
+	for i := range values {
+		values[i] = nil
+	}
+	*buf = values[:0]
+	valuesPool.Put(buf)
+}
+
+// getIndices returns an empty index buffer from the pool.
+func getIndices() *[]int {
+	buf := indicesPool.Get().(*[]int)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putIndices returns the index buffer to the pool.
+func putIndices(buf *[]int) {
+	if cap(*buf) > maxPooledCap {
+		return
+	}
+	*buf = (*buf)[:0]
+	indicesPool.Put(buf)
+}
+
+// copyValues returns a copy of the values with an exact capacity.
+func copyValues(values []interface{}) []interface{} {
+	result := make([]interface{}, len(values))
+	copy(result, values)
+	return result
+}
@@ -7,9 +7,14 @@
 package jsonq
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -19,176 +24,674 @@ var (
 	ErrorOptionalMissing = errors.New("optional element missing")
 )
 
+// Query is a compiled query that can be evaluated against multiple
+// JSON values without re-parsing the query string.
+type Query struct {
+	src  string
+	q    *query
+	x    expr
+	path []string
+	opts *options
+}
+
+// Compile parses the query string q into a Query. The options
+// configure the compilation and the evaluation of the query.
+func Compile(q string, opts ...Option) (*Query, error) {
+	o := newOptions(opts)
+	if o != nil {
+		query, err := o.compile(q)
+		if err != nil {
+			return nil, err
+		}
+		result := *query
+		result.opts = o
+		return &result, nil
+	}
+	parsed, err := parseProgram(q)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDepth(parsed.depth())
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := parsed.(*pathExpr); ok {
+		return newQuery(q, p.q), nil
+	}
+	return newExprQuery(q, parsed), nil
+}
+
+// MustCompile is like Compile but panics if the query can't be
+// parsed. It simplifies the initialization of global variables holding
+// compiled queries.
+func MustCompile(q string, opts ...Option) *Query {
+	query, err := Compile(q, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return query
+}
+
+// Validate checks the syntax of the query q without evaluating it.
+// The syntax errors are returned as *SyntaxError values describing
+// the offending token and the expected input.
+func Validate(q string) error {
+	_, err := Compile(q)
+	return err
+}
+
+// newQuery creates a new Query for the parsed query. If the query is
+// a pure key path, the Query evaluates it with the key path fast path.
+func newQuery(src string, q *query) *Query {
+	var path []string
+	for s := q; s != nil && len(q.typ) == 0; s = s.left {
+		if s.optional || len(s.filters) > 0 {
+			path = nil
+			break
+		}
+		path = append(path, s.key)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	if m := currentMetrics(); m != nil {
+		m.QueryParsed()
+	}
+	return &Query{
+		src:  src,
+		q:    q,
+		path: path,
+	}
+}
+
+// newExprQuery creates a new Query for the parsed expression.
+func newExprQuery(src string, x expr) *Query {
+	if m := currentMetrics(); m != nil {
+		m.QueryParsed()
+	}
+	return &Query{
+		src: src,
+		x:   x,
+	}
+}
+
+// pathQuery returns the query's path query. It returns an error if
+// the query is an expression that does not have a single path.
+func (q *Query) pathQuery() (*query, error) {
+	if q.q == nil {
+		return nil, fmt.Errorf("jsonq: query '%s' is not a path", q.src)
+	}
+	return q.q, nil
+}
+
+// depth returns the depth of the query.
+func (q *Query) depth() int {
+	if q.x != nil {
+		return q.x.depth()
+	}
+	return q.q.depth()
+}
+
+// selects tests if the query selects a list of elements.
+func (q *Query) selects() bool {
+	if q.x != nil {
+		return q.x.selects()
+	}
+	return q.q.selects()
+}
+
+// String returns the source string of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Eval evaluates the query against the argument JSON value.
+// The value can also be a native Go value: the query can traverse Go
+// maps with string keys, structs, and slices. The struct fields are
+// matched by their json tag names. The native Go scalar values are
+// returned as their JSON counterparts, for example, integers as
+// float64 numbers.
+func (q *Query) Eval(value interface{}) (interface{}, error) {
+	return q.eval(nil, value)
+}
+
+// EvalContext evaluates the query like Eval but stops the evaluation
+// when the context is canceled or its deadline expires. In that case
+// EvalContext returns the context's error.
+func (q *Query) EvalContext(ctx context.Context, value interface{}) (
+	interface{}, error) {
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	return q.eval(newEnv(ctx), value)
+}
+
+func (q *Query) eval(e *env, value interface{}) (interface{}, error) {
+	e = e.withOptions(q.opts)
+	if m := currentMetrics(); m != nil && !e.measured() {
+		return q.measure(m, e, value)
+	}
+	v, err := q.evalValue(e, value)
+	if err != nil {
+		return nil, err
+	}
+	if arr, ok := v.([]interface{}); ok {
+		err = e.checkResults(len(arr))
+		if err != nil && q.selects() {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (q *Query) evalValue(e *env, value interface{}) (interface{}, error) {
+	if q.x != nil {
+		v, err := q.x.eval(e, value)
+		if err != nil {
+			return nil, err
+		}
+		return normalize(v), nil
+	}
+	if q.path != nil && !e.tracing() {
+		v, ok := evalPath(q.path, value)
+		if ok {
+			return normalize(v), nil
+		}
+		// Evaluate the query to report the error.
+	}
+	v, err := q.q.eval(e, value)
+	if err != nil {
+		return nil, err
+	}
+	return normalize(v), nil
+}
+
+// evalPath evaluates the key path against the value v. The function
+// returns false if the path does not match v.
+func evalPath(path []string, v interface{}) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if ok {
+			v, ok = m[key]
+			if !ok {
+				return nil, false
+			}
+			continue
+		}
+		child, found, ok := lookup(v, key)
+		if !ok || !found {
+			return nil, false
+		}
+		v = child
+	}
+	return v, true
+}
+
 type query struct {
 	left     *query
 	optional bool
 	key      string
 	filters  []filter
+	typ      string
 }
 
+// String returns the query in the canonical form. The parse function
+// accepts the returned string back and produces an equivalent query.
 func (q *query) String() string {
-	var str, opt string
-	if q.optional {
-		opt = "?"
-	}
-	if q.left != nil {
-		str = fmt.Sprintf("%s.%s%q", q.left.String(), opt, q.key)
-	} else {
-		str = fmt.Sprintf("%s%q", opt, q.key)
+	return q.format()
+}
+
+// appendSegments appends the query's path segments from the root to
+// the last segment to dst.
+func (q *query) appendSegments(dst []*query) []*query {
+	start := len(dst)
+	for s := q; s != nil; s = s.left {
+		dst = append(dst, s)
 	}
-	for _, f := range q.filters {
-		str += fmt.Sprintf("[%s]", f.String())
+	for i, j := start, len(dst)-1; i < j; i, j = i+1, j-1 {
+		dst[i], dst[j] = dst[j], dst[i]
 	}
-	return str
+	return dst
 }
 
 type filter interface {
 	String() string
-	Eval(index int, v interface{}) (bool, error)
+	Eval(e *env, index int, v interface{}) (bool, error)
+}
+
+// selects tests if the query selects a list of elements, that is, if
+// the query or any of its left segments have filters.
+func (q *query) selects() bool {
+	for ; q != nil; q = q.left {
+		if len(q.filters) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (q *query) Eval(v interface{}) (interface{}, error) {
+	return q.eval(nil, v)
+}
+
+// eval evaluates the query segments iteratively from the root to the
+// last segment so that long queries do not consume stack.
+func (q *query) eval(e *env, v interface{}) (interface{}, error) {
+	var buf [16]*query
+	var selected bool
 	var err error
 
-	if q.left != nil {
-		v, err = q.left.Eval(v)
+	for _, s := range q.appendSegments(buf[:0]) {
+		if selected {
+			v, err = s.flatten(e, v.([]interface{}))
+		} else {
+			v, err = s.evalSegment(e, v)
+			selected = len(s.filters) > 0
+		}
+		if err == nil && selected {
+			err = e.checkResults(len(v.([]interface{})))
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
+	if len(q.typ) > 0 {
+		if selected {
+			for _, item := range v.([]interface{}) {
+				err = q.checkType(item)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			err = q.checkType(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
 
-	// Select by key.
-	m, ok := v.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("jsonq: query '%s' can't index %T", q, v)
+// flatten evaluates the segment for each item of the previous
+// segments' selection and flattens the results. The selection is a
+// fresh slice so it is recycled after flattening.
+func (q *query) flatten(e *env, items []interface{}) (interface{}, error) {
+	buf := getValues()
+	values := *buf
+	for _, item := range items {
+		err := e.check()
+		if err != nil {
+			*buf = values
+			putValues(buf)
+			return nil, err
+		}
+		child, err := q.child(e, item)
+		if err == ErrorOptionalMissing {
+			continue
+		}
+		if err == nil {
+			if len(q.filters) > 0 {
+				values, err = q.appendMatches(e, values, child)
+			} else {
+				values = append(values, child)
+			}
+		}
+		if err != nil {
+			*buf = values
+			putValues(buf)
+			return nil, err
+		}
+	}
+	result := copyValues(values)
+	*buf = values
+	putValues(buf)
+	putValues(&items)
+
+	return result, nil
+}
+
+// evalSegment evaluates the query's key and filters against the
+// value v.
+func (q *query) evalSegment(e *env, v interface{}) (interface{}, error) {
+	child, err := q.child(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.filters) == 0 {
+		return child, nil
 	}
-	child, ok := m[q.key]
+	return q.appendMatches(e, nil, child)
+}
+
+// child selects the query's key from the value v.
+func (q *query) child(e *env, v interface{}) (interface{}, error) {
+	child, err := q.lookupChild(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if f := q.keyFilter(); f != nil {
+		m, keys, err := q.matchKeys(f, child)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, m[key])
+		}
+		child = values
+	}
+	e.traceSegment(q, child)
+	return child, nil
+}
+
+// lookupChild looks up the query's key from the value v.
+func (q *query) lookupChild(e *env, v interface{}) (interface{}, error) {
+	child, found, ok := e.lookup(v, q.key)
 	if !ok {
+		return nil, q.indexError(v)
+	}
+	if !found {
 		if q.optional {
 			return nil, ErrorOptionalMissing
 		}
-		return nil, fmt.Errorf("jsonq: element '%s' not found", q)
+		return nil, q.notFoundError(v)
 	}
-	v = child
+	return child, nil
+}
+
+// matchKeys returns the object v and its keys that match the key
+// filter f.
+func (q *query) matchKeys(f *keyFilter, v interface{}) (
+	map[string]interface{}, []string, error) {
 
+	m, ok := normalize(v).(map[string]interface{})
+	if !ok {
+		return nil, nil, &TypeError{
+			Query: q.String(),
+			Want:  "object",
+			Got:   typeName(v),
+		}
+	}
+	return m, f.keys(m), nil
+}
+
+// keyFilter returns the segment's key filter or nil if the segment
+// does not start with a key filter.
+func (q *query) keyFilter() *keyFilter {
 	if len(q.filters) == 0 {
-		return v, nil
+		return nil
 	}
+	f, _ := q.filters[0].(*keyFilter)
+	return f
+}
 
-	var result []interface{}
-	arr, ok := v.([]interface{})
-	if ok {
-		result = arr
-	} else {
-		result = []interface{}{v}
+// appendMatches applies the query filters to the value v and appends
+// the matching elements to dst. If dst is nil, the function allocates
+// a new slice for the matches.
+func (q *query) appendMatches(e *env, dst []interface{}, v interface{}) (
+	[]interface{}, error) {
+
+	items, ok := arrayValue(v)
+	if !ok {
+		items = []interface{}{v}
+	}
+	buf := getIndices()
+	indices, err := q.filterIndices(e, items, *buf)
+	if err != nil {
+		putIndices(buf)
+		return nil, err
+	}
+	if dst == nil {
+		dst = make([]interface{}, 0, len(indices))
+	}
+	for _, idx := range indices {
+		dst = append(dst, items[idx])
 	}
+	*buf = indices
+	putIndices(buf)
 
-	for _, filter := range q.filters {
-		var filtered []interface{}
+	return dst, nil
+}
 
-		for idx, item := range result {
-			ok, err := filter.Eval(idx, item)
-			if err != nil {
-				return nil, err
-			}
-			if ok {
-				filtered = append(filtered, item)
-			}
-		}
+func (q *query) indexError(v interface{}) error {
+	return &TypeError{
+		Query: q.String(),
+		Want:  "object",
+		Got:   typeName(v),
+	}
+}
 
-		result = filtered
+// notFoundError creates an error for the query's key missing from
+// the object value v.
+func (q *query) notFoundError(v interface{}) error {
+	var parent string
+	if q.left != nil {
+		parent = q.left.String()
+	}
+	return &notFound{
+		query:  q.String(),
+		key:    q.key,
+		parent: parent,
+		object: v,
+	}
+}
+
+// filterIndices applies the query filters to the items and appends
+// the indices of the matching items to indices.
+func (q *query) filterIndices(e *env, items []interface{}, indices []int) (
+	[]int, error) {
+
+	in := q.positions(e, items)
+	for {
+		pos, ok, err := in.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return indices, nil
+		}
+		indices = append(indices, pos)
 	}
-	return result, nil
 }
 
+// parse parses the path query q.
 func parse(q string) (*query, error) {
-	return parseQuery(newLexer(q))
+	parsed, err := parseProgram(q)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := parsed.(*pathExpr)
+	if !ok {
+		return nil, fmt.Errorf("jsonq: query '%s' is not a path", q)
+	}
+	return p.q, nil
 }
 
-func parseQuery(lexer *lexer) (*query, error) {
+// parsePath parses a path query with an optional type assertion.
+func parsePath(lexer *lexer) (*query, error) {
+	query, err := parseQuery(lexer)
+	if err != nil {
+		return nil, err
+	}
 	t, err := lexer.Get()
+	if err != nil {
+		if err == io.EOF {
+			return query, nil
+		}
+		return nil, err
+	}
+	if t.Type != tColonColon {
+		lexer.Unget(t)
+		return query, nil
+	}
+	t, err = lexer.Expect("type name")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tString || !validType(t.StrVal) {
+		return nil, lexer.SyntaxError("type name")
+	}
+	query.typ = t.StrVal
+	return query, nil
+}
+
+func parseQuery(lexer *lexer) (*query, error) {
+	t, err := lexer.Expect("key")
 	if err != nil {
 		return nil, err
 	}
 	var optional bool
 	if t.Type == tQuestionMark {
 		optional = true
-		t, err = lexer.Get()
+		t, err = lexer.Expect("key")
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if t.Type != tString {
-		return nil, lexer.SyntaxError()
+		return nil, lexer.SyntaxError("key")
 	}
 	q := &query{
 		optional: optional,
 		key:      t.StrVal,
 	}
+	lexer.segments++
 	for {
 		t, err = lexer.Get()
 		if err != nil {
 			if err != io.EOF {
 				return nil, err
 			}
-			break
-		}
-		if t.Type != tDot {
-			lexer.Unget(t)
-			break
-		}
-		t, err = lexer.Get()
-		if err != nil {
-			return nil, err
-		}
-		if t.Type != tString {
-			return nil, lexer.SyntaxError()
+			return q, nil
 		}
-		q = &query{
-			left: q,
-			key:  t.StrVal,
-		}
-	}
+		switch t.Type {
+		case tDot:
+			saved := *lexer
+			t, err = lexer.Expect("key")
+			if err != nil {
+				return nil, err
+			}
+			if isSelector(lexer, t) {
+				// The selector call ends the query.
+				*lexer = saved
+				lexer.Unget(token{Type: tDot})
+				return q, nil
+			}
+			optional = false
+			if t.Type == tQuestionMark {
+				optional = true
+				t, err = lexer.Expect("key")
+				if err != nil {
+					return nil, err
+				}
+			}
+			if t.Type != tString {
+				return nil, lexer.SyntaxError("key")
+			}
+			q = &query{
+				left:     q,
+				optional: optional,
+				key:      t.StrVal,
+			}
+			lexer.segments++
 
-	// Filters.
-	for {
-		t, err = lexer.Get()
-		if err != nil {
-			if err == io.EOF {
-				break
+		case tLBracket:
+			t, err = lexer.Expect("filter or ']'")
+			if err != nil {
+				return nil, err
 			}
-			return nil, err
-		}
-		if t.Type != tLBracket {
-			return nil, lexer.SyntaxError()
-		}
-		filter, err := parseLogical(lexer)
-		if err != nil {
-			return nil, err
+			lexer.filters++
+			if t.Type == tRBracket {
+				q.filters = append(q.filters, &all{})
+				continue
+			}
+			lexer.Unget(t)
+			var filter filter
+			if len(q.filters) == 0 {
+				filter, err = parseKeyFilter(lexer)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if filter == nil {
+				filter, err = parseLogical(lexer)
+				if err != nil {
+					return nil, err
+				}
+			}
+			q.filters = append(q.filters, filter)
+
+		default:
+			lexer.Unget(t)
+			return q, nil
 		}
-		q.filters = append(q.filters, filter)
 	}
+}
 
-	return q, nil
+// parseKeyFilter parses the key pattern filter key=~"pattern". The
+// function returns nil if the filter is not a key filter.
+func parseKeyFilter(lexer *lexer) (filter, error) {
+	saved := *lexer
+	t, err := lexer.Get()
+	if err != nil || t.Type != tString || t.Quoted || t.StrVal != "key" {
+		*lexer = saved
+		return nil, nil
+	}
+	t, err = lexer.Get()
+	if err != nil || t.Type != tMatch {
+		*lexer = saved
+		return nil, nil
+	}
+	t, err = lexer.Expect("pattern")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tString || !t.Quoted {
+		return nil, lexer.SyntaxError("pattern")
+	}
+	re, err := regexp.Compile(t.StrVal)
+	if err != nil {
+		return nil, fmt.Errorf("jsonq: invalid key pattern %q: %s",
+			t.StrVal, err)
+	}
+	t, err = lexer.Expect("']'")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tRBracket {
+		return nil, lexer.SyntaxError("']'")
+	}
+	return &keyFilter{
+		pattern: re,
+	}, nil
 }
 
 func parseLogical(lexer *lexer) (filter, error) {
-	left, err := parseComparative(lexer)
+	return parseExpr(lexer, token{Type: tRBracket})
+}
+
+// parseExpr parses a logical expression that ends with the end token.
+func parseExpr(lexer *lexer, end token) (filter, error) {
+	expected := fmt.Sprintf("'&&', '||', or '%s'", end)
+	left, err := parseOperand(lexer)
 	if err != nil {
 		return nil, err
 	}
 	for {
-		t, err := lexer.Get()
+		t, err := lexer.Expect(expected)
 		if err != nil {
 			return nil, err
 		}
-		switch t.Type {
-		case tRBracket:
+		if t.is(end) {
 			return left, nil
-
+		}
+		switch t.Type {
 		case tAnd, tOr:
-			right, err := parseComparative(lexer)
+			right, err := parseOperand(lexer)
 			if err != nil {
 				return nil, err
 			}
@@ -199,26 +702,63 @@ func parseLogical(lexer *lexer) (filter, error) {
 			}
 
 		default:
-			return nil, lexer.SyntaxError()
+			return nil, lexer.SyntaxError(expected)
 		}
 	}
 }
 
+// parseOperand parses an operand of a logical expression. The
+// operand is a comparison or a parenthesized logical expression.
+func parseOperand(lexer *lexer) (filter, error) {
+	t, err := lexer.Expect("field, string, integer, or '('")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == tLParen {
+		err = lexer.Nest()
+		if err != nil {
+			return nil, err
+		}
+		defer lexer.Unnest()
+		return parseExpr(lexer, token{Type: tRParen})
+	}
+	lexer.Unget(t)
+	return parseComparative(lexer)
+}
+
 func parseComparative(lexer *lexer) (filter, error) {
-	left, err := parseAtom(lexer)
+	left, err := parseFieldPath(lexer)
 	if err != nil {
 		return nil, err
 	}
-	t, err := lexer.Get()
+	if left == nil {
+		left, err = parseAtom(lexer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if left.Type == tNull || left.Type == tVariable {
+		return nil, lexer.SyntaxError("field or integer")
+	}
+	t, err := lexer.Expect("comparison operator or ']'")
 	if err != nil {
 		return nil, err
 	}
 	switch t.Type {
+	case tAssign:
+		return nil, lexer.SyntaxError("'=='")
+
+	case tMatch:
+		return nil, lexer.SyntaxError("comparison operator")
+
 	case tEq, tNeq, tLt, tLe, tGt, tGe:
 		right, err := parseAtom(lexer)
 		if err != nil {
 			return nil, err
 		}
+		if right.Optional {
+			return nil, lexer.SyntaxError("string, integer, null, or variable")
+		}
 		return &comparative{
 			Left:  left,
 			Op:    t.Type,
@@ -227,6 +767,10 @@ func parseComparative(lexer *lexer) (filter, error) {
 
 	default:
 		lexer.Unget(t)
+		if left.BigVal != nil {
+			return nil, fmt.Errorf("jsonq: array index %s out of range",
+				left.BigVal)
+		}
 		return &comparative{
 			Left: left,
 			Op:   left.Type,
@@ -234,13 +778,67 @@ func parseComparative(lexer *lexer) (filter, error) {
 	}
 }
 
-func parseAtom(lexer *lexer) (*atom, error) {
+// parseFieldPath parses the left operand of a comparison that
+// continues as a path after the field, for example, fields.count. The
+// path is evaluated against the compared value. The function returns
+// nil if the operand is not a path.
+func parseFieldPath(lexer *lexer) (*atom, error) {
+	saved := *lexer
 	t, err := lexer.Get()
+	if err != nil || t.Type != tString || t.Quoted || t.StrVal == "null" ||
+		!continuesPath(lexer, false) {
+		*lexer = saved
+		return nil, nil
+	}
+	*lexer = saved
+	q, err := parsePath(lexer)
+	if err != nil {
+		return nil, err
+	}
+	return &atom{
+		Type: tExpr,
+		Expr: &pathExpr{
+			q: q,
+		},
+	}, nil
+}
+
+func parseAtom(lexer *lexer) (*atom, error) {
+	t, err := lexer.Expect("field, string, or integer")
 	if err != nil {
 		return nil, err
 	}
+	if t.Type == tQuestionMark {
+		t, err = lexer.Expect("field")
+		if err != nil {
+			return nil, err
+		}
+		if t.Type != tString {
+			return nil, lexer.SyntaxError("field")
+		}
+		return &atom{
+			Type:     t.Type,
+			StrVal:   t.StrVal,
+			Optional: true,
+		}, nil
+	}
 	switch t.Type {
 	case tString:
+		if !t.Quoted && isCall(lexer) {
+			call, err := parseCall(lexer, t.StrVal)
+			if err != nil {
+				return nil, err
+			}
+			return &atom{
+				Type: tExpr,
+				Expr: call,
+			}, nil
+		}
+		if t.StrVal == "null" && !t.Quoted {
+			return &atom{
+				Type: tNull,
+			}, nil
+		}
 		return &atom{
 			Type:   t.Type,
 			StrVal: t.StrVal,
@@ -250,13 +848,65 @@ func parseAtom(lexer *lexer) (*atom, error) {
 		return &atom{
 			Type:   t.Type,
 			IntVal: t.Int,
+			BigVal: t.Big,
+		}, nil
+
+	case tVariable:
+		if !lexer.Defined(t.StrVal) {
+			return nil, lexer.SyntaxError("defined variable")
+		}
+		return &atom{
+			Type:   t.Type,
+			StrVal: t.StrVal,
 		}, nil
 
 	default:
-		return nil, lexer.SyntaxError()
+		return nil, lexer.SyntaxError("field, string, or integer")
 	}
 }
 
+// all is a filter that matches all elements.
+type all struct {
+}
+
+func (ast *all) String() string {
+	return ""
+}
+
+func (ast *all) Eval(e *env, idx int, v interface{}) (bool, error) {
+	return true, nil
+}
+
+// keyFilter selects the values of an object's entries whose keys
+// match the pattern. The filter is applied when the segment selects
+// the object so the filter matches all the selected values.
+type keyFilter struct {
+	pattern *regexp.Regexp
+}
+
+func (ast *keyFilter) String() string {
+	var sb strings.Builder
+	sb.WriteString("key =~ ")
+	formatString(&sb, ast.pattern.String())
+	return sb.String()
+}
+
+func (ast *keyFilter) Eval(e *env, idx int, v interface{}) (bool, error) {
+	return true, nil
+}
+
+// keys returns the keys of the object v that match the pattern, in
+// sorted order.
+func (ast *keyFilter) keys(m map[string]interface{}) []string {
+	var result []string
+	for _, key := range sortedKeys(m) {
+		if ast.pattern.MatchString(key) {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
 type logical struct {
 	Left  filter
 	Op    tokenType
@@ -264,28 +914,42 @@ type logical struct {
 }
 
 func (ast *logical) String() string {
-	return fmt.Sprintf("%s%s%s", ast.Left, ast.Op, ast.Right)
+	return filterString(ast)
 }
 
-func (ast *logical) Eval(idx int, v interface{}) (bool, error) {
-	lVal, err := ast.Left.Eval(idx, v)
-	if err != nil {
-		return false, err
-	}
-	rVal, err := ast.Right.Eval(idx, v)
+func (ast *logical) Eval(e *env, idx int, v interface{}) (bool, error) {
+	lVal, err := evalOperand(e, ast.Left, idx, v)
 	if err != nil {
 		return false, err
 	}
 	switch ast.Op {
 	case tAnd:
-		return lVal && rVal, nil
+		if !lVal {
+			return false, nil
+		}
 
 	case tOr:
-		return lVal || rVal, nil
+		if lVal {
+			return true, nil
+		}
 
 	default:
 		return false, fmt.Errorf("invalid logical operation %s", ast.Op)
 	}
+	return evalOperand(e, ast.Right, idx, v)
+}
+
+// evalOperand evaluates the logical operation's operand. The
+// operands referencing missing fields evaluate to false.
+func evalOperand(e *env, f filter, idx int, v interface{}) (bool, error) {
+	val, err := f.Eval(e, idx, v)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && e.missingPolicy() != MissingError {
+			return false, nil
+		}
+		return false, err
+	}
+	return val, nil
 }
 
 type comparative struct {
@@ -295,150 +959,109 @@ type comparative struct {
 }
 
 func (ast *comparative) String() string {
-	return fmt.Sprintf("%s%s%s", ast.Left, ast.Op, ast.Right)
+	return filterString(ast)
 }
 
-func (ast *comparative) Eval(idx int, v interface{}) (bool, error) {
-	switch ast.Op {
-	case tEq:
-		switch ast.Right.Type {
-		case tString:
-			val, err := ast.Left.GetStringField(v)
-			if err != nil {
-				return false, err
-			}
-			return val == ast.Right.StrVal, nil
-
-		case tInt:
-			val, err := ast.Left.GetIntField(v)
-			if err != nil {
-				return false, err
-			}
-			return val == ast.Right.IntVal, nil
+func (ast *comparative) Eval(e *env, idx int, v interface{}) (bool, error) {
+	match, err := ast.eval(e, idx, v)
+	if err != nil && errors.Is(err, ErrNotFound) {
+		return ast.missing(e, err)
+	}
+	return match, err
+}
 
-		default:
-			return false, fmt.Errorf("%s not implemented for %s", ast.Op,
-				ast.Right.Type)
+func (ast *comparative) eval(e *env, idx int, v interface{}) (bool, error) {
+	if ast.Op == tInt {
+		return idx == ast.Left.IntVal, nil
+	}
+	val, err := ast.Left.GetField(e, v)
+	if err != nil {
+		return false, err
+	}
+	if ast.Right == nil {
+		return truthy(val), nil
+	}
+	right, err := ast.Right.literal(e, v)
+	if err != nil {
+		return false, err
+	}
+	cmp := e.comparator()
+	if cmp != nil {
+		result, ok := cmp(val, right)
+		if ok {
+			return compareResult(ast.Op, result)
 		}
-
-	case tNeq:
-		switch ast.Right.Type {
-		case tString:
-			val, err := ast.Left.GetStringField(v)
-			if err != nil {
-				return false, err
-			}
-			return val != ast.Right.StrVal, nil
-
-		case tInt:
-			val, err := ast.Left.GetIntField(v)
-			if err != nil {
-				return false, err
-			}
-			return val != ast.Right.IntVal, nil
-
-		default:
-			return false, fmt.Errorf("%s not implemented for %s", ast.Op,
-				ast.Right.Type)
+	}
+	if val == nil || right == nil {
+		match, ok, err := ast.compareNull(e, val, right)
+		if ok || err != nil {
+			return match, err
 		}
-
-	case tLt:
-		switch ast.Right.Type {
-		case tString:
-			val, err := ast.Left.GetStringField(v)
-			if err != nil {
-				return false, err
-			}
-			return strings.Compare(val, ast.Right.StrVal) < 0, nil
-
-		case tInt:
-			val, err := ast.Left.GetIntField(v)
-			if err != nil {
-				return false, err
-			}
-			return val < ast.Right.IntVal, nil
-
-		default:
-			return false, fmt.Errorf("%s not implemented for %s", ast.Op,
-				ast.Right.Type)
+	}
+	switch r := right.(type) {
+	case string:
+		str, ok := e.options().stringValue(val)
+		if !ok {
+			return false, ast.Left.typeError("string", val)
 		}
+		return compareResult(ast.Op, strings.Compare(str, r))
 
-	case tLe:
-		switch ast.Right.Type {
-		case tString:
-			val, err := ast.Left.GetStringField(v)
-			if err != nil {
-				return false, err
-			}
-			return strings.Compare(val, ast.Right.StrVal) <= 0, nil
-
-		case tInt:
-			val, err := ast.Left.GetIntField(v)
-			if err != nil {
-				return false, err
-			}
-			return val <= ast.Right.IntVal, nil
-
-		default:
-			return false, fmt.Errorf("%s not implemented for %s", ast.Op,
-				ast.Right.Type)
+	case bool:
+		b, ok := e.options().boolValue(val)
+		if !ok {
+			return false, ast.Left.typeError("bool", val)
 		}
-
-	case tGt:
-		switch ast.Right.Type {
-		case tString:
-			val, err := ast.Left.GetStringField(v)
-			if err != nil {
-				return false, err
-			}
-			return strings.Compare(val, ast.Right.StrVal) > 0, nil
-
-		case tInt:
-			val, err := ast.Left.GetIntField(v)
-			if err != nil {
-				return false, err
-			}
-			return val > ast.Right.IntVal, nil
-
-		default:
-			return false, fmt.Errorf("%s not implemented for %s", ast.Op,
-				ast.Right.Type)
+		return compareResult(ast.Op, compareBools(b, r))
+	}
+	var rnum number
+	if ast.Right.Type == tInt {
+		rnum = ast.Right.number()
+	} else {
+		var ok bool
+		rnum, ok = toNumber(right)
+		if !ok {
+			return false, fmt.Errorf("jsonq: %s not supported for %s",
+				ast.Op, typeName(right))
 		}
+	}
+	num, ok := e.options().exactNumber(val)
+	if !ok {
+		return false, ast.Left.typeError("number", val)
+	}
+	return compareResult(ast.Op, num.cmp(rnum))
+}
 
-	case tGe:
-		switch ast.Right.Type {
-		case tString:
-			val, err := ast.Left.GetStringField(v)
-			if err != nil {
-				return false, err
-			}
-			return strings.Compare(val, ast.Right.StrVal) >= 0, nil
+// truthy tests if the value v is true in a boolean context. All
+// values except null and false are true.
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
 
-		case tInt:
-			val, err := ast.Left.GetIntField(v)
-			if err != nil {
-				return false, err
-			}
-			return val >= ast.Right.IntVal, nil
+// compareBools compares the boolean values, ordering false before
+// true.
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
 
-		default:
-			return false, fmt.Errorf("%s not implemented for %s", ast.Op,
-				ast.Right.Type)
-		}
-
-	case tInt:
-		return idx == ast.Left.IntVal, nil
+	case !a:
+		return -1
 
 	default:
-		return false, fmt.Errorf("Comparative.Eval %s not implemented yet",
-			ast.Op)
+		return 1
 	}
 }
 
+// atom is a filter operand. The integer atoms that do not fit into
+// int hold their value in BigVal. The function call operands hold
+// their call expression in Expr.
 type atom struct {
-	Type   tokenType
-	StrVal string
-	IntVal int
+	Type     tokenType
+	StrVal   string
+	IntVal   int
+	BigVal   *big.Int
+	Optional bool
+	Expr     expr
 }
 
 func (a *atom) String() string {
@@ -447,7 +1070,16 @@ func (a *atom) String() string {
 		return fmt.Sprintf("%q", a.StrVal)
 
 	case tInt:
-		return fmt.Sprintf("%v", a.IntVal)
+		return a.intString()
+
+	case tNull:
+		return "null"
+
+	case tVariable:
+		return "$" + a.StrVal
+
+	case tExpr:
+		return exprString(a.Expr)
 
 	default:
 		return fmt.Sprintf("{atom %d}", a.Type)
@@ -464,18 +1096,91 @@ func (a *atom) GetString() (string, error) {
 	}
 }
 
-func (a *atom) GetStringField(value interface{}) (string, error) {
-	field, err := a.GetString()
-	if err != nil {
-		return "", err
+// Value returns the atom's value as a JSON value.
+func (a *atom) Value() interface{} {
+	switch a.Type {
+	case tString:
+		return a.StrVal
+
+	case tInt:
+		if a.BigVal != nil {
+			return json.Number(a.BigVal.String())
+		}
+		return float64(a.IntVal)
+
+	default:
+		return nil
 	}
-	return GetString(value, field)
 }
 
-func (a *atom) GetIntField(value interface{}) (int, error) {
+// literal returns the value of the comparison's literal operand. The
+// variables are resolved from the evaluation environment and the
+// function calls are evaluated against the value v.
+func (a *atom) literal(e *env, v interface{}) (interface{}, error) {
+	switch a.Type {
+	case tVariable:
+		val, ok := e.variable(a.StrVal)
+		if !ok {
+			return nil, fmt.Errorf("jsonq: variable $%s is not bound",
+				a.StrVal)
+		}
+		return val, nil
+
+	case tExpr:
+		return a.GetField(e, v)
+
+	default:
+		return a.Value(), nil
+	}
+}
+
+// intString returns the integer atom's value as a string.
+func (a *atom) intString() string {
+	if a.BigVal != nil {
+		return a.BigVal.String()
+	}
+	return strconv.Itoa(a.IntVal)
+}
+
+// number returns the integer atom's value as a number.
+func (a *atom) number() number {
+	if a.BigVal != nil {
+		return bigNumber(new(big.Float).SetInt(a.BigVal))
+	}
+	return intNumber(int64(a.IntVal))
+}
+
+// GetField gets the value of the field that the atom names. For the
+// function call operands, GetField returns the value of the call.
+func (a *atom) GetField(e *env, value interface{}) (interface{}, error) {
+	if a.Type == tExpr {
+		v, err := a.Expr.eval(e, value)
+		if err != nil {
+			return nil, err
+		}
+		return normalize(v), nil
+	}
 	field, err := a.GetString()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	query, err := e.compile(field)
+	if err != nil {
+		return nil, err
+	}
+	return query.eval(e, value)
+}
+
+// typeError creates a type error for the value v of the field that
+// the atom names.
+func (a *atom) typeError(want string, v interface{}) error {
+	query := a.StrVal
+	if a.Type == tExpr {
+		query = a.String()
+	}
+	return &TypeError{
+		Query: query,
+		Want:  want,
+		Got:   typeName(v),
 	}
-	return GetInt(value, field)
 }
@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+var pathTests = []struct {
+	q        string
+	expected string
+}{
+	{`issue.changelog.items[fieldId=="assignee"].toString`,
+		`["Veijo Linux","Milton Waddams"]`},
+	{`issue.changelog.items[].fieldId`,
+		`["status","assignee","assignee"]`},
+	{`issue.changelog.items[priority==10][1].fromString`,
+		`["Veijo Linux"]`},
+	{`issue.changelog.items[].?missing`, `[]`},
+}
+
+func TestPathAfterFilters(t *testing.T) {
+	v := parseAssign(t)
+
+	for _, test := range pathTests {
+		data, err := GetJSON(v, test.q)
+		if err != nil {
+			t.Fatalf("GetJSON(%s) failed: %s", test.q, err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.q, data, test.expected)
+		}
+	}
+
+	err := Set(v, `issue.changelog.items[fieldId=="assignee"].reviewed`, true)
+	if err != nil {
+		t.Fatalf("Set failed: %s", err)
+	}
+	data, err := GetJSON(v, `issue.changelog.items[].?reviewed`)
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	if string(data) != `[true,true]` {
+		t.Errorf("Set: got %s", data)
+	}
+	w, err := DeleteCopy(v, `issue.changelog.items[].reviewed`)
+	if err == nil {
+		t.Errorf("DeleteCopy of missing element succeeded")
+	}
+	w, err = DeleteCopy(v, `issue.changelog.items[fieldId=="assignee"].reviewed`)
+	if err != nil {
+		t.Fatalf("DeleteCopy failed: %s", err)
+	}
+	data, err = GetJSON(w, `issue.changelog.items[].?reviewed`)
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	if string(data) != `[]` {
+		t.Errorf("DeleteCopy: got %s", data)
+	}
+	data, err = GetJSON(v, `issue.changelog.items[].?reviewed`)
+	if err != nil {
+		t.Fatalf("GetJSON failed: %s", err)
+	}
+	if string(data) != `[true,true]` {
+		t.Errorf("DeleteCopy modified original: %s", data)
+	}
+}
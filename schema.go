@@ -0,0 +1,178 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes the structure of a JSON document. The schema of
+// an array describes all elements of the array so the object fields
+// that are missing from some elements are optional.
+type Schema struct {
+	// Types lists the JSON types of the values in sorted order:
+	// array, bool, null, number, object, and string.
+	Types []string
+	// Optional tells if the value is missing from some of the
+	// objects that the schema describes.
+	Optional bool
+	// Fields describes the fields of object values.
+	Fields map[string]*Schema
+	// Items describes the elements of array values.
+	Items *Schema
+
+	count   int
+	objects int
+}
+
+// InferSchema walks the document v and infers its structural schema.
+func InferSchema(v interface{}) *Schema {
+	s := new(Schema)
+	s.add(v)
+	s.finalize()
+	return s
+}
+
+func (s *Schema) add(v interface{}) {
+	s.count++
+	v = normalize(v)
+
+	name := typeName(v)
+	if name == "int" {
+		name = "number"
+	}
+	s.addType(name)
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		s.objects++
+		if s.Fields == nil {
+			s.Fields = make(map[string]*Schema)
+		}
+		for key, child := range val {
+			field, ok := s.Fields[key]
+			if !ok {
+				field = new(Schema)
+				s.Fields[key] = field
+			}
+			field.add(child)
+		}
+
+	default:
+		arr, ok := arrayValue(v)
+		if !ok {
+			return
+		}
+		if s.Items == nil {
+			s.Items = new(Schema)
+		}
+		for _, item := range arr {
+			s.Items.add(item)
+		}
+	}
+}
+
+func (s *Schema) addType(name string) {
+	idx := sort.SearchStrings(s.Types, name)
+	if idx < len(s.Types) && s.Types[idx] == name {
+		return
+	}
+	s.Types = append(s.Types, "")
+	copy(s.Types[idx+1:], s.Types[idx:])
+	s.Types[idx] = name
+}
+
+// finalize marks the fields missing from some of the objects
+// optional.
+func (s *Schema) finalize() {
+	for _, field := range s.Fields {
+		field.Optional = field.count < s.objects
+		field.finalize()
+	}
+	if s.Items != nil {
+		s.Items.finalize()
+	}
+}
+
+// Paths returns the leaf paths of the schema in jsonq syntax. The
+// array elements are marked with the empty filter [], for example,
+// issue.changelog.items[].fieldId. The paths are sorted.
+func (s *Schema) Paths() []string {
+	var result []string
+	s.paths("", &result)
+	sort.Strings(result)
+	return result
+}
+
+func (s *Schema) paths(prefix string, result *[]string) {
+	if len(prefix) > 0 && s.leaf() {
+		*result = append(*result, prefix)
+	}
+	for key, field := range s.Fields {
+		path := QuoteKey(key)
+		if len(prefix) > 0 {
+			path = prefix + "." + path
+		}
+		field.paths(path, result)
+	}
+	if s.Items != nil {
+		s.Items.paths(prefix+"[]", result)
+	}
+}
+
+// leaf tests if the schema describes scalar values or empty
+// containers.
+func (s *Schema) leaf() bool {
+	for _, t := range s.Types {
+		switch t {
+		case "object":
+			if len(s.Fields) == 0 {
+				return true
+			}
+		case "array":
+			if s.Items == nil || s.Items.count == 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the schema as an indented tree of fields.
+func (s *Schema) String() string {
+	var sb strings.Builder
+	s.describe(&sb, "", 0)
+	return sb.String()
+}
+
+func (s *Schema) describe(sb *strings.Builder, name string, indent int) {
+	if len(name) > 0 {
+		fmt.Fprintf(sb, "%s%s: ", strings.Repeat("  ", indent), name)
+		indent++
+	}
+	sb.WriteString(strings.Join(s.Types, "|"))
+	if s.Optional {
+		sb.WriteString(" (optional)")
+	}
+	sb.WriteString("\n")
+
+	var keys []string
+	for key := range s.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.Fields[key].describe(sb, QuoteKey(key), indent)
+	}
+	if s.Items != nil && s.Items.count > 0 {
+		s.Items.describe(sb, "[]", indent)
+	}
+}
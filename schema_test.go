@@ -0,0 +1,63 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	v := unmarshal(t, `{
+  "name": "x",
+  "items": [
+    {"id": 1, "tags": ["a", "b"], "note": null},
+    {"id": 2.5, "tags": [], "note": "n", "extra": {"deep": true}}
+  ],
+  "empty": {},
+  "first name": "y"
+}`)
+	schema := InferSchema(v)
+
+	expected := `object
+empty: object
+"first name": string
+items: array
+  []: object
+    extra: object (optional)
+      deep: bool
+    id: number
+    note: null|string
+    tags: array
+      []: string
+name: string
+`
+	if schema.String() != expected {
+		t.Errorf("String: got\n%s\nexpected\n%s", schema, expected)
+	}
+
+	paths := []string{
+		`"first name"`,
+		"empty",
+		"items[].extra.deep",
+		"items[].id",
+		"items[].note",
+		"items[].tags[]",
+		"name",
+	}
+	if !reflect.DeepEqual(schema.Paths(), paths) {
+		t.Errorf("Paths: got %q, expected %q", schema.Paths(), paths)
+	}
+	for _, path := range paths {
+		if _, err := Compile(path); err != nil {
+			t.Errorf("Compile(%s) failed: %s", path, err)
+		}
+	}
+	if schema.Fields["items"].Items.Fields["extra"].Optional != true {
+		t.Errorf("extra not optional")
+	}
+}
@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"strconv"
+	"strings"
+)
+
+type setOp int
+
+const (
+	setUnion setOp = iota
+	setIntersect
+	setExcept
+)
+
+// Union combines the current selection with the selection of the
+// other context. The result contains the distinct elements of the
+// current selection followed by the elements of the other selection
+// that are not in the current selection. If the query by is empty,
+// the elements are compared by deep equality. Otherwise, they are
+// compared by the values of the query by, evaluated on each element.
+// Elements missing an optional key are compared as null.
+func (ctx *Context) Union(other *Context, by string) *Context {
+	return ctx.combine(other, by, setUnion)
+}
+
+// Intersect keeps the distinct elements of the current selection that
+// are also in the selection of the other context. See Union for
+// details about the comparison of the elements.
+func (ctx *Context) Intersect(other *Context, by string) *Context {
+	return ctx.combine(other, by, setIntersect)
+}
+
+// Except keeps the distinct elements of the current selection that
+// are not in the selection of the other context. See Union for
+// details about the comparison of the elements.
+func (ctx *Context) Except(other *Context, by string) *Context {
+	return ctx.combine(other, by, setExcept)
+}
+
+func (ctx *Context) combine(other *Context, by string, op setOp) *Context {
+	if ctx.err != nil {
+		return ctx
+	}
+	if other.err != nil {
+		return ctx.fail(other.err)
+	}
+	var q *Query
+	if len(by) > 0 {
+		var err error
+		q, err = ctx.opts.compile(by)
+		if err != nil {
+			return ctx.fail(err)
+		}
+	}
+	e := ctx.opts.env()
+
+	otherKeys := make([]string, len(other.selection))
+	inOther := make(map[string]bool)
+	for idx, sel := range other.selection {
+		key, err := setKey(e, q, sel)
+		if err != nil {
+			return ctx.fail(err)
+		}
+		otherKeys[idx] = key
+		inOther[key] = true
+	}
+
+	seen := make(map[string]bool)
+	var result []interface{}
+	for _, sel := range ctx.selection {
+		key, err := setKey(e, q, sel)
+		if err != nil {
+			return ctx.fail(err)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch op {
+		case setIntersect:
+			if !inOther[key] {
+				continue
+			}
+
+		case setExcept:
+			if inOther[key] {
+				continue
+			}
+		}
+		result = append(result, sel)
+	}
+	if op == setUnion {
+		for idx, sel := range other.selection {
+			if seen[otherKeys[idx]] {
+				continue
+			}
+			seen[otherKeys[idx]] = true
+			result = append(result, sel)
+		}
+	}
+	return ctx.with(result)
+}
+
+// setKey returns the key that identifies the value v in the set
+// operations. If the query q is not nil, the key is computed from the
+// value of q. The equal values have equal keys.
+func setKey(e *env, q *Query, v interface{}) (string, error) {
+	if q != nil {
+		val, err := q.eval(e, v)
+		if err != nil && err != ErrorOptionalMissing {
+			return "", err
+		}
+		v = val
+	}
+	var sb strings.Builder
+	writeSetKey(&sb, v)
+	return sb.String(), nil
+}
+
+// writeSetKey writes the canonical representation of the value v. The
+// object keys are written in sorted order and the numbers in their
+// canonical form.
+func writeSetKey(sb *strings.Builder, v interface{}) {
+	v = normalize(v)
+	switch val := v.(type) {
+	case nil:
+		sb.WriteString("null")
+
+	case bool:
+		sb.WriteString(strconv.FormatBool(val))
+
+	case string:
+		formatString(sb, val)
+
+	case map[string]interface{}:
+		sb.WriteByte('{')
+		for idx, key := range sortedKeys(val) {
+			if idx > 0 {
+				sb.WriteByte(',')
+			}
+			formatString(sb, key)
+			sb.WriteByte(':')
+			writeSetKey(sb, val[key])
+		}
+		sb.WriteByte('}')
+
+	default:
+		if num, ok := toNumber(val); ok {
+			num = num.canonical()
+			switch {
+			case num.isInt:
+				sb.WriteString(strconv.FormatInt(num.i, 10))
+			case len(num.key) > 0:
+				sb.WriteString(num.key)
+			default:
+				sb.WriteString(strconv.FormatFloat(num.f, 'g', -1, 64))
+			}
+			return
+		}
+		arr, _ := arrayValue(val)
+		sb.WriteByte('[')
+		for idx, item := range arr {
+			if idx > 0 {
+				sb.WriteByte(',')
+			}
+			writeSetKey(sb, item)
+		}
+		sb.WriteByte(']')
+	}
+}
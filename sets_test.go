@@ -0,0 +1,94 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var changesA = `{
+    "items": [
+        {"key": "OP-1", "status": "open", "priority": 1},
+        {"key": "OP-2", "status": "done", "priority": 2.0},
+        {"key": "OP-3", "status": "open", "priority": 3},
+        {"key": "OP-1", "status": "open", "priority": 1}
+    ]
+}`
+
+var changesB = `{
+    "items": [
+        {"priority": 2, "status": "done", "key": "OP-2"},
+        {"key": "OP-3", "status": "done", "priority": 3},
+        {"key": "OP-4", "status": "open", "priority": 4}
+    ]
+}`
+
+func setKeys(t *testing.T, ctx *Context) string {
+	keys, err := ctx.Select("key").Strings()
+	if err != nil {
+		t.Fatalf("Strings failed: %s", err)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestSetOperations(t *testing.T) {
+	a := Ctx(changesA).Select("items[]")
+	b := Ctx(changesB).Select("items[]")
+
+	tests := []struct {
+		name     string
+		ctx      *Context
+		expected string
+	}{
+		{"Union", a.Union(b, ""), "OP-1,OP-2,OP-3,OP-3,OP-4"},
+		{"Intersect", a.Intersect(b, ""), "OP-2"},
+		{"Except", a.Except(b, ""), "OP-1,OP-3"},
+		{"UnionBy", a.Union(b, "key"), "OP-1,OP-2,OP-3,OP-4"},
+		{"IntersectBy", a.Intersect(b, "key"), "OP-2,OP-3"},
+		{"ExceptBy", a.Except(b, "key"), "OP-1"},
+		{"ExceptByObject", a.Except(b, "{key: key, status: status}"),
+			"OP-1,OP-3"},
+		{"ExceptOptional", a.Except(b, "?missing"), ""},
+	}
+	for _, test := range tests {
+		keys := setKeys(t, test.ctx)
+		if keys != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, keys, test.expected)
+		}
+	}
+
+	var numbers interface{}
+	d := json.NewDecoder(strings.NewReader(`[1, 1.0, 10000000000000000001, 2]`))
+	d.UseNumber()
+	err := d.Decode(&numbers)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	floats := Ctx(map[string]interface{}{
+		"n": []interface{}{1.0, 1e19 + 1},
+	}).Select("n[]")
+	n, err := Ctx(map[string]interface{}{
+		"n": numbers,
+	}).Select("n[]").Except(floats, "").Count()
+	if err != nil {
+		t.Fatalf("Except failed: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("unexpected number Except count: %d", n)
+	}
+
+	_, err = a.Union(b, "key ==").Get()
+	if err == nil {
+		t.Errorf("Union accepted invalid query")
+	}
+	_, err = a.Union(b, "missing").Get()
+	if err == nil {
+		t.Errorf("Union accepted missing key")
+	}
+}
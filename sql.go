@@ -0,0 +1,326 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CompileSQL compiles an SQL-like SELECT statement into a Query. The
+// statement has the form:
+//
+//	SELECT column FROM path [WHERE condition]
+//
+// The FROM path selects the rows, typically an array, and the column
+// path selects the values from the matching rows. The column * selects
+// the rows themselves. The paths have the query syntax. The condition
+// compares columns to string literals in single quotes, integers, or
+// NULL with the operators =, <>, !=, <, <=, >, and >=, and tests
+// columns with IS NULL and IS NOT NULL. The comparisons are combined
+// with AND and OR, where AND binds tighter than OR, and grouped with
+// parentheses. The keywords are case-insensitive. For example, the
+// statement
+//
+//	SELECT toString FROM issue.changelog.items
+//	WHERE fieldId = 'assignee' AND priority >= 10
+//
+// is equivalent to the query
+//
+//	issue.changelog.items[fieldId == "assignee" && priority >= 10].toString
+func CompileSQL(stmt string) (*Query, error) {
+	q, err := parseSQL(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return newQuery(stmt, q), nil
+}
+
+func parseSQL(stmt string) (*query, error) {
+	err := checkLength(stmt)
+	if err != nil {
+		return nil, err
+	}
+	lexer := newLexer(stmt)
+	lexer.sql = true
+
+	err = expectKeyword(lexer, "SELECT")
+	if err != nil {
+		return nil, err
+	}
+	t, err := lexer.Expect("'*' or column")
+	if err != nil {
+		return nil, err
+	}
+	var column *query
+	if t.Type != tStar {
+		lexer.Unget(t)
+		column, err = parsePath(lexer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = expectKeyword(lexer, "FROM")
+	if err != nil {
+		return nil, err
+	}
+	q, err := parsePath(lexer)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.typ) > 0 {
+		return nil, fmt.Errorf("jsonq: SQL FROM path with type assertion not supported")
+	}
+
+	var where filter = &all{}
+	t, err = lexer.Get()
+	if err == nil {
+		if !isKeyword(t, "WHERE") {
+			return nil, lexer.SyntaxError("WHERE or end of statement")
+		}
+		where, err = parseSQLOr(lexer)
+		if err != nil {
+			return nil, err
+		}
+		_, err = lexer.Get()
+		if err == nil {
+			return nil, lexer.SyntaxError("AND, OR, or end of statement")
+		}
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	q.filters = append(q.filters, where)
+
+	if column != nil {
+		for _, s := range column.appendSegments(nil) {
+			segment := *s
+			segment.left = q
+			q = &segment
+		}
+	}
+	err = q.checkDepth()
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// isKeyword tests if the token t is the SQL keyword kw.
+func isKeyword(t token, kw string) bool {
+	return t.Type == tString && !t.Quoted && strings.EqualFold(t.StrVal, kw)
+}
+
+func expectKeyword(lexer *lexer, kw string) error {
+	t, err := lexer.Expect(kw)
+	if err != nil {
+		return err
+	}
+	if !isKeyword(t, kw) {
+		return lexer.SyntaxError(kw)
+	}
+	return nil
+}
+
+func parseSQLOr(lexer *lexer) (filter, error) {
+	left, err := parseSQLAnd(lexer)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := lexer.Get()
+		if err != nil {
+			if err == io.EOF {
+				return left, nil
+			}
+			return nil, err
+		}
+		if !isKeyword(t, "OR") {
+			lexer.Unget(t)
+			return left, nil
+		}
+		right, err := parseSQLAnd(lexer)
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{
+			Left:  left,
+			Op:    tOr,
+			Right: right,
+		}
+	}
+}
+
+func parseSQLAnd(lexer *lexer) (filter, error) {
+	left, err := parseSQLPrimary(lexer)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := lexer.Get()
+		if err != nil {
+			if err == io.EOF {
+				return left, nil
+			}
+			return nil, err
+		}
+		if !isKeyword(t, "AND") {
+			lexer.Unget(t)
+			return left, nil
+		}
+		right, err := parseSQLPrimary(lexer)
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{
+			Left:  left,
+			Op:    tAnd,
+			Right: right,
+		}
+	}
+}
+
+func parseSQLPrimary(lexer *lexer) (filter, error) {
+	t, err := lexer.Expect("condition")
+	if err != nil {
+		return nil, err
+	}
+	if t.Type != tLParen {
+		lexer.Unget(t)
+		return parseSQLComparison(lexer)
+	}
+	err = lexer.Nest()
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Unnest()
+
+	f, err := parseSQLOr(lexer)
+	if err != nil {
+		return nil, err
+	}
+	err = expectToken(lexer, tRParen)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var sqlOps = map[tokenType]tokenType{
+	tAssign: tEq,
+	tEq:     tEq,
+	tNeq:    tNeq,
+	tLt:     tLt,
+	tLe:     tLe,
+	tGt:     tGt,
+	tGe:     tGe,
+}
+
+func parseSQLComparison(lexer *lexer) (filter, error) {
+	left, leftColumn, err := parseSQLOperand(lexer)
+	if err != nil {
+		return nil, err
+	}
+	t, err := lexer.Expect("comparison operator or IS")
+	if err != nil {
+		return nil, err
+	}
+	if isKeyword(t, "IS") {
+		if !leftColumn {
+			return nil, fmt.Errorf("jsonq: SQL IS must test a column")
+		}
+		op := tEq
+		t, err = lexer.Expect("NOT or NULL")
+		if err != nil {
+			return nil, err
+		}
+		if isKeyword(t, "NOT") {
+			op = tNeq
+			t, err = lexer.Expect("NULL")
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !isKeyword(t, "NULL") {
+			return nil, lexer.SyntaxError("NULL")
+		}
+		return &comparative{
+			Left: left,
+			Op:   op,
+			Right: &atom{
+				Type: tNull,
+			},
+		}, nil
+	}
+	op, ok := sqlOps[t.Type]
+	if !ok {
+		return nil, lexer.SyntaxError("comparison operator or IS")
+	}
+	right, rightColumn, err := parseSQLOperand(lexer)
+	if err != nil {
+		return nil, err
+	}
+	if leftColumn == rightColumn {
+		return nil, fmt.Errorf("jsonq: SQL comparison must compare a column to a literal")
+	}
+	if rightColumn {
+		return &comparative{
+			Left:  right,
+			Op:    mirrorOps[op],
+			Right: left,
+		}, nil
+	}
+	return &comparative{
+		Left:  left,
+		Op:    op,
+		Right: right,
+	}, nil
+}
+
+// parseSQLOperand parses a comparison operand. The column return
+// value tells if the operand is a column or a literal value.
+func parseSQLOperand(lexer *lexer) (*atom, bool, error) {
+	t, err := lexer.Expect("column, string literal, integer, or NULL")
+	if err != nil {
+		return nil, false, err
+	}
+	switch t.Type {
+	case tString:
+		if isKeyword(t, "NULL") {
+			return &atom{
+				Type: tNull,
+			}, false, nil
+		}
+		lexer.Unget(t)
+		q, err := parsePath(lexer)
+		if err != nil {
+			return nil, false, err
+		}
+		return &atom{
+			Type:   tString,
+			StrVal: q.format(),
+		}, true, nil
+
+	case tLiteral:
+		return &atom{
+			Type:   tString,
+			StrVal: t.StrVal,
+		}, false, nil
+
+	case tInt:
+		return &atom{
+			Type:   tInt,
+			IntVal: t.Int,
+			BigVal: t.Big,
+		}, false, nil
+
+	default:
+		return nil, false,
+			lexer.SyntaxError("column, string literal, integer, or NULL")
+	}
+}
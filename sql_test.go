@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+var sqlTests = []struct {
+	stmt     string
+	expected string
+}{
+	{`SELECT toString FROM issue.changelog.items
+      WHERE fieldId = 'assignee' AND priority >= 10`,
+		`["Veijo Linux","Milton Waddams"]`},
+	{`select toString from issue.changelog.items where 10 < priority`,
+		`["development"]`},
+	{`SELECT fieldId FROM issue.changelog.items`,
+		`["status","assignee","assignee"]`},
+	{`SELECT toString FROM issue.changelog.items
+      WHERE fieldId <> 'assignee' OR fromString IS NULL`,
+		`["development","Veijo Linux"]`},
+	{`SELECT toString FROM issue.changelog.items
+      WHERE fromString IS NOT NULL AND (priority > 10 OR toString = 'Milton Waddams')`,
+		`["development","Milton Waddams"]`},
+	{`SELECT * FROM issue.changelog.items WHERE fromString = 'Veijo Linux'`,
+		`[{"fieldId":"assignee","fromString":"Veijo Linux","priority":10,"toString":"Milton Waddams"}]`},
+	{`SELECT "project".name FROM issue.fields`, `["Operations"]`},
+	{`SELECT key FROM issue WHERE fields.project.name = 'Operations'`,
+		`["OP-1"]`},
+	{`SELECT toString FROM issue.changelog.items WHERE toString = 'Veijo ''Linux'''`,
+		`[]`},
+}
+
+func TestCompileSQL(t *testing.T) {
+	v := parseAssign(t)
+
+	for _, test := range sqlTests {
+		q, err := CompileSQL(test.stmt)
+		if err != nil {
+			t.Fatalf("CompileSQL(%s) failed: %s", test.stmt, err)
+		}
+		data, err := q.GetJSON(v)
+		if err != nil {
+			t.Fatalf("GetJSON(%s) failed: %s", test.stmt, err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.stmt, data, test.expected)
+		}
+	}
+
+	for _, stmt := range []string{
+		``, `SELECT`, `SELECT a`, `SELECT a FROM`, `a FROM b`,
+		`SELECT a FROM b WHERE`, `SELECT a FROM b WHERE c`,
+		`SELECT a FROM b WHERE c = d`, `SELECT a FROM b WHERE 'c' = 1`,
+		`SELECT a FROM b WHERE c = 'd' AND`, `SELECT a FROM b WHERE c = 'd`,
+		`SELECT a FROM b WHERE (c = 'd'`, `SELECT a FROM b WHERE c IS 1`,
+		`SELECT a FROM b WHERE 'c' IS NULL`, `SELECT a FROM b LIMIT 1`,
+		`SELECT a FROM b::array`, `SELECT a FROM b WHERE c = 'd' e`,
+	} {
+		_, err := CompileSQL(stmt)
+		if err == nil {
+			t.Errorf("CompileSQL accepted %s", stmt)
+		}
+	}
+}
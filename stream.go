@@ -0,0 +1,54 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Stream decodes newline-delimited JSON (JSON Lines) records from the
+// reader one at a time, selects the query q from each record, and
+// calls the function fn with the selection context. If the selection
+// fails for a record, the context passed to fn holds the selection
+// error. Stream returns when the input ends, the input can't be
+// decoded, or fn returns an error.
+func Stream(r io.Reader, q string, fn func(ctx *Context) error) error {
+	return StreamContext(context.Background(), r, q, fn)
+}
+
+// StreamContext streams the records like Stream but stops when the
+// context c is canceled or its deadline expires. In that case,
+// StreamContext returns the context's error.
+func StreamContext(c context.Context, r io.Reader, q string,
+	fn func(ctx *Context) error) error {
+
+	query, err := cachedCompile(q)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(r)
+	for {
+		err = c.Err()
+		if err != nil {
+			return err
+		}
+		var record interface{}
+		err = dec.Decode(&record)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		err = fn(Ctx(record).SelectQContext(c, query))
+		if err != nil {
+			return err
+		}
+	}
+}
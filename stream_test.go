@@ -0,0 +1,72 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var records = `{"level": "info", "msg": "started", "fields": {"port": 80}}
+{"level": "error", "msg": "failed", "fields": {"port": 443}}
+{"level": "info", "msg": "no fields"}
+`
+
+func TestStream(t *testing.T) {
+	var ports []int
+	var failed int
+	err := Stream(strings.NewReader(records), "fields.port",
+		func(ctx *Context) error {
+			p, err := ctx.Ints()
+			if err != nil {
+				failed++
+				return nil
+			}
+			ports = append(ports, p...)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Stream failed: %s", err)
+	}
+	if len(ports) != 2 || ports[0] != 80 || ports[1] != 443 || failed != 1 {
+		t.Errorf("Stream: got ports %v, failed %v", ports, failed)
+	}
+
+	stop := errors.New("stop")
+	var count int
+	err = Stream(strings.NewReader(records), "msg", func(ctx *Context) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("Stream did not stop: err=%v, count=%v", err, count)
+	}
+
+	err = Stream(strings.NewReader(records+"{"), "msg",
+		func(ctx *Context) error {
+			return nil
+		})
+	if err == nil {
+		t.Errorf("Stream accepted invalid input")
+	}
+}
+
+func TestStreamContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var count int
+	err := StreamContext(ctx, strings.NewReader(records), "msg",
+		func(c *Context) error {
+			count++
+			cancel()
+			return nil
+		})
+	if err != context.Canceled || count != 1 {
+		t.Errorf("StreamContext did not stop: err=%v, count=%v", err, count)
+	}
+}
@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"math"
+)
+
+// Strictness specifies how the getters and the filter comparisons
+// coerce values to the requested types.
+type Strictness int
+
+// The strictness levels.
+const (
+	// Default converts null values to empty strings and truncates
+	// fractional numbers to integers.
+	Default Strictness = iota
+	// Strict rejects null values as strings and fractional numbers
+	// as integers.
+	Strict
+	// Lenient converts values like Default and also converts numbers
+	// and booleans to strings, and strings holding numbers or
+	// booleans to numbers and booleans.
+	Lenient
+)
+
+var strictnessNames = map[Strictness]string{
+	Default: "default",
+	Strict:  "strict",
+	Lenient: "lenient",
+}
+
+func (s Strictness) String() string {
+	name, ok := strictnessNames[s]
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("{Strictness %d}", s)
+}
+
+// WithStrictness sets the strictness of the type coercions.
+func WithStrictness(s Strictness) Option {
+	return func(o *options) {
+		o.strictness = s
+	}
+}
+
+// strict returns the strictness level of the options.
+func (o *options) strict() Strictness {
+	if o == nil {
+		return Default
+	}
+	return o.strictness
+}
+
+// intValue converts the number f to int. The strict level rejects
+// fractional numbers.
+func (o *options) intValue(f float64) (int, bool) {
+	if o.strict() == Strict && f != math.Trunc(f) {
+		return 0, false
+	}
+	return int(f), true
+}
@@ -0,0 +1,68 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStrictness(t *testing.T) {
+	v := map[string]interface{}{
+		"name":    nil,
+		"ratio":   2.5,
+		"enabled": "true",
+		"count":   "42",
+		"ratios":  []interface{}{1.0, 2.5},
+	}
+
+	var typeErr *TypeError
+
+	s, err := GetString(v, "name")
+	if err != nil || s != "" {
+		t.Errorf("Default GetString: got %q %v", s, err)
+	}
+	_, err = GetString(v, "name", WithStrictness(Strict))
+	if !errors.As(err, &typeErr) || typeErr.Got != "null" {
+		t.Errorf("Strict GetString: expected TypeError, got %v", err)
+	}
+
+	n, err := GetInt(v, "ratio")
+	if err != nil || n != 2 {
+		t.Errorf("Default GetInt: got %v %v", n, err)
+	}
+	_, err = GetInt(v, "ratio", WithStrictness(Strict))
+	if !errors.As(err, &typeErr) || typeErr.Want != "int" {
+		t.Errorf("Strict GetInt: expected TypeError, got %v", err)
+	}
+	_, err = Ctx(v, WithStrictness(Strict)).Select("ratios").Ints()
+	if !errors.As(err, &typeErr) || typeErr.Query != "[1]" {
+		t.Errorf("Strict Ints: expected TypeError, got %v", err)
+	}
+
+	_, err = GetBool(v, "enabled")
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Default GetBool: expected TypeError, got %v", err)
+	}
+	b, err := GetBool(v, "enabled", WithStrictness(Lenient))
+	if err != nil || !b {
+		t.Errorf("Lenient GetBool: got %v %v", b, err)
+	}
+	n, err = GetInt(v, "count", WithStrictness(Lenient))
+	if err != nil || n != 42 {
+		t.Errorf("Lenient GetInt: got %v %v", n, err)
+	}
+
+	q, err := Compile("ratio", WithStrictness(Strict))
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	_, err = q.GetInt(v)
+	if err == nil {
+		t.Errorf("Strict Query.GetInt accepted fractional number")
+	}
+}
@@ -0,0 +1,645 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FromTOML creates a new selection context from the TOML data. See
+// ParseTOML for details about the conversion.
+func FromTOML(data []byte) (*Context, error) {
+	root, err := ParseTOML(data)
+	if err != nil {
+		return nil, err
+	}
+	return Ctx(root), nil
+}
+
+// ParseTOML parses the TOML document and returns it in the same
+// generic form that json.Unmarshal produces for JSON objects. The
+// tables are converted to map[string]interface{} values, arrays to
+// []interface{} values, and integers and floats to float64
+// numbers. The date and time values are returned as strings in their
+// TOML representation.
+func ParseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{
+		input:   string(data),
+		line:    1,
+		root:    make(map[string]interface{}),
+		defined: make(map[string]bool),
+	}
+	p.current = p.root
+	err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return p.root, nil
+}
+
+type tomlParser struct {
+	input   string
+	pos     int
+	line    int
+	root    map[string]interface{}
+	current map[string]interface{}
+	defined map[string]bool
+}
+
+func (p *tomlParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("jsonq: toml: line %d: %s", p.line,
+		fmt.Sprintf(format, a...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.input[p.pos:], prefix)
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipComment skips a comment until the end of the line.
+func (p *tomlParser) skipComment() {
+	if p.peek() != '#' {
+		return
+	}
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines, and comments.
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\n':
+			p.pos++
+			p.line++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine consumes the rest of the line after an expression.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	p.skipComment()
+	if p.hasPrefix("\r\n") {
+		p.pos++
+	}
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected character %q", p.peek())
+	}
+	p.pos++
+	p.line++
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil
+		}
+		var err error
+		if p.hasPrefix("[[") {
+			err = p.parseArrayTable()
+		} else if p.peek() == '[' {
+			err = p.parseTable()
+		} else {
+			err = p.parseKeyValue(p.current)
+		}
+		if err != nil {
+			return err
+		}
+		err = p.endOfLine()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *tomlParser) parseTable() error {
+	p.pos++
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != ']' {
+		return p.errorf("expected ']'")
+	}
+	p.pos++
+
+	name := strings.Join(keys, "\x00")
+	if p.defined[name] {
+		return p.errorf("table [%s] defined twice", strings.Join(keys, "."))
+	}
+	p.defined[name] = true
+
+	table, err := p.descend(p.root, keys)
+	if err != nil {
+		return err
+	}
+	p.current = table
+	return nil
+}
+
+func (p *tomlParser) parseArrayTable() error {
+	p.pos += 2
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if !p.hasPrefix("]]") {
+		return p.errorf("expected ']]'")
+	}
+	p.pos += 2
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	var arr []interface{}
+	old, ok := parent[key]
+	if ok {
+		arr, ok = old.([]interface{})
+		if !ok {
+			return p.errorf("key '%s' is not an array of tables", key)
+		}
+	}
+	table := make(map[string]interface{})
+	parent[key] = append(arr, table)
+	p.current = table
+
+	// Reset the sub-table definitions of the array element.
+	prefix := strings.Join(keys, "\x00") + "\x00"
+	for name := range p.defined {
+		if strings.HasPrefix(name, prefix) {
+			delete(p.defined, name)
+		}
+	}
+	return nil
+}
+
+// descend finds the table at the dotted key path, creating missing
+// tables. The arrays of tables are descended into their last
+// elements.
+func (p *tomlParser) descend(table map[string]interface{}, keys []string) (
+	map[string]interface{}, error) {
+
+	for _, key := range keys {
+		child, ok := table[key]
+		if !ok {
+			child = make(map[string]interface{})
+			table[key] = child
+		}
+		switch c := child.(type) {
+		case map[string]interface{}:
+			table = c
+
+		case []interface{}:
+			if len(c) == 0 {
+				return nil, p.errorf("key '%s' is not a table", key)
+			}
+			last, ok := c[len(c)-1].(map[string]interface{})
+			if !ok {
+				return nil, p.errorf("key '%s' is not a table", key)
+			}
+			table = last
+
+		default:
+			return nil, p.errorf("key '%s' is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return p.errorf("expected '='")
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	parent, err := p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	_, ok := parent[key]
+	if ok {
+		return p.errorf("key '%s' defined twice", strings.Join(keys, "."))
+	}
+	parent[key] = value
+	return nil
+}
+
+// parseKey parses a dotted key and the whitespace following it.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var key string
+		var err error
+		switch p.peek() {
+		case '"':
+			key, err = p.parseBasicString()
+		case '\'':
+			key, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected key")
+			}
+			key = p.input[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' ||
+		ch >= '0' && ch <= '9' || ch == '_' || ch == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch {
+	case p.eof():
+		return nil, p.errorf("expected value")
+
+	case p.hasPrefix(`"""`):
+		return p.parseMultiLineBasicString()
+
+	case p.peek() == '"':
+		return p.parseBasicString()
+
+	case p.hasPrefix("'''"):
+		return p.parseMultiLineLiteralString()
+
+	case p.peek() == '\'':
+		return p.parseLiteralString()
+
+	case p.peek() == '[':
+		return p.parseArray()
+
+	case p.peek() == '{':
+		return p.parseInlineTable()
+
+	case p.hasPrefix("true"):
+		p.pos += 4
+		return true, nil
+
+	case p.hasPrefix("false"):
+		p.pos += 5
+		return false, nil
+
+	default:
+		return p.parseNumberOrDate()
+	}
+}
+
+func (p *tomlParser) parseArray() (interface{}, error) {
+	p.pos++
+	result := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return result, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (interface{}, error) {
+	p.pos++
+	result := make(map[string]interface{})
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		return result, nil
+	}
+	for {
+		err := p.parseKeyValue(result)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return result, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		ch := p.peek()
+		switch ch {
+		case '"':
+			p.pos++
+			return sb.String(), nil
+
+		case '\\':
+			err := p.parseEscape(&sb)
+			if err != nil {
+				return "", err
+			}
+
+		default:
+			sb.WriteByte(ch)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) parseMultiLineBasicString() (string, error) {
+	p.pos += 3
+	p.trimNewline()
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if p.hasPrefix(`"""`) {
+			p.pos += 3
+			// Up to two additional quotes belong to the string.
+			for i := 0; i < 2 && p.peek() == '"'; i++ {
+				sb.WriteByte('"')
+				p.pos++
+			}
+			return sb.String(), nil
+		}
+		ch := p.peek()
+		switch ch {
+		case '\\':
+			if p.lineEndingBackslash() {
+				continue
+			}
+			err := p.parseEscape(&sb)
+			if err != nil {
+				return "", err
+			}
+
+		case '\n':
+			p.line++
+			sb.WriteByte(ch)
+			p.pos++
+
+		default:
+			sb.WriteByte(ch)
+			p.pos++
+		}
+	}
+}
+
+// lineEndingBackslash tests if the current backslash ends the line
+// and skips the backslash and all whitespace following it.
+func (p *tomlParser) lineEndingBackslash() bool {
+	i := p.pos + 1
+	for i < len(p.input) && (p.input[i] == ' ' || p.input[i] == '\t' ||
+		p.input[i] == '\r') {
+		i++
+	}
+	if i >= len(p.input) || p.input[i] != '\n' {
+		return false
+	}
+	p.pos = i
+	p.skipBlank()
+	return true
+}
+
+func (p *tomlParser) trimNewline() {
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	}
+}
+
+func (p *tomlParser) parseEscape(sb *strings.Builder) error {
+	p.pos++
+	if p.eof() {
+		return p.errorf("unterminated escape")
+	}
+	ch := p.peek()
+	p.pos++
+	switch ch {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if ch == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.input) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.input[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+		sb.WriteRune(rune(code))
+	default:
+		return p.errorf("invalid escape '\\%c'", ch)
+	}
+	return nil
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++
+	start := p.pos
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		if p.peek() == '\'' {
+			str := p.input[start:p.pos]
+			p.pos++
+			return str, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseMultiLineLiteralString() (string, error) {
+	p.pos += 3
+	p.trimNewline()
+	start := p.pos
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if p.hasPrefix("'''") {
+			end := p.pos
+			p.pos += 3
+			// Up to two additional quotes belong to the string.
+			for i := 0; i < 2 && p.peek() == '\''; i++ {
+				p.pos++
+				end++
+			}
+			return p.input[start:end], nil
+		}
+		if p.peek() == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseNumberOrDate() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && isValueChar(p.peek()) {
+		p.pos++
+	}
+	// Date-time values can separate the date and time with a space.
+	if p.pos-start == 10 && p.input[start+4] == '-' &&
+		p.pos+1 < len(p.input) && p.peek() == ' ' &&
+		p.input[p.pos+1] >= '0' && p.input[p.pos+1] <= '9' {
+		p.pos++
+		for !p.eof() && isValueChar(p.peek()) {
+			p.pos++
+		}
+	}
+	token := p.input[start:p.pos]
+	if len(token) == 0 {
+		return nil, p.errorf("expected value")
+	}
+	if isDateTime(token) {
+		return token, nil
+	}
+
+	switch strings.TrimLeft(token, "+-") {
+	case "inf":
+		if token[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	clean := strings.Replace(token, "_", "", -1)
+	if len(clean) > 2 && clean[0] == '0' {
+		var base int
+		switch clean[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 0 {
+			v, err := strconv.ParseInt(clean[2:], base, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number '%s'", token)
+			}
+			return float64(v), nil
+		}
+	}
+	v, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return nil, p.errorf("invalid value '%s'", token)
+	}
+	return v, nil
+}
+
+func isValueChar(ch byte) bool {
+	return isBareKeyChar(ch) || ch == '+' || ch == '.' || ch == ':'
+}
+
+func isDateTime(token string) bool {
+	if len(token) >= 10 && token[4] == '-' && token[7] == '-' {
+		return true
+	}
+	return len(token) >= 8 && token[2] == ':' && token[5] == ':'
+}
@@ -0,0 +1,86 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+var tomlConfig = `# Service configuration.
+title = "TOML \"example\""
+version = 2
+ratio = 0.5_0
+enabled = true
+started = 1979-05-27 07:32:00Z
+hex = 0xff
+path = 'C:\Users'
+"quoted key" = """
+multi \
+  line"""
+literal = '''
+raw\n'''
+site."google.com" = true
+
+[server]
+host = "localhost" # Trailing comment.
+ports = [ 8000,
+  8001, # Port comment.
+  8002, ]
+limits = { cpu = 2, memory = { max = 1e3 } }
+
+[server.tls]
+enabled = false
+
+[[issue]]
+key = "OP-1"
+
+[issue.fields]
+project = "Operations"
+
+[[issue]]
+key = "OP-2"
+`
+
+func TestParseTOML(t *testing.T) {
+	v, err := ParseTOML([]byte(tomlConfig))
+	if err != nil {
+		t.Fatalf("ParseTOML failed: %s", err)
+	}
+	expected := `{"enabled":true,"hex":255,"issue":[{"fields":{"project":"Operations"},"key":"OP-1"},{"key":"OP-2"}],"literal":"raw\\n","path":"C:\\Users","quoted key":"multi line","ratio":0.5,"server":{"host":"localhost","limits":{"cpu":2,"memory":{"max":1000}},"ports":[8000,8001,8002],"tls":{"enabled":false}},"site":{"google.com":true},"started":"1979-05-27 07:32:00Z","title":"TOML \"example\"","version":2}`
+	result := marshal(t, v)
+	if result != expected {
+		t.Errorf("ParseTOML:\ngot      %s\nexpected %s", result, expected)
+	}
+
+	ctx, err := FromTOML([]byte(tomlConfig))
+	if err != nil {
+		t.Fatalf("FromTOML failed: %s", err)
+	}
+	keys, err := ctx.Select(`issue[].key`).Strings()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	if len(keys) != 2 || keys[1] != "OP-2" {
+		t.Errorf("FromTOML: got %v", keys)
+	}
+
+	for _, data := range []string{
+		"a = 1\na = 2",
+		"[a]\n[a]",
+		"a = \"unterminated",
+		"a = 1 b = 2",
+		"a = [1 2]",
+		"a = \"\\q\"",
+		"a = 1\n[a.b]",
+		"= 1",
+	} {
+		_, err = ParseTOML([]byte(data))
+		if err == nil {
+			t.Errorf("ParseTOML accepted %q", data)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+// Tracer receives callbacks about the progress of query evaluation.
+// The tracer allows you to find out where a query stops matching a
+// document. The callbacks are called synchronously from the
+// evaluating goroutine.
+type Tracer interface {
+	// OnSegment is called when the query segment path selects the
+	// value from its parent value. The value is the selected value
+	// before the segment's filters are applied.
+	OnSegment(path string, value interface{})
+	// OnFilter is called when the filter expression expr is
+	// evaluated for the array element idx. The matched argument
+	// tells if the element matched the filter.
+	OnFilter(expr string, idx int, matched bool)
+}
+
+// WithTracer traces the query evaluation with the tracer. The
+// lookups of the filter operand fields are not traced.
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// tracing tests if the evaluation is traced.
+func (e *env) tracing() bool {
+	o := e.options()
+	return o != nil && o.tracer != nil
+}
+
+// traceSegment reports the value selected by the query segment q.
+func (e *env) traceSegment(q *query, v interface{}) {
+	if e.tracing() && e.filtering == 0 {
+		e.opts.tracer.OnSegment(q.String(), v)
+	}
+}
+
+// traceFilter reports the result of the filter f for the element idx.
+func (e *env) traceFilter(f filter, idx int, matched bool) {
+	if e.tracing() && e.filtering == 0 {
+		e.opts.tracer.OnFilter(filterString(f), idx, matched)
+	}
+}
+
+// evalFilter evaluates the filter f for the element v. The filter
+// operand lookups are not traced.
+func (e *env) evalFilter(f filter, idx int, v interface{}) (bool, error) {
+	if e == nil {
+		return f.Eval(e, idx, v)
+	}
+	e.filtering++
+	e.filtered++
+	match, err := f.Eval(e, idx, v)
+	e.filtering--
+	return match, err
+}
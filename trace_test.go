@@ -0,0 +1,78 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type recordingTracer struct {
+	events []string
+}
+
+func (t *recordingTracer) OnSegment(path string, value interface{}) {
+	t.events = append(t.events, fmt.Sprintf("segment %s", path))
+}
+
+func (t *recordingTracer) OnFilter(expr string, idx int, matched bool) {
+	t.events = append(t.events, fmt.Sprintf("filter %s %d %v",
+		expr, idx, matched))
+}
+
+func TestTracer(t *testing.T) {
+	v := parseAssign(t)
+
+	tracer := new(recordingTracer)
+	_, err := Get(v, `issue.changelog.items[fieldId=="assignee"].missing`,
+		WithTracer(tracer))
+	if err == nil {
+		t.Fatalf("Get did not fail")
+	}
+	expected := []string{
+		"segment issue",
+		"segment issue.changelog",
+		`segment issue.changelog.items[fieldId == "assignee"]`,
+		`filter fieldId == "assignee" 0 false`,
+		`filter fieldId == "assignee" 1 true`,
+		`filter fieldId == "assignee" 2 true`,
+	}
+	if !reflect.DeepEqual(tracer.events, expected) {
+		t.Errorf("Get: got %q, expected %q", tracer.events, expected)
+	}
+
+	tracer = new(recordingTracer)
+	q, err := Compile("issue.key", WithTracer(tracer))
+	if err != nil {
+		t.Fatalf("Compile failed: %s", err)
+	}
+	_, err = q.GetString(v)
+	if err != nil {
+		t.Fatalf("GetString failed: %s", err)
+	}
+	expected = []string{
+		"segment issue",
+		"segment issue.key",
+	}
+	if !reflect.DeepEqual(tracer.events, expected) {
+		t.Errorf("GetString: got %q, expected %q", tracer.events, expected)
+	}
+
+	tracer = new(recordingTracer)
+	_, err = Ctx(v, WithTracer(tracer)).Select("issue").Select("key").Get()
+	if err != nil {
+		t.Fatalf("Select failed: %s", err)
+	}
+	expected = []string{
+		"segment issue",
+		"segment key",
+	}
+	if !reflect.DeepEqual(tracer.events, expected) {
+		t.Errorf("Select: got %q, expected %q", tracer.events, expected)
+	}
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// typeNames lists the type names of the ::type assertions.
+var typeNames = map[string]bool{
+	"null":   true,
+	"bool":   true,
+	"number": true,
+	"int":    true,
+	"string": true,
+	"array":  true,
+	"object": true,
+}
+
+func validType(name string) bool {
+	return typeNames[name]
+}
+
+// checkType checks that the value v has the query's asserted type.
+func (q *query) checkType(v interface{}) error {
+	name := typeName(v)
+	if name == q.typ || (q.typ == "number" && name == "int") {
+		return nil
+	}
+	return &TypeError{
+		Query: q.String(),
+		Want:  q.typ,
+		Got:   name,
+	}
+}
+
+// typeName returns the JSON type name of the value v. The integral
+// numbers have the type int.
+func typeName(v interface{}) string {
+	v = normalize(v)
+	switch val := v.(type) {
+	case nil:
+		return "null"
+
+	case bool:
+		return "bool"
+
+	case float64:
+		if val == math.Trunc(val) && !math.IsInf(val, 0) {
+			return "int"
+		}
+		return "number"
+
+	case json.Number, *big.Int, big.Int, *big.Float, big.Float:
+		n, ok := toNumber(val)
+		if !ok {
+			return "number"
+		}
+		if n.integral() {
+			return "int"
+		}
+		return "number"
+
+	case string:
+		return "string"
+
+	case []interface{}:
+		return "array"
+
+	case map[string]interface{}:
+		return "object"
+	}
+	rv := indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return "array"
+
+	case reflect.Map, reflect.Struct:
+		return "object"
+
+	case reflect.Invalid:
+		return "null"
+
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
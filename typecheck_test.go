@@ -0,0 +1,63 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeAssertions(t *testing.T) {
+	v := parseAssign(t)
+
+	valid := []string{
+		`issue.key::string`,
+		`issue.count::int`,
+		`issue.count::number`,
+		`issue.fields::object`,
+		`issue.changelog.items::array`,
+		`issue.changelog.items[].fromString::string`,
+		`issue.changelog.items[fieldId=="assignee"].priority::int`,
+	}
+	for _, q := range valid {
+		query, err := Compile(q)
+		if err != nil {
+			t.Fatalf("Compile(%s) failed: %s", q, err)
+		}
+		_, err = query.Eval(v)
+		if err == nil && strings.Contains(q, "fromString") {
+			t.Errorf("Eval(%s) accepted null value", q)
+		} else if err != nil && !strings.Contains(q, "fromString") {
+			t.Errorf("Eval(%s) failed: %s", q, err)
+		}
+		it := query.Iter(v)
+		for {
+			if _, ok := it.Next(); !ok {
+				break
+			}
+		}
+		if (it.Err() != nil) != (err != nil) {
+			t.Errorf("Iter(%s) and Eval disagree: %v, %v", q, it.Err(), err)
+		}
+		again, err := Compile(query.q.String())
+		if err != nil || again.q.typ != query.q.typ {
+			t.Errorf("String %s does not round-trip: %v", query.q, err)
+		}
+	}
+
+	_, err := Get(v, `issue.key::int`)
+	if err == nil || !strings.Contains(err.Error(), "is string, expected int") {
+		t.Errorf("Get did not fail with type error: %v", err)
+	}
+
+	for _, q := range []string{`issue.key::`, `issue.key::float`,
+		`issue.key:int`, `issue.key::int.x`} {
+		if Validate(q) == nil {
+			t.Errorf("Validate accepted %s", q)
+		}
+	}
+}
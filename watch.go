@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+// Match holds the result of a watched query for a document.
+type Match struct {
+	// Document is the document as received from the input channel.
+	Document interface{}
+	// Values are the values selected from the document.
+	Values []interface{}
+	// Err is the query error for the document, or the query
+	// compilation error.
+	Err error
+}
+
+// Watch compiles the query q once and evaluates it against every
+// document received from the channel in. The documents can be JSON
+// values or JSON data as []byte or string values, like with Ctx. For
+// each document that matches the query, Watch sends a Match holding
+// the selected values to the returned channel. The documents where
+// the query selects nothing or does not match the document structure
+// are skipped. Other evaluation errors are sent as matches with the
+// Err field set. If the query is invalid, the returned channel
+// receives a single match with the compilation error.
+//
+// The returned channel is closed when the channel in is closed and
+// all matches are delivered. The caller must receive all matches
+// from the returned channel.
+func Watch(q string, in <-chan interface{}) <-chan Match {
+	out := make(chan Match)
+	query, err := cachedCompile(q)
+	go func() {
+		defer close(out)
+		if err != nil {
+			out <- Match{
+				Err: err,
+			}
+			return
+		}
+		for doc := range in {
+			ctx := Ctx(doc).SelectQ(query)
+			if ctx.err != nil {
+				if mismatch(ctx.err) {
+					continue
+				}
+				out <- Match{
+					Document: doc,
+					Err:      ctx.err,
+				}
+				continue
+			}
+			if len(ctx.selection) == 0 {
+				continue
+			}
+			out <- Match{
+				Document: doc,
+				Values:   ctx.selection,
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2020 Markku Rossi
+//
+// All rights reserved.
+//
+
+package jsonq
+
+import (
+	"testing"
+)
+
+func TestWatch(t *testing.T) {
+	in := make(chan interface{})
+	go func() {
+		in <- `{"event": "push", "ref": "refs/heads/main"}`
+		in <- `{"event": "issues", "action": "opened"}`
+		in <- []byte(`{"event": "push", "ref": "refs/tags/v1.0"}`)
+		in <- map[string]interface{}{
+			"event": "push",
+		}
+		in <- `{"event": "push", "ref": 42}`
+		in <- `{`
+		close(in)
+	}()
+
+	var refs []string
+	var failed int
+	for match := range Watch(`ref::string`, in) {
+		if match.Err != nil {
+			failed++
+			continue
+		}
+		if len(match.Values) != 1 {
+			t.Fatalf("unexpected values: %v", match.Values)
+		}
+		refs = append(refs, match.Values[0].(string))
+	}
+	if len(refs) != 2 || refs[0] != "refs/heads/main" ||
+		refs[1] != "refs/tags/v1.0" {
+		t.Errorf("unexpected refs: %v", refs)
+	}
+	if failed != 2 {
+		t.Errorf("unexpected number of errors: %d", failed)
+	}
+
+	in = make(chan interface{})
+	go func() {
+		in <- `{"items": [{"id": 1}, {"id": 2}]}`
+		in <- `{"items": [{"id": 3}]}`
+		close(in)
+	}()
+	var count int
+	for match := range Watch(`items[id >= 2]`, in) {
+		if match.Err != nil {
+			t.Fatalf("Watch failed: %s", match.Err)
+		}
+		count += len(match.Values)
+	}
+	if count != 2 {
+		t.Errorf("unexpected number of values: %d", count)
+	}
+
+	in = make(chan interface{})
+	close(in)
+	var matches []Match
+	for match := range Watch(`items[`, in) {
+		matches = append(matches, match)
+	}
+	if len(matches) != 1 || matches[0].Err == nil {
+		t.Errorf("Watch accepted invalid query: %v", matches)
+	}
+}